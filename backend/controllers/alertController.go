@@ -0,0 +1,555 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"my-health/initializers"
+	"my-health/models"
+	"my-health/services/alerts"
+	"my-health/services/notify"
+	"my-health/validation"
+)
+
+type AlertThresholdRequest struct {
+	Warning         *float64 `json:"warning"`
+	Critical        *float64 `json:"critical"`
+	Enabled         *bool    `json:"enabled"` // defaults to true
+	CooldownMinutes int      `json:"cooldownMinutes"`
+}
+
+// validateThreshold checks that the levels make sense for the rule's condition
+func validateThreshold(rule alerts.Rule, req AlertThresholdRequest) validation.Errors {
+	errs := validation.Errors{}
+	if rule.Condition != alerts.ConditionEvent {
+		if req.Warning == nil && req.Critical == nil {
+			errs.Add("warning", "warning or critical is required")
+		}
+		if req.Warning != nil && req.Critical != nil {
+			if rule.Condition == alerts.ConditionBelow && *req.Critical >= *req.Warning {
+				errs.Add("critical", "must be below warning")
+			} else if rule.Condition != alerts.ConditionBelow && *req.Critical <= *req.Warning {
+				errs.Add("critical", "must be above warning")
+			}
+		}
+	}
+	if req.CooldownMinutes < 0 || req.CooldownMinutes > 7*24*60 {
+		errs.Add("cooldownMinutes", "must be between 0 and 10080")
+	}
+	return errs
+}
+
+// GetPatientAlertThresholds lists the alert rules in effect for a patient
+func GetPatientAlertThresholds(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	rules, err := alerts.RulesForPatient(initializers.DB, patient.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch alert thresholds"})
+		return
+	}
+
+	type ThresholdResponse struct {
+		alerts.Rule
+		CooldownMinutes int `json:"cooldown_minutes"`
+	}
+	thresholds := make([]ThresholdResponse, 0, len(rules))
+	for _, rule := range rules {
+		thresholds = append(thresholds, ThresholdResponse{Rule: rule, CooldownMinutes: int(rule.Cooldown / time.Minute)})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"thresholds": thresholds})
+}
+
+// UpdatePatientAlertThreshold sets the patient's own levels for one alert rule
+func UpdatePatientAlertThreshold(c *gin.Context) {
+	patient, user, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+	if user.Role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only caregivers can change alert thresholds"})
+		return
+	}
+
+	rule, found := alerts.DefaultRule(c.Param("rule"))
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert rule not found"})
+		return
+	}
+
+	var requestBody AlertThresholdRequest
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errs := validateThreshold(rule, requestBody); errs.Any() {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	threshold := models.AlertThreshold{
+		PatientID:       patient.ID,
+		RuleKey:         rule.Key,
+		Warning:         requestBody.Warning,
+		Critical:        requestBody.Critical,
+		Enabled:         requestBody.Enabled == nil || *requestBody.Enabled,
+		CooldownMinutes: requestBody.CooldownMinutes,
+		UpdatedByID:     user.ID,
+	}
+	if err := initializers.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "patient_id"}, {Name: "rule_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"warning", "critical", "enabled", "cooldown_minutes", "updated_by_id", "updated_at", "deleted_at"}),
+	}).Create(&threshold).Error; err != nil {
+		log.Printf("Error saving alert threshold: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save alert threshold"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"threshold": rule.Apply(threshold)})
+}
+
+// DeletePatientAlertThreshold removes the patient's override so the default rule applies again
+func DeletePatientAlertThreshold(c *gin.Context) {
+	patient, user, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+	if user.Role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only caregivers can change alert thresholds"})
+		return
+	}
+
+	if err := initializers.DB.Unscoped().Where("patient_id = ? AND rule_key = ?", patient.ID, c.Param("rule")).
+		Delete(&models.AlertThreshold{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset alert threshold"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": "Alert threshold reset to default"})
+}
+
+// GetPatientAlerts lists a patient's alerts, open ones by default. ?status= takes
+// open (anything not closed), all, or a single status such as false_positive.
+func GetPatientAlerts(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	query := initializers.DB.Where("patient_id = ?", patient.ID)
+	switch status := c.DefaultQuery("status", models.AlertOpen); status {
+	case "all":
+	case models.AlertOpen:
+		query = query.Where("closed_at IS NULL")
+	default:
+		query = query.Where("status = ?", status)
+	}
+
+	var patientAlerts []models.Alert
+	if err := query.Order("last_seen_at DESC").Limit(200).Find(&patientAlerts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch alerts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"alerts": patientAlerts})
+}
+
+type AlertActionRequest struct {
+	Comment    string `json:"comment"`
+	AssigneeID *uint  `json:"assigneeId"` // required when assigning
+}
+
+// bindAlertAction reads the optional body of a status change request
+func bindAlertAction(c *gin.Context) (AlertActionRequest, bool) {
+	var req AlertActionRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return req, false
+		}
+	}
+	errs := validation.Errors{}
+	errs.MaxLength("comment", req.Comment, validation.MaxClinicalTextLength)
+	if errs.Any() {
+		respondValidationErrors(c, errs)
+		return req, false
+	}
+	return req, true
+}
+
+// transitionAlert moves one of the patient's alerts to a new status. Only
+// caregivers can close an alert, like they alone can change its thresholds.
+func transitionAlert(c *gin.Context, to string) {
+	patient, user, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+	if alerts.IsClosed(to) && user.Role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only caregivers can resolve or dismiss alerts"})
+		return
+	}
+	req, ok := bindAlertAction(c)
+	if !ok {
+		return
+	}
+
+	if to == models.AlertAssigned {
+		errs := validation.Errors{}
+		if req.AssigneeID == nil {
+			errs.Add("assigneeId", "is required")
+		} else {
+			caregivers, err := notify.CaregiverIDs(initializers.DB, patient.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch caregivers"})
+				return
+			}
+			if !containsID(caregivers, *req.AssigneeID) {
+				errs.Add("assigneeId", "must be the patient or one of their caregivers")
+			}
+		}
+		if errs.Any() {
+			respondValidationErrors(c, errs)
+			return
+		}
+	}
+
+	var alert models.Alert
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND patient_id = ?", c.Param("alertId"), patient.ID).
+			First(&alert).Error; err != nil {
+			return err
+		}
+		return alerts.Transition(tx, &alert, alerts.Change{
+			To:         to,
+			ActorID:    user.ID,
+			Comment:    req.Comment,
+			AssigneeID: req.AssigneeID,
+		}, time.Now())
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+		return
+	case errors.Is(err, alerts.ErrInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("Error updating alert: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update alert"})
+		return
+	}
+
+	if to == models.AlertAssigned {
+		alerts.NotifyAssigned(initializers.DB, alert)
+	}
+	c.JSON(http.StatusOK, gin.H{"alert": alert})
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// AcknowledgePatientAlert records that someone is looking at an open alert,
+// which stops its escalation
+func AcknowledgePatientAlert(c *gin.Context) {
+	transitionAlert(c, models.AlertAcknowledged)
+}
+
+// AssignPatientAlert hands an alert to a caregiver to follow up
+func AssignPatientAlert(c *gin.Context) {
+	transitionAlert(c, models.AlertAssigned)
+}
+
+// ResolvePatientAlert closes an alert; the rule then stays quiet until its cool-down ends
+func ResolvePatientAlert(c *gin.Context) {
+	transitionAlert(c, models.AlertResolved)
+}
+
+// MarkPatientAlertFalsePositive closes an alert that should not have been
+// raised; these feed the threshold tuning report
+func MarkPatientAlertFalsePositive(c *gin.Context) {
+	transitionAlert(c, models.AlertFalsePositive)
+}
+
+// GetPatientAlertTimeline returns an alert with everything that happened to it, oldest first
+func GetPatientAlertTimeline(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	var alert models.Alert
+	if err := initializers.DB.Where("id = ? AND patient_id = ?", c.Param("alertId"), patient.ID).
+		First(&alert).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+		return
+	}
+
+	var events []models.AlertEvent
+	if err := initializers.DB.Where("alert_id = ?", alert.ID).Order("created_at, id").Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch alert timeline"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"alert": alert, "timeline": events})
+}
+
+// householdAlertFilters narrows the household inbox by the query parameters:
+// status (open, the default, covers every status that is not closed; all, or
+// a single status), severity, patientId, ruleKey, assignedTo (a user ID or
+// "me"), and from/to on when the alert was raised
+func householdAlertFilters(c *gin.Context, query *gorm.DB, admin models.User) (*gorm.DB, validation.Errors) {
+	errs := validation.Errors{}
+
+	switch status := c.DefaultQuery("status", models.AlertOpen); status {
+	case "all":
+	case models.AlertOpen:
+		query = query.Where("alerts.closed_at IS NULL")
+	case models.AlertAcknowledged, models.AlertAssigned, models.AlertResolved, models.AlertFalsePositive:
+		query = query.Where("alerts.status = ?", status)
+	default:
+		errs.Add("status", "must be open, acknowledged, assigned, resolved, false_positive or all")
+	}
+	if severity := c.Query("severity"); severity != "" {
+		if _, ok := models.AlertSeverityRank[severity]; !ok {
+			errs.Add("severity", "must be info, warning or critical")
+		}
+		query = query.Where("alerts.severity = ?", severity)
+	}
+	if patientID := c.Query("patientId"); patientID != "" {
+		query = query.Where("alerts.patient_id = ?", patientID)
+	}
+	if ruleKey := c.Query("ruleKey"); ruleKey != "" {
+		query = query.Where("alerts.rule_key = ?", ruleKey)
+	}
+	switch assignedTo := c.Query("assignedTo"); assignedTo {
+	case "":
+	case "me":
+		query = query.Where("alerts.assigned_to_id = ?", admin.ID)
+	default:
+		query = query.Where("alerts.assigned_to_id = ?", assignedTo)
+	}
+	for _, bound := range []struct{ param, condition string }{
+		{"from", "alerts.created_at >= ?"},
+		{"to", "alerts.created_at < ?"},
+	} {
+		if value := c.Query(bound.param); value != "" {
+			t, err := parseTimeParam(value, time.UTC)
+			if err != nil {
+				errs.Add(bound.param, "must be a date (YYYY-MM-DD) or RFC 3339 time")
+				continue
+			}
+			query = query.Where(bound.condition, t)
+		}
+	}
+	return query, errs
+}
+
+// GetHouseholdAlerts is the admin's alert inbox over every patient in their
+// household, most severe first; see householdAlertFilters for the filters
+func GetHouseholdAlerts(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	patientIDs, err := householdPatientIDs(admin.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch household"})
+		return
+	}
+
+	type HouseholdAlert struct {
+		models.Alert
+		PatientName    string `json:"patient_name"`
+		PatientSurname string `json:"patient_surname"`
+	}
+
+	query := initializers.DB.Model(&models.Alert{}).
+		Select("alerts.*, patients.name AS patient_name, patients.surname AS patient_surname").
+		Joins("JOIN patients ON patients.id = alerts.patient_id").
+		Where("alerts.patient_id IN ?", patientIDs)
+	query, errs := householdAlertFilters(c, query, admin)
+	if errs.Any() {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	inbox := []HouseholdAlert{}
+	if len(patientIDs) > 0 {
+		if err := query.
+			Order("CASE alerts.severity WHEN 'critical' THEN 0 WHEN 'warning' THEN 1 ELSE 2 END, alerts.last_seen_at DESC").
+			Limit(200).
+			Scan(&inbox).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch alerts"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"alerts": inbox})
+}
+
+// MaxBulkAlerts bounds how many alerts one bulk request may change
+const MaxBulkAlerts = 200
+
+type BulkAcknowledgeRequest struct {
+	AlertIDs []uint `json:"alertIds" binding:"required"`
+	Comment  string `json:"comment"`
+}
+
+// BulkAcknowledgeHouseholdAlerts acknowledges several household alerts at once
+// and reports the outcome for each
+func BulkAcknowledgeHouseholdAlerts(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req BulkAcknowledgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	errs := validation.Errors{}
+	if len(req.AlertIDs) == 0 || len(req.AlertIDs) > MaxBulkAlerts {
+		errs.Add("alertIds", fmt.Sprintf("must list between 1 and %d alerts", MaxBulkAlerts))
+	}
+	errs.MaxLength("comment", req.Comment, validation.MaxClinicalTextLength)
+	if errs.Any() {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	patientIDs, err := householdPatientIDs(admin.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch household"})
+		return
+	}
+
+	type BulkResult struct {
+		AlertID uint   `json:"alert_id"`
+		Status  string `json:"status"`
+		Error   string `json:"error,omitempty"`
+	}
+
+	now := time.Now()
+	results := make([]BulkResult, 0, len(req.AlertIDs))
+	acknowledged := 0
+	for _, id := range req.AlertIDs {
+		err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+			var alert models.Alert
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ? AND patient_id IN ?", id, patientIDs).
+				First(&alert).Error; err != nil {
+				return err
+			}
+			return alerts.Transition(tx, &alert, alerts.Change{
+				To:      models.AlertAcknowledged,
+				ActorID: admin.ID,
+				Comment: req.Comment,
+			}, now)
+		})
+		switch {
+		case err == nil:
+			acknowledged++
+			results = append(results, BulkResult{AlertID: id, Status: models.AlertAcknowledged})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			results = append(results, BulkResult{AlertID: id, Status: "failed", Error: "alert not found"})
+		case errors.Is(err, alerts.ErrInvalidTransition):
+			results = append(results, BulkResult{AlertID: id, Status: "failed", Error: err.Error()})
+		default:
+			log.Printf("Error acknowledging alert %d: %v", id, err)
+			results = append(results, BulkResult{AlertID: id, Status: "failed", Error: "failed to acknowledge alert"})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"acknowledged": acknowledged, "results": results})
+}
+
+// reportSince reads the ?days= window of a report
+func reportSince(c *gin.Context, defaultDays int) (time.Time, bool) {
+	days := defaultDays
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 365 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 365"})
+			return time.Time{}, false
+		}
+		days = parsed
+	}
+	return time.Now().AddDate(0, 0, -days), true
+}
+
+// GetHouseholdAlertStats reports mean and median time to acknowledge the
+// household's alerts over the last ?days= (default 30), per severity
+func GetHouseholdAlertStats(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+	since, ok := reportSince(c, 30)
+	if !ok {
+		return
+	}
+
+	patientIDs, err := householdPatientIDs(admin.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch household"})
+		return
+	}
+
+	stats, err := alerts.AcknowledgementTimes(initializers.DB, patientIDs, since)
+	if err != nil {
+		log.Printf("Error computing alert stats: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute alert statistics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"since": since, "stats": stats})
+}
+
+// GetHouseholdAlertTuningReport lists the rules that raised false positives
+// over the last ?days= (default 90), with suggested thresholds
+func GetHouseholdAlertTuningReport(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+	since, ok := reportSince(c, 90)
+	if !ok {
+		return
+	}
+
+	patientIDs, err := householdPatientIDs(admin.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch household"})
+		return
+	}
+
+	report, err := alerts.TuningReport(initializers.DB, patientIDs, since)
+	if err != nil {
+		log.Printf("Error building alert tuning report: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build tuning report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"since": since, "rules": report})
+}
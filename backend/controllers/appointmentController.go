@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"my-health/initializers"
+	"my-health/models"
+)
+
+type AppointmentRequest struct {
+	Provider         string `json:"provider"`
+	Location         string `json:"location"`
+	Type             string `json:"type" binding:"required"`
+	StartTime        string `json:"startTime" binding:"required"` // RFC 3339
+	EndTime          string `json:"endTime"`
+	Status           string `json:"status"`
+	Notes            string `json:"notes"`
+	RecurrenceMonths int    `json:"recurrenceMonths"`
+	ReminderMinutes  []int  `json:"reminderMinutes"`
+}
+
+// applyAppointmentRequest validates the request and copies it onto the appointment
+func applyAppointmentRequest(appointment *models.Appointment, req AppointmentRequest) error {
+	if !models.AppointmentTypes[req.Type] {
+		return fmt.Errorf("invalid appointment type %q", req.Type)
+	}
+
+	start, err := time.Parse(time.RFC3339, req.StartTime)
+	if err != nil {
+		return errors.New("invalid startTime, expected RFC 3339")
+	}
+	end := start.Add(30 * time.Minute)
+	if req.EndTime != "" {
+		end, err = time.Parse(time.RFC3339, req.EndTime)
+		if err != nil {
+			return errors.New("invalid endTime, expected RFC 3339")
+		}
+		if !end.After(start) {
+			return errors.New("endTime must be after startTime")
+		}
+	}
+
+	status := req.Status
+	if status == "" {
+		status = appointment.Status
+	}
+	if status == "" {
+		status = models.AppointmentScheduled
+	}
+	if !models.AppointmentStatuses[status] {
+		return fmt.Errorf("invalid status %q", status)
+	}
+
+	if req.RecurrenceMonths < 0 || req.RecurrenceMonths > 60 {
+		return errors.New("recurrenceMonths must be between 0 and 60")
+	}
+	for _, minutes := range req.ReminderMinutes {
+		if minutes <= 0 || minutes > 7*24*60 {
+			return errors.New("reminderMinutes must be between 1 minute and 7 days")
+		}
+	}
+
+	appointment.Provider = strings.TrimSpace(req.Provider)
+	appointment.Location = strings.TrimSpace(req.Location)
+	appointment.Type = req.Type
+	appointment.StartTime = start
+	appointment.EndTime = end
+	appointment.Status = status
+	appointment.Notes = req.Notes
+	appointment.RecurrenceMonths = req.RecurrenceMonths
+	appointment.ReminderMinutes = req.ReminderMinutes
+	return nil
+}
+
+// scheduleNextOccurrence books the next appointment of a recurring series once
+// the current one is no longer active, unless it already exists
+func scheduleNextOccurrence(tx *gorm.DB, appointment models.Appointment) error {
+	if appointment.RecurrenceMonths == 0 || appointment.IsActive() {
+		return nil
+	}
+
+	seriesID := appointment.SeriesID
+	if seriesID == 0 {
+		seriesID = appointment.ID
+	}
+
+	var count int64
+	if err := tx.Model(&models.Appointment{}).
+		Where("series_id = ? AND start_time > ?", seriesID, appointment.StartTime).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	next := appointment
+	next.Model = gorm.Model{}
+	next.SeriesID = seriesID
+	next.Status = models.AppointmentScheduled
+	next.Notes = ""
+	next.StartTime = appointment.StartTime.AddDate(0, appointment.RecurrenceMonths, 0)
+	next.EndTime = appointment.EndTime.AddDate(0, appointment.RecurrenceMonths, 0)
+	return tx.Create(&next).Error
+}
+
+// GetPatientAppointments lists a patient's appointments, optionally filtered by time range and status
+func GetPatientAppointments(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	query := initializers.DB.Where("patient_id = ?", patient.ID)
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from, expected RFC 3339"})
+			return
+		}
+		query = query.Where("start_time >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to, expected RFC 3339"})
+			return
+		}
+		query = query.Where("start_time < ?", t)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var appointments []models.Appointment
+	if err := query.Order("start_time ASC").Find(&appointments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch appointments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"appointments": appointments})
+}
+
+// CreatePatientAppointment books a new appointment for a patient
+func CreatePatientAppointment(c *gin.Context) {
+	patient, user, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	var requestBody AppointmentRequest
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	appointment := models.Appointment{PatientID: patient.ID, CreatedByID: user.ID}
+	if err := applyAppointmentRequest(&appointment, requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&appointment).Error; err != nil {
+			return err
+		}
+		if appointment.RecurrenceMonths > 0 {
+			appointment.SeriesID = appointment.ID
+			if err := tx.Model(&appointment).Update("series_id", appointment.ID).Error; err != nil {
+				return err
+			}
+		}
+		return scheduleNextOccurrence(tx, appointment)
+	})
+	if err != nil {
+		log.Printf("Error creating appointment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create appointment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"appointment": appointment})
+}
+
+// UpdatePatientAppointment changes an appointment, e.g. to reschedule it or mark it completed
+func UpdatePatientAppointment(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	var appointment models.Appointment
+	if err := initializers.DB.Where("id = ? AND patient_id = ?", c.Param("appointmentId"), patient.ID).
+		First(&appointment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return
+	}
+
+	var requestBody AppointmentRequest
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	previousStart := appointment.StartTime
+	if err := applyAppointmentRequest(&appointment, requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	startChanged := !appointment.StartTime.Equal(previousStart)
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&appointment).Error; err != nil {
+			return err
+		}
+		// A rescheduled appointment needs its reminders sent again
+		if startChanged {
+			if err := tx.Unscoped().Where("appointment_id = ?", appointment.ID).
+				Delete(&models.AppointmentReminder{}).Error; err != nil {
+				return err
+			}
+		}
+		return scheduleNextOccurrence(tx, appointment)
+	})
+	if err != nil {
+		log.Printf("Error updating appointment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update appointment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"appointment": appointment})
+}
+
+// DeletePatientAppointment removes an appointment that was entered by mistake
+func DeletePatientAppointment(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	result := initializers.DB.Where("id = ? AND patient_id = ?", c.Param("appointmentId"), patient.ID).
+		Delete(&models.Appointment{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete appointment"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": "Appointment deleted"})
+}
+
+// GetHouseholdUpcomingAppointments lists upcoming appointments of every patient in the admin's household
+func GetHouseholdUpcomingAppointments(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	days := 30
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 365 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 365"})
+			return
+		}
+		days = parsed
+	}
+
+	patientIDs, err := householdPatientIDs(admin.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch household"})
+		return
+	}
+
+	type UpcomingAppointment struct {
+		models.Appointment
+		PatientName    string `json:"patient_name"`
+		PatientSurname string `json:"patient_surname"`
+	}
+
+	upcoming := []UpcomingAppointment{}
+	if len(patientIDs) > 0 {
+		now := time.Now()
+		if err := initializers.DB.Model(&models.Appointment{}).
+			Select("appointments.*, patients.name AS patient_name, patients.surname AS patient_surname").
+			Joins("JOIN patients ON patients.id = appointments.patient_id").
+			Where("appointments.patient_id IN ? AND appointments.status IN ?", patientIDs,
+				[]string{models.AppointmentScheduled, models.AppointmentConfirmed}).
+			Where("appointments.start_time >= ? AND appointments.start_time < ?", now, now.AddDate(0, 0, days)).
+			Order("appointments.start_time ASC").
+			Scan(&upcoming).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch appointments"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"appointments": upcoming})
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"my-health/initializers"
+	"my-health/models"
+	"my-health/services/baseline"
+)
+
+// GetPatientBaselines returns the patient's usual level of each vital, computed
+// from their own readings. Baselines with fewer readings than the detector
+// needs are returned but marked inactive.
+func GetPatientBaselines(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	var stored []models.MetricBaseline
+	if err := initializers.DB.Where("patient_id = ?", patient.ID).Find(&stored).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch baselines"})
+		return
+	}
+	byMetric := make(map[string]models.MetricBaseline, len(stored))
+	for _, b := range stored {
+		byMetric[b.Metric] = b
+	}
+
+	type BaselineResponse struct {
+		models.MetricBaseline
+		Unit      string  `json:"unit"`
+		UsualLow  float64 `json:"usual_low"`
+		UsualHigh float64 `json:"usual_high"`
+		Active    bool    `json:"active"`
+	}
+
+	now := time.Now()
+	baselines := make([]BaselineResponse, 0, len(baseline.Metrics))
+	for _, metric := range baseline.Metrics {
+		b, found := byMetric[metric]
+		if !found {
+			// Readings stored before baselines existed are summarised on first use
+			var err error
+			if b, err = baseline.Refresh(initializers.DB, patient.ID, metric, now); err != nil {
+				log.Printf("Error computing %s baseline: %v", metric, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute baselines"})
+				return
+			}
+		}
+		stats := baseline.Stats{Median: b.Median, MAD: b.MAD, Samples: b.Samples}
+		low, high := baseline.UsualRange(metric, stats)
+		baselines = append(baselines, BaselineResponse{
+			MetricBaseline: b,
+			Unit:           models.MetricUnits[metric],
+			UsualLow:       low,
+			UsualHigh:      high,
+			Active:         b.Samples >= baseline.DefaultConfig.MinSamples,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"baselines": baselines})
+}
+
+// GetPatientDeviations lists the readings of the last ?days= (default 30) that
+// were unusual for the patient, newest first; ?metric= narrows it to one metric
+func GetPatientDeviations(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+	since, ok := reportSince(c, 30)
+	if !ok {
+		return
+	}
+
+	query := initializers.DB.Where("patient_id = ? AND effective_at >= ?", patient.ID, since)
+	if metric := c.Query("metric"); metric != "" {
+		query = query.Where("metric = ?", metric)
+	}
+
+	var flags []models.DeviationFlag
+	if err := query.Order("effective_at DESC").Limit(500).Find(&flags).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deviations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deviations": flags})
+}
@@ -0,0 +1,368 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"my-health/initializers"
+	"my-health/models"
+)
+
+type CareNoteRequest struct {
+	Category      string `json:"category" binding:"required"`
+	Body          string `json:"body" binding:"required"`
+	ObservedAt    string `json:"observedAt"` // RFC 3339, defaults to now
+	ObservationID *uint  `json:"observationId"`
+	// HealthMetricsID is the link older clients send; it is resolved to an observation
+	HealthMetricsID *uint `json:"healthMetricsId"`
+}
+
+// CareNoteSearchResult is a care note matched by a full-text search
+type CareNoteSearchResult struct {
+	models.CareNote
+	PatientName    string  `json:"patient_name"`
+	PatientSurname string  `json:"patient_surname"`
+	Rank           float64 `json:"rank"`
+	Headline       string  `json:"headline"`
+}
+
+// legacyCareNoteObservation resolves the healthMetricsId of an older client to
+// an observation of the patient: first one converted from that health_metrics
+// row, then one with that ID, which the compatibility projection hands out as
+// the reading's ID
+func legacyCareNoteObservation(patientID, healthMetricsID uint) (uint, error) {
+	var observation models.Observation
+	err := initializers.DB.Where("patient_id = ? AND legacy_metrics_id = ?", patientID, healthMetricsID).
+		Order("id").Limit(1).Find(&observation).Error
+	if err != nil || observation.ID != 0 {
+		return observation.ID, err
+	}
+	err = initializers.DB.Where("patient_id = ? AND id = ?", patientID, healthMetricsID).
+		Limit(1).Find(&observation).Error
+	return observation.ID, err
+}
+
+// validateCareNoteRequest checks the request, resolves a legacy healthMetricsId
+// into req.ObservationID and returns the observation time
+func validateCareNoteRequest(c *gin.Context, patientID uint, req *CareNoteRequest) (time.Time, bool) {
+	if !models.CareNoteCategories[req.Category] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category"})
+		return time.Time{}, false
+	}
+	if strings.TrimSpace(req.Body) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "body is required"})
+		return time.Time{}, false
+	}
+
+	observedAt := time.Now()
+	if req.ObservedAt != "" {
+		var err error
+		observedAt, err = time.Parse(time.RFC3339, req.ObservedAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid observedAt, expected RFC 3339"})
+			return time.Time{}, false
+		}
+	}
+
+	if req.HealthMetricsID != nil {
+		id, err := legacyCareNoteObservation(patientID, *req.HealthMetricsID)
+		if err != nil {
+			log.Printf("Error resolving health metrics %d: %v", *req.HealthMetricsID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve healthMetricsId"})
+			return time.Time{}, false
+		}
+		if id == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Health metrics not found for this patient"})
+			return time.Time{}, false
+		}
+		if req.ObservationID != nil && *req.ObservationID != id {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "healthMetricsId and observationId refer to different readings"})
+			return time.Time{}, false
+		}
+		req.ObservationID = &id
+	}
+
+	// A linked reading must belong to the same patient
+	if req.ObservationID != nil {
+		var count int64
+		initializers.DB.Model(&models.Observation{}).
+			Where("id = ? AND patient_id = ?", *req.ObservationID, patientID).
+			Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Observation not found for this patient"})
+			return time.Time{}, false
+		}
+	}
+
+	return observedAt, true
+}
+
+// searchCareNotes runs a ranked full-text search over the notes of the given patients
+func searchCareNotes(patientIDs []uint, q string, limit int) ([]CareNoteSearchResult, error) {
+	results := []CareNoteSearchResult{}
+	if len(patientIDs) == 0 {
+		return results, nil
+	}
+
+	err := initializers.DB.Model(&models.CareNote{}).
+		Select(`care_notes.*, patients.name AS patient_name, patients.surname AS patient_surname,
+			ts_rank(care_notes.search_vector, websearch_to_tsquery('english', ?)) AS rank,
+			ts_headline('english', care_notes.body, websearch_to_tsquery('english', ?), 'MaxFragments=2') AS headline`, q, q).
+		Joins("JOIN patients ON patients.id = care_notes.patient_id").
+		Where("care_notes.patient_id IN ?", patientIDs).
+		Where("care_notes.search_vector @@ websearch_to_tsquery('english', ?)", q).
+		Order("rank DESC, care_notes.observed_at DESC").
+		Limit(limit).
+		Scan(&results).Error
+	return results, err
+}
+
+func searchLimit(c *gin.Context) int {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		return 50
+	}
+	return limit
+}
+
+// GetPatientCareNotes lists a patient's care notes, pinned ones first. With q set it runs a ranked search instead.
+func GetPatientCareNotes(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		results, err := searchCareNotes([]uint{patient.ID}, q, searchLimit(c))
+		if err != nil {
+			log.Printf("Error searching care notes: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search care notes"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"notes": results})
+		return
+	}
+
+	query := initializers.DB.Where("patient_id = ?", patient.ID)
+	if category := c.Query("category"); category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if c.Query("pinned") == "true" {
+		query = query.Where("pinned = ?", true)
+	}
+
+	var notes []models.CareNote
+	if err := query.Preload("Observation").
+		Order("pinned DESC, observed_at DESC").
+		Find(&notes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch care notes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notes": notes})
+}
+
+// CreatePatientCareNote adds a note to the patient's journal, authored by the current user
+func CreatePatientCareNote(c *gin.Context) {
+	patient, user, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	var requestBody CareNoteRequest
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	observedAt, ok := validateCareNoteRequest(c, patient.ID, &requestBody)
+	if !ok {
+		return
+	}
+
+	note := models.CareNote{
+		PatientID:     patient.ID,
+		AuthorID:      user.ID,
+		Category:      requestBody.Category,
+		Body:          strings.TrimSpace(requestBody.Body),
+		ObservedAt:    observedAt,
+		ObservationID: requestBody.ObservationID,
+	}
+	if err := initializers.DB.Create(&note).Error; err != nil {
+		log.Printf("Error creating care note: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create care note"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"note": note})
+}
+
+// findPatientCareNote loads a care note of an authorized patient from the URL parameters
+func findPatientCareNote(c *gin.Context) (models.CareNote, models.User, bool) {
+	patient, user, ok := authorizedPatient(c, "id")
+	if !ok {
+		return models.CareNote{}, user, false
+	}
+
+	var note models.CareNote
+	if err := initializers.DB.Where("id = ? AND patient_id = ?", c.Param("noteId"), patient.ID).
+		First(&note).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Care note not found"})
+		return models.CareNote{}, user, false
+	}
+	return note, user, true
+}
+
+// UpdatePatientCareNote edits a note; only its author may do so and the previous version is kept
+func UpdatePatientCareNote(c *gin.Context) {
+	note, user, ok := findPatientCareNote(c)
+	if !ok {
+		return
+	}
+	if note.AuthorID != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the author can edit a care note"})
+		return
+	}
+
+	var requestBody CareNoteRequest
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	observedAt, ok := validateCareNoteRequest(c, note.PatientID, &requestBody)
+	if !ok {
+		return
+	}
+
+	revision := models.CareNoteRevision{
+		CareNoteID: note.ID,
+		EditorID:   user.ID,
+		Category:   note.Category,
+		Body:       note.Body,
+	}
+
+	now := time.Now()
+	note.Category = requestBody.Category
+	note.Body = strings.TrimSpace(requestBody.Body)
+	note.ObservedAt = observedAt
+	note.ObservationID = requestBody.ObservationID
+	note.EditedAt = &now
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&revision).Error; err != nil {
+			return err
+		}
+		return tx.Save(&note).Error
+	})
+	if err != nil {
+		log.Printf("Error updating care note: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update care note"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"note": note})
+}
+
+// PinPatientCareNote pins or unpins a note so it stays at the top of the journal
+func PinPatientCareNote(c *gin.Context) {
+	note, _, ok := findPatientCareNote(c)
+	if !ok {
+		return
+	}
+
+	var requestBody struct {
+		Pinned bool `json:"pinned"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var pinnedAt *time.Time
+	if requestBody.Pinned {
+		now := time.Now()
+		pinnedAt = &now
+	}
+	if err := initializers.DB.Model(&note).Updates(map[string]interface{}{
+		"pinned":    requestBody.Pinned,
+		"pinned_at": pinnedAt,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update care note"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"note": note})
+}
+
+// GetPatientCareNoteHistory returns the previous versions of a note, newest first
+func GetPatientCareNoteHistory(c *gin.Context) {
+	note, _, ok := findPatientCareNote(c)
+	if !ok {
+		return
+	}
+
+	var revisions []models.CareNoteRevision
+	if err := initializers.DB.Where("care_note_id = ?", note.ID).
+		Order("created_at DESC").
+		Find(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch care note history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"note": note, "revisions": revisions})
+}
+
+// DeletePatientCareNote removes a note; only its author may do so
+func DeletePatientCareNote(c *gin.Context) {
+	note, user, ok := findPatientCareNote(c)
+	if !ok {
+		return
+	}
+	if note.AuthorID != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the author can delete a care note"})
+		return
+	}
+
+	if err := initializers.DB.Delete(&note).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete care note"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": "Care note deleted"})
+}
+
+// SearchHouseholdCareNotes runs a ranked full-text search over the notes of every patient in the admin's household
+func SearchHouseholdCareNotes(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+
+	patientIDs, err := householdPatientIDs(admin.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch household"})
+		return
+	}
+
+	results, err := searchCareNotes(patientIDs, q, searchLimit(c))
+	if err != nil {
+		log.Printf("Error searching care notes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search care notes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notes": results})
+}
@@ -0,0 +1,269 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"my-health/initializers"
+	"my-health/models"
+	"my-health/services/careplan"
+	"my-health/services/observations"
+	"my-health/validation"
+)
+
+type CareGoalRequest struct {
+	Metric      string  `json:"metric"`
+	Comparator  string  `json:"comparator"`
+	Target      float64 `json:"target"`
+	TargetMax   float64 `json:"targetMax"`
+	Description string  `json:"description"`
+	StartDate   string  `json:"startDate"`  // YYYY-MM-DD, defaults to today
+	ReviewDate  string  `json:"reviewDate"` // YYYY-MM-DD
+	OwnerID     uint    `json:"ownerId"`    // defaults to the plan author
+}
+
+type CarePlanRequest struct {
+	Title string            `json:"title"`
+	Notes string            `json:"notes"`
+	Goals []CareGoalRequest `json:"goals"`
+}
+
+// buildCareGoals validates the requested goals for a patient
+func buildCareGoals(patient models.Patient, author models.User, requests []CareGoalRequest) ([]models.CareGoal, validation.Errors) {
+	errs := validation.Errors{}
+	today := careplan.StartOfDay(time.Now())
+
+	goals := make([]models.CareGoal, 0, len(requests))
+	for i, req := range requests {
+		field := fmt.Sprintf("goals[%d]", i)
+
+		if _, ok := models.MetricUnits[req.Metric]; !ok {
+			errs.Add(field+".metric", "unknown metric")
+		}
+		switch req.Comparator {
+		case models.GoalAtLeast, models.GoalAtMost:
+		case models.GoalBetween:
+			if req.TargetMax <= req.Target {
+				errs.Add(field+".targetMax", "must be greater than target")
+			}
+		default:
+			errs.Add(field+".comparator", "must be one of at_least, at_most, between")
+		}
+
+		startDate := today
+		if req.StartDate != "" {
+			parsed, err := time.ParseInLocation("2006-01-02", req.StartDate, time.Local)
+			if err != nil {
+				errs.Add(field+".startDate", "must be a date in YYYY-MM-DD format")
+			}
+			startDate = parsed
+		}
+		var reviewDate time.Time
+		if req.ReviewDate != "" {
+			parsed, err := time.ParseInLocation("2006-01-02", req.ReviewDate, time.Local)
+			if err != nil {
+				errs.Add(field+".reviewDate", "must be a date in YYYY-MM-DD format")
+			} else if !parsed.After(startDate) {
+				errs.Add(field+".reviewDate", "must be after startDate")
+			}
+			reviewDate = parsed
+		}
+
+		ownerID := req.OwnerID
+		if ownerID == 0 {
+			ownerID = author.ID
+		} else if ownerID != author.ID {
+			var owner models.User
+			if err := initializers.DB.First(&owner, ownerID).Error; err != nil || !canAccessPatient(owner, patient) {
+				errs.Add(field+".ownerId", "must be the patient or one of their caregivers")
+			}
+		}
+
+		goals = append(goals, models.CareGoal{
+			Metric:      req.Metric,
+			Comparator:  req.Comparator,
+			Target:      req.Target,
+			TargetMax:   req.TargetMax,
+			Description: req.Description,
+			StartDate:   startDate,
+			ReviewDate:  reviewDate,
+			OwnerID:     ownerID,
+		})
+	}
+	return goals, errs
+}
+
+// activeCarePlan loads the patient's current care plan with its goals
+func activeCarePlan(patientID uint) (models.CarePlan, error) {
+	var plan models.CarePlan
+	err := initializers.DB.Preload("Goals").
+		Where("patient_id = ? AND status = ?", patientID, models.CarePlanActive).
+		Order("version DESC").
+		First(&plan).Error
+	return plan, err
+}
+
+// GetPatientCarePlan returns the patient's current care plan
+func GetPatientCarePlan(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	plan, err := activeCarePlan(patient.ID)
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient has no care plan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch care plan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"care_plan": plan})
+}
+
+// GetPatientCarePlanVersions lists every version of the patient's care plan, newest first
+func GetPatientCarePlanVersions(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	query := initializers.DB.Preload("Goals").Where("patient_id = ?", patient.ID)
+	if version := c.Query("version"); version != "" {
+		query = query.Where("version = ?", version)
+	}
+
+	var plans []models.CarePlan
+	if err := query.Order("version DESC").Find(&plans).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch care plans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"care_plans": plans})
+}
+
+// CreatePatientCarePlan stores a new version of the patient's care plan and supersedes the current one
+func CreatePatientCarePlan(c *gin.Context) {
+	patient, user, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+	if user.Role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only caregivers can change care plans"})
+		return
+	}
+
+	var requestBody CarePlanRequest
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	errs := validation.Errors{}
+	errs.MaxLength("title", requestBody.Title, validation.MaxNameLength)
+	errs.MaxLength("notes", requestBody.Notes, validation.MaxClinicalTextLength)
+	if len(requestBody.Goals) == 0 {
+		errs.Add("goals", "at least one goal is required")
+	}
+	goals, goalErrs := buildCareGoals(patient, user, requestBody.Goals)
+	for field, message := range goalErrs {
+		errs.Add(field, message)
+	}
+	if errs.Any() {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	plan := models.CarePlan{
+		PatientID:   patient.ID,
+		Status:      models.CarePlanActive,
+		Title:       requestBody.Title,
+		Notes:       requestBody.Notes,
+		CreatedByID: user.ID,
+		Goals:       goals,
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var latest int
+		if err := tx.Model(&models.CarePlan{}).Unscoped().
+			Where("patient_id = ?", patient.ID).
+			Select("COALESCE(MAX(version), 0)").
+			Scan(&latest).Error; err != nil {
+			return err
+		}
+		plan.Version = latest + 1
+
+		now := time.Now()
+		if err := tx.Model(&models.CarePlan{}).
+			Where("patient_id = ? AND status = ?", patient.ID, models.CarePlanActive).
+			Updates(map[string]interface{}{"status": models.CarePlanSuperseded, "superseded_at": now}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&plan).Error
+	})
+	if err != nil {
+		log.Printf("Error creating care plan: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create care plan"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"care_plan": plan})
+}
+
+// GetPatientCarePlanProgress evaluates each goal of the current plan against the patient's
+// health metrics over the last `days` days (default 30)
+func GetPatientCarePlanProgress(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	days := 30
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 365 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 365"})
+			return
+		}
+		days = parsed
+	}
+
+	plan, err := activeCarePlan(patient.ID)
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient has no care plan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch care plan"})
+		return
+	}
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -days+1)
+	metrics, err := observations.Load(initializers.DB, patient.ID, careplan.StartOfDay(from), to.Add(time.Minute))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving metrics"})
+		return
+	}
+
+	progress := make([]careplan.GoalProgress, 0, len(plan.Goals))
+	for _, goal := range plan.Goals {
+		progress = append(progress, careplan.Evaluate(goal, metrics, from, to))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"care_plan_id": plan.ID,
+		"version":      plan.Version,
+		"from":         from.Format("2006-01-02"),
+		"to":           to.Format("2006-01-02"),
+		"goals":        progress,
+	})
+}
@@ -0,0 +1,313 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"my-health/initializers"
+	"my-health/models"
+	"my-health/validation"
+)
+
+type PatientContactRequest struct {
+	Name             string                `json:"name" binding:"required"`
+	Relationship     string                `json:"relationship"`
+	PhoneNumbers     []models.ContactPhone `json:"phoneNumbers"`
+	Emails           []string              `json:"emails"`
+	PreferredChannel string                `json:"preferredChannel"`
+	AvailableFrom    string                `json:"availableFrom"`
+	AvailableTo      string                `json:"availableTo"`
+	ReceiveAlerts    bool                  `json:"receiveAlerts"`
+}
+
+// applyContactRequest validates the request and copies it onto the contact,
+// normalising phone numbers to E.164 on the way
+func applyContactRequest(contact *models.PatientContact, req PatientContactRequest) validation.Errors {
+	errs := validation.Errors{}
+
+	name := strings.TrimSpace(req.Name)
+	errs.Required("name", name)
+	errs.MaxLength("name", name, validation.MaxNameLength)
+	errs.MaxLength("relationship", req.Relationship, validation.MaxRelationshipLength)
+
+	phones := make([]models.ContactPhone, 0, len(req.PhoneNumbers))
+	for i, phone := range req.PhoneNumbers {
+		field := fmt.Sprintf("phoneNumbers[%d].number", i)
+		errs.Required(field, phone.Number)
+		number := errs.Phone(field, phone.Number)
+		phones = append(phones, models.ContactPhone{Label: strings.TrimSpace(phone.Label), Number: number})
+	}
+
+	emails := make([]string, 0, len(req.Emails))
+	for i, email := range req.Emails {
+		address, err := mail.ParseAddress(strings.TrimSpace(email))
+		if err != nil {
+			errs.Add(fmt.Sprintf("emails[%d]", i), "must be a valid email address")
+			continue
+		}
+		emails = append(emails, strings.ToLower(address.Address))
+	}
+
+	channel := req.PreferredChannel
+	if channel == "" {
+		channel = models.ContactChannelPhone
+	}
+	switch channel {
+	case models.ContactChannelPhone, models.ContactChannelSMS:
+		if len(phones) == 0 {
+			errs.Add("preferredChannel", fmt.Sprintf("%q requires a phone number", channel))
+		}
+	case models.ContactChannelEmail:
+		if len(emails) == 0 {
+			errs.Add("preferredChannel", "\"email\" requires an email address")
+		}
+	default:
+		errs.Add("preferredChannel", "must be one of phone, sms, email")
+	}
+
+	if (req.AvailableFrom == "") != (req.AvailableTo == "") {
+		errs.Add("availableTo", "availableFrom and availableTo must be set together")
+	}
+	for field, value := range map[string]string{"availableFrom": req.AvailableFrom, "availableTo": req.AvailableTo} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse("15:04", value); err != nil {
+			errs.Add(field, "must be a time in HH:MM format")
+		}
+	}
+
+	if errs.Any() {
+		return errs
+	}
+
+	contact.Name = name
+	contact.Relationship = strings.TrimSpace(req.Relationship)
+	contact.PhoneNumbers = phones
+	contact.Emails = emails
+	contact.PreferredChannel = channel
+	contact.AvailableFrom = req.AvailableFrom
+	contact.AvailableTo = req.AvailableTo
+	contact.ReceiveAlerts = req.ReceiveAlerts
+	return nil
+}
+
+// syncLegacyEmergencyContact mirrors the highest-priority contact into the
+// single emergency contact embedded in the patient record
+func syncLegacyEmergencyContact(tx *gorm.DB, patientID uint) error {
+	var patient models.Patient
+	if err := tx.First(&patient, patientID).Error; err != nil {
+		return err
+	}
+
+	var primary models.PatientContact
+	err := tx.Where("patient_id = ?", patientID).Order("priority ASC, id ASC").First(&primary).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	patient.EmergencyContact = models.EmergencyContact{
+		Name:         primary.Name,
+		Relationship: primary.Relationship,
+		PhoneNumber:  primary.PrimaryPhone(),
+	}
+	return tx.Save(&patient).Error
+}
+
+// GetPatientContacts lists a patient's emergency contacts in priority order
+func GetPatientContacts(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	var contacts []models.PatientContact
+	if err := initializers.DB.Where("patient_id = ?", patient.ID).
+		Order("priority ASC, id ASC").
+		Find(&contacts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch contacts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"contacts": contacts})
+}
+
+// CreatePatientContact appends a new contact to the end of the patient's list
+func CreatePatientContact(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	var requestBody PatientContactRequest
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	contact := models.PatientContact{PatientID: patient.ID}
+	if errs := applyContactRequest(&contact, requestBody); errs.Any() {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var maxPriority *int
+		if err := tx.Model(&models.PatientContact{}).
+			Where("patient_id = ?", patient.ID).
+			Select("MAX(priority)").
+			Scan(&maxPriority).Error; err != nil {
+			return err
+		}
+		if maxPriority != nil {
+			contact.Priority = *maxPriority + 1
+		}
+
+		if err := tx.Create(&contact).Error; err != nil {
+			return err
+		}
+		return syncLegacyEmergencyContact(tx, patient.ID)
+	})
+	if err != nil {
+		log.Printf("Error creating contact: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create contact"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"contact": contact})
+}
+
+// UpdatePatientContact replaces the details of an existing contact
+func UpdatePatientContact(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	var contact models.PatientContact
+	if err := initializers.DB.Where("id = ? AND patient_id = ?", c.Param("contactId"), patient.ID).
+		First(&contact).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Contact not found"})
+		return
+	}
+
+	var requestBody PatientContactRequest
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if errs := applyContactRequest(&contact, requestBody); errs.Any() {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&contact).Error; err != nil {
+			return err
+		}
+		return syncLegacyEmergencyContact(tx, patient.ID)
+	})
+	if err != nil {
+		log.Printf("Error updating contact: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update contact"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"contact": contact})
+}
+
+// DeletePatientContact removes a contact from the patient's list
+func DeletePatientContact(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND patient_id = ?", c.Param("contactId"), patient.ID).
+			Delete(&models.PatientContact{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return syncLegacyEmergencyContact(tx, patient.ID)
+	})
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Contact not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting contact: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete contact"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": "Contact deleted"})
+}
+
+// ReorderPatientContacts sets contact priorities from the order of the given IDs
+func ReorderPatientContacts(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	var requestBody struct {
+		ContactIDs []uint `json:"contactIds" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var contacts []models.PatientContact
+	if err := initializers.DB.Where("patient_id = ?", patient.ID).Find(&contacts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch contacts"})
+		return
+	}
+
+	// The new order must name every contact of the patient exactly once
+	known := make(map[uint]bool, len(contacts))
+	for _, contact := range contacts {
+		known[contact.ID] = true
+	}
+	if len(requestBody.ContactIDs) != len(contacts) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "contactIds must list every contact of the patient"})
+		return
+	}
+	for _, id := range requestBody.ContactIDs {
+		if !known[id] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown or duplicate contact id %d", id)})
+			return
+		}
+		delete(known, id)
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		for priority, id := range requestBody.ContactIDs {
+			if err := tx.Model(&models.PatientContact{}).
+				Where("id = ? AND patient_id = ?", id, patient.ID).
+				Update("priority", priority).Error; err != nil {
+				return err
+			}
+		}
+		return syncLegacyEmergencyContact(tx, patient.ID)
+	})
+	if err != nil {
+		log.Printf("Error reordering contacts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder contacts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": "Contacts reordered"})
+}
@@ -0,0 +1,263 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"my-health/initializers"
+	"my-health/models"
+)
+
+const defaultMaxDocumentBytes = 20 << 20 // 20 MB
+
+// allowedDocumentTypes lists the content types accepted for uploads, keyed by
+// the type sniffed from the file contents rather than the client's claim
+var allowedDocumentTypes = map[string]bool{
+	"application/pdf": true,
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/webp":      true,
+	"text/plain":      true,
+}
+
+func maxDocumentBytes() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("DOCUMENT_MAX_BYTES"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return defaultMaxDocumentBytes
+}
+
+func parseTags(raw []string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, value := range raw {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			if tag != "" && !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+func newStorageKey(patientID uint) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("patients/%d/documents/%s", patientID, hex.EncodeToString(b)), nil
+}
+
+// UploadPatientDocument accepts a multipart upload with a "file" part and the document metadata
+func UploadPatientDocument(c *gin.Context) {
+	patient, user, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	maxBytes := maxDocumentBytes()
+	// Leave some room for the other form fields
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+1<<20)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	if fileHeader.Size > maxBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("file exceeds the %d byte limit", maxBytes)})
+		return
+	}
+	if fileHeader.Size == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is empty"})
+		return
+	}
+
+	docType := c.PostForm("type")
+	if !models.DocumentTypes[docType] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document type"})
+		return
+	}
+
+	documentDate := time.Now()
+	if value := c.PostForm("date"); value != "" {
+		documentDate, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format, expected YYYY-MM-DD"})
+			return
+		}
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	// Sniff the real content type from the first bytes of the file
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	contentType := strings.Split(http.DetectContentType(head[:n]), ";")[0]
+	if !allowedDocumentTypes[contentType] {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": fmt.Sprintf("content type %s is not allowed", contentType)})
+		return
+	}
+
+	// Checksum the whole file, then rewind it for the upload
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	key, err := newStorageKey(patient.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store document"})
+		return
+	}
+	if err := initializers.Blobs.Put(c.Request.Context(), key, file, fileHeader.Size, contentType); err != nil {
+		log.Printf("Error storing document blob: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store document"})
+		return
+	}
+
+	document := models.MedicalDocument{
+		PatientID:    patient.ID,
+		UploadedByID: user.ID,
+		Type:         docType,
+		DocumentDate: documentDate,
+		FileName:     filepath.Base(fileHeader.Filename),
+		Description:  c.PostForm("description"),
+		Tags:         parseTags(c.PostFormArray("tags")),
+		ContentType:  contentType,
+		SizeBytes:    fileHeader.Size,
+		SHA256:       hex.EncodeToString(hash.Sum(nil)),
+		StorageKey:   key,
+	}
+	if err := initializers.DB.Create(&document).Error; err != nil {
+		log.Printf("Error saving document: %v", err)
+		// Don't leave an orphaned blob behind
+		if err := initializers.Blobs.Delete(c.Request.Context(), key); err != nil {
+			log.Printf("Error removing orphaned blob %s: %v", key, err)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save document"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"document": document})
+}
+
+// GetPatientDocuments lists document metadata, optionally filtered by type and tag
+func GetPatientDocuments(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	query := initializers.DB.Where("patient_id = ?", patient.ID)
+	if docType := c.Query("type"); docType != "" {
+		query = query.Where("type = ?", docType)
+	}
+	if tag := c.Query("tag"); tag != "" {
+		query = query.Where("tags @> ?", fmt.Sprintf("[%q]", strings.ToLower(tag)))
+	}
+
+	var documents []models.MedicalDocument
+	if err := query.Order("document_date DESC, id DESC").Find(&documents).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch documents"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"documents": documents})
+}
+
+// findPatientDocument loads a document of an authorized patient from the URL parameters
+func findPatientDocument(c *gin.Context) (models.MedicalDocument, bool) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return models.MedicalDocument{}, false
+	}
+
+	var document models.MedicalDocument
+	if err := initializers.DB.Where("id = ? AND patient_id = ?", c.Param("documentId"), patient.ID).
+		First(&document).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return models.MedicalDocument{}, false
+	}
+	return document, true
+}
+
+// GetPatientDocument returns the metadata of a single document
+func GetPatientDocument(c *gin.Context) {
+	document, ok := findPatientDocument(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"document": document})
+}
+
+// DownloadPatientDocument streams the stored file to the client
+func DownloadPatientDocument(c *gin.Context) {
+	document, ok := findPatientDocument(c)
+	if !ok {
+		return
+	}
+
+	blob, err := initializers.Blobs.Get(c.Request.Context(), document.StorageKey)
+	if err != nil {
+		log.Printf("Error reading document blob %s: %v", document.StorageKey, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read document"})
+		return
+	}
+	defer blob.Close()
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", document.FileName))
+	c.Header("X-Content-SHA256", document.SHA256)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.DataFromReader(http.StatusOK, document.SizeBytes, document.ContentType, blob, nil)
+}
+
+// DeletePatientDocument removes a document and its stored file
+func DeletePatientDocument(c *gin.Context) {
+	document, ok := findPatientDocument(c)
+	if !ok {
+		return
+	}
+
+	if err := initializers.DB.Delete(&document).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete document"})
+		return
+	}
+	if err := initializers.Blobs.Delete(c.Request.Context(), document.StorageKey); err != nil {
+		log.Printf("Error deleting document blob %s: %v", document.StorageKey, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": "Document deleted"})
+}
@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"my-health/initializers"
+	"my-health/models"
+	"my-health/validation"
+)
+
+// MaxEscalationSteps bounds the length of an escalation policy
+const MaxEscalationSteps = 10
+
+type EscalationStepRequest struct {
+	Target         string `json:"target"`
+	UserID         *uint  `json:"userId"`
+	Channel        string `json:"channel"`
+	TimeoutMinutes int    `json:"timeoutMinutes"`
+}
+
+type EscalationPolicyRequest struct {
+	MinSeverity string                  `json:"minSeverity"` // defaults to warning
+	Steps       []EscalationStepRequest `json:"steps"`
+}
+
+// adminHousehold returns the current admin's household. On failure the response has already been written.
+func adminHousehold(c *gin.Context) (models.Household, models.User, bool) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return models.Household{}, admin, false
+	}
+
+	var household models.Household
+	if err := initializers.DB.Where("admin_id = ?", admin.ID).First(&household).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "household not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch household"})
+		}
+		return household, admin, false
+	}
+	return household, admin, true
+}
+
+// householdCaregiverIDs returns the users an escalation step may notify: the
+// household admin and the users of the household's patients
+func householdCaregiverIDs(household models.Household) (map[uint]bool, error) {
+	var ids []uint
+	if err := initializers.DB.Table("patients").
+		Joins("JOIN household_patients ON household_patients.patient_id = patients.id").
+		Where("household_patients.household_id = ? AND patients.deleted_at IS NULL", household.ID).
+		Pluck("patients.user_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	caregivers := map[uint]bool{household.AdminID: true}
+	for _, id := range ids {
+		caregivers[id] = true
+	}
+	return caregivers, nil
+}
+
+// buildEscalationSteps validates the requested steps and converts them to models
+func buildEscalationSteps(req EscalationPolicyRequest, caregivers map[uint]bool) ([]models.EscalationStep, validation.Errors) {
+	errs := validation.Errors{}
+	if _, ok := models.AlertSeverityRank[req.MinSeverity]; !ok {
+		errs.Add("minSeverity", "must be info, warning or critical")
+	}
+	if len(req.Steps) == 0 {
+		errs.Add("steps", "at least one step is required")
+	}
+	if len(req.Steps) > MaxEscalationSteps {
+		errs.Add("steps", fmt.Sprintf("at most %d steps are allowed", MaxEscalationSteps))
+	}
+
+	steps := make([]models.EscalationStep, 0, len(req.Steps))
+	for i, step := range req.Steps {
+		field := fmt.Sprintf("steps[%d]", i)
+		if !models.NotificationChannels[step.Channel] {
+			errs.Add(field+".channel", "must be email, sms, webhook or in_app")
+		}
+		if step.TimeoutMinutes < 1 || step.TimeoutMinutes > 24*60 {
+			errs.Add(field+".timeoutMinutes", "must be between 1 and 1440")
+		}
+
+		var userID *uint
+		switch step.Target {
+		case models.EscalateToUser:
+			if step.UserID == nil {
+				errs.Add(field+".userId", "is required for a user step")
+			} else if !caregivers[*step.UserID] {
+				errs.Add(field+".userId", "must be the household admin or one of its patients")
+			}
+			userID = step.UserID
+		case models.EscalateToEmergencyContact:
+			if step.Channel != models.ChannelSMS {
+				errs.Add(field+".channel", "emergency contacts can only be reached by sms")
+			}
+		default:
+			errs.Add(field+".target", "must be user or emergency_contact")
+		}
+
+		steps = append(steps, models.EscalationStep{
+			Position:       i + 1,
+			Target:         step.Target,
+			UserID:         userID,
+			Channel:        step.Channel,
+			TimeoutMinutes: step.TimeoutMinutes,
+		})
+	}
+	return steps, errs
+}
+
+// GetEscalationPolicy returns the admin's household escalation policy
+func GetEscalationPolicy(c *gin.Context) {
+	household, _, ok := adminHousehold(c)
+	if !ok {
+		return
+	}
+
+	var policy models.EscalationPolicy
+	if err := initializers.DB.Preload("Steps", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Where("household_id = ?", household.ID).First(&policy).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No escalation policy set"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch escalation policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policy": policy})
+}
+
+// UpdateEscalationPolicy creates or replaces the admin's household escalation
+// policy. Alerts already escalating continue with the new steps.
+func UpdateEscalationPolicy(c *gin.Context) {
+	household, admin, ok := adminHousehold(c)
+	if !ok {
+		return
+	}
+
+	var req EscalationPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.MinSeverity == "" {
+		req.MinSeverity = models.AlertWarning
+	}
+
+	caregivers, err := householdCaregiverIDs(household)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch household"})
+		return
+	}
+	steps, errs := buildEscalationSteps(req, caregivers)
+	if errs.Any() {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	var policy models.EscalationPolicy
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(models.EscalationPolicy{HouseholdID: household.ID}).FirstOrInit(&policy).Error; err != nil {
+			return err
+		}
+		policy.MinSeverity = req.MinSeverity
+		policy.UpdatedByID = admin.ID
+		if err := tx.Save(&policy).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("policy_id = ?", policy.ID).Delete(&models.EscalationStep{}).Error; err != nil {
+			return err
+		}
+		for i := range steps {
+			steps[i].PolicyID = policy.ID
+		}
+		policy.Steps = steps
+		return tx.Create(&policy.Steps).Error
+	})
+	if err != nil {
+		log.Printf("Error saving escalation policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save escalation policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policy": policy})
+}
+
+// DeleteEscalationPolicy removes the admin's household escalation policy;
+// alerts that are escalating stop at their current step
+func DeleteEscalationPolicy(c *gin.Context) {
+	household, _, ok := adminHousehold(c)
+	if !ok {
+		return
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var policy models.EscalationPolicy
+		if err := tx.Where("household_id = ?", household.ID).First(&policy).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("policy_id = ?", policy.ID).Delete(&models.EscalationStep{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&policy).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No escalation policy set"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete escalation policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": "Escalation policy deleted"})
+}
@@ -0,0 +1,336 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"my-health/initializers"
+	"my-health/models"
+	"my-health/services/fhir"
+)
+
+const (
+	defaultFHIRPageSize = 100
+	maxFHIRPageSize     = 1000
+)
+
+// respondFHIR writes a FHIR resource with the FHIR JSON media type
+func respondFHIR(c *gin.Context, status int, resource interface{}) {
+	c.Header("Content-Type", fhir.ContentType)
+	c.JSON(status, resource)
+}
+
+// respondFHIRError writes an OperationOutcome; code is a FHIR issue type such
+// as "not-found"
+func respondFHIRError(c *gin.Context, status int, code, diagnostics string) {
+	respondFHIR(c, status, fhir.Outcome(code, diagnostics))
+}
+
+// fhirServerURL is the scheme and host the request was made to, honouring a
+// proxy's X-Forwarded-Proto
+func fhirServerURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// fhirBaseURL is the base of the FHIR API, used in full URLs of resources
+func fhirBaseURL(c *gin.Context) string {
+	return fhirServerURL(c) + "/fhir"
+}
+
+// fhirPage reads _count and _offset. On failure the response has already been written.
+func fhirPage(c *gin.Context) (int, int, bool) {
+	count, offset := defaultFHIRPageSize, 0
+	if value := c.Query("_count"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			respondFHIRError(c, http.StatusBadRequest, "invalid", "_count must be a non-negative number")
+			return 0, 0, false
+		}
+		count = n
+		if count > maxFHIRPageSize {
+			count = maxFHIRPageSize
+		}
+	}
+	if value := c.Query("_offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			respondFHIRError(c, http.StatusBadRequest, "invalid", "_offset must be a non-negative number")
+			return 0, 0, false
+		}
+		offset = n
+	}
+	return count, offset, true
+}
+
+// fhirPageLinks returns the self link of the request and the link to the next
+// page, if there are more matches than this page and the ones before it hold
+func fhirPageLinks(c *gin.Context, count, offset int, total int64) (string, string) {
+	self := fhirServerURL(c) + c.Request.URL.RequestURI()
+	if count == 0 || int64(offset+count) >= total {
+		return self, ""
+	}
+	query := c.Request.URL.Query()
+	query.Set("_offset", strconv.Itoa(offset+count))
+	return self, fhirServerURL(c) + c.Request.URL.Path + "?" + query.Encode()
+}
+
+// fhirPatient loads the patient with the given ID and checks that the user may
+// access it. On failure the response has already been written.
+func fhirPatient(c *gin.Context, user models.User, id string) (models.Patient, bool) {
+	var patient models.Patient
+	if err := initializers.DB.Where("id = ?", id).First(&patient).Error; err != nil {
+		respondFHIRError(c, http.StatusNotFound, "not-found", fmt.Sprintf("Patient/%s is not known", id))
+		return models.Patient{}, false
+	}
+	if !canAccessPatient(user, patient) {
+		respondFHIRError(c, http.StatusForbidden, "forbidden", "access denied")
+		return models.Patient{}, false
+	}
+	return patient, true
+}
+
+// accessiblePatientIDs returns the user's own patient record and, for an
+// admin, the patients of their households
+func accessiblePatientIDs(user models.User) ([]uint, error) {
+	var ids []uint
+	if err := initializers.DB.Model(&models.Patient{}).Where("user_id = ?", user.ID).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	if user.Role == "admin" {
+		household, err := householdPatientIDs(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, household...)
+	}
+	return ids, nil
+}
+
+// fhirSessionUser returns the current user. On failure the response has already been written.
+func fhirSessionUser(c *gin.Context) (models.User, bool) {
+	currentUser, exists := c.Get("currentUser")
+	if !exists {
+		respondFHIRError(c, http.StatusUnauthorized, "login", "User not found in context")
+		return models.User{}, false
+	}
+	return currentUser.(models.User), true
+}
+
+// GetFHIRMetadata returns the CapabilityStatement of the FHIR API
+func GetFHIRMetadata(c *gin.Context) {
+	respondFHIR(c, http.StatusOK, fhir.CapabilityStatement(fhirBaseURL(c)))
+}
+
+// SearchFHIRPatients lists the patients the user may access as a searchset Bundle
+func SearchFHIRPatients(c *gin.Context) {
+	user, ok := fhirSessionUser(c)
+	if !ok {
+		return
+	}
+	count, offset, ok := fhirPage(c)
+	if !ok {
+		return
+	}
+
+	ids, err := accessiblePatientIDs(user)
+	if err != nil {
+		log.Printf("Error listing FHIR patients: %v", err)
+		respondFHIRError(c, http.StatusInternalServerError, "exception", "Failed to retrieve patients")
+		return
+	}
+	var patients []models.Patient
+	var total int64
+	if len(ids) > 0 {
+		if err := initializers.DB.Model(&models.Patient{}).Where("id IN ?", ids).Count(&total).Error; err != nil {
+			respondFHIRError(c, http.StatusInternalServerError, "exception", "Failed to retrieve patients")
+			return
+		}
+	}
+	if total > 0 && count > 0 {
+		if err := initializers.DB.Where("id IN ?", ids).Order("id").Limit(count).Offset(offset).
+			Find(&patients).Error; err != nil {
+			respondFHIRError(c, http.StatusInternalServerError, "exception", "Failed to retrieve patients")
+			return
+		}
+	}
+
+	entries := make([]fhir.BundleEntry, 0, len(patients))
+	for _, patient := range patients {
+		entries = append(entries, fhir.Entry(fhirBaseURL(c), fhir.PatientResource(patient), "match"))
+	}
+	self, next := fhirPageLinks(c, count, offset, total)
+	respondFHIR(c, http.StatusOK, fhir.SearchSet(self, next, total, entries))
+}
+
+// GetFHIRPatient returns a patient as a FHIR Patient
+func GetFHIRPatient(c *gin.Context) {
+	user, ok := fhirSessionUser(c)
+	if !ok {
+		return
+	}
+	patient, ok := fhirPatient(c, user, c.Param("id"))
+	if !ok {
+		return
+	}
+	respondFHIR(c, http.StatusOK, fhir.PatientResource(patient))
+}
+
+// GetFHIRPatientEverything implements Patient/$everything: a Bundle of the
+// patient and their observations, newest first. The optional start and end
+// dates limit the observations; pages are _count observations long.
+func GetFHIRPatientEverything(c *gin.Context) {
+	user, ok := fhirSessionUser(c)
+	if !ok {
+		return
+	}
+	patient, ok := fhirPatient(c, user, c.Param("id"))
+	if !ok {
+		return
+	}
+	count, offset, ok := fhirPage(c)
+	if !ok {
+		return
+	}
+
+	var dates []string
+	if start := c.Query("start"); start != "" {
+		dates = append(dates, "ge"+start)
+	}
+	if end := c.Query("end"); end != "" {
+		dates = append(dates, "le"+end)
+	}
+	period, err := fhir.ParseDates(dates)
+	if err != nil {
+		respondFHIRError(c, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	list, total, err := fhir.Search(initializers.DB, fhir.ObservationSearch{
+		PatientIDs: []uint{patient.ID},
+		Period:     period,
+		Count:      count,
+		Offset:     offset,
+	})
+	if err != nil {
+		log.Printf("Error exporting FHIR observations for patient %d: %v", patient.ID, err)
+		respondFHIRError(c, http.StatusInternalServerError, "exception", "Failed to retrieve observations")
+		return
+	}
+
+	base := fhirBaseURL(c)
+	var entries []fhir.BundleEntry
+	if offset == 0 {
+		entries = append(entries, fhir.Entry(base, fhir.PatientResource(patient), "match"))
+	}
+	for _, o := range list {
+		if resource, ok := fhir.ObservationResource(o); ok {
+			entries = append(entries, fhir.Entry(base, resource, "include"))
+		}
+	}
+	self, next := fhirPageLinks(c, count, offset, total)
+	respondFHIR(c, http.StatusOK, fhir.SearchSet(self, next, total+1, entries))
+}
+
+// GetFHIRObservation returns an observation as a FHIR Observation
+func GetFHIRObservation(c *gin.Context) {
+	user, ok := fhirSessionUser(c)
+	if !ok {
+		return
+	}
+
+	var observation models.Observation
+	if err := initializers.DB.Where("id = ?", c.Param("id")).First(&observation).Error; err != nil {
+		respondFHIRError(c, http.StatusNotFound, "not-found", fmt.Sprintf("Observation/%s is not known", c.Param("id")))
+		return
+	}
+	resource, ok := fhir.ObservationResource(observation)
+	if !ok {
+		respondFHIRError(c, http.StatusNotFound, "not-found", fmt.Sprintf("Observation/%s is not known", c.Param("id")))
+		return
+	}
+	if _, ok := fhirPatient(c, user, strconv.FormatUint(uint64(observation.PatientID), 10)); !ok {
+		return
+	}
+	respondFHIR(c, http.StatusOK, resource)
+}
+
+// SearchFHIRObservations searches observations as a searchset Bundle, newest
+// first. Supported parameters are subject or patient ("Patient/12" or "12"),
+// date with the eq, ge, gt, le and lt prefixes (repeat it for a range), code
+// as LOINC tokens, _count and _offset. Without a subject every patient the
+// user may access is searched.
+func SearchFHIRObservations(c *gin.Context) {
+	user, ok := fhirSessionUser(c)
+	if !ok {
+		return
+	}
+	count, offset, ok := fhirPage(c)
+	if !ok {
+		return
+	}
+
+	search := fhir.ObservationSearch{Count: count, Offset: offset}
+	subject := c.Query("subject")
+	if subject == "" {
+		subject = c.Query("patient")
+	}
+	if subject != "" {
+		id := strings.TrimPrefix(subject, "Patient/")
+		if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+			respondFHIRError(c, http.StatusBadRequest, "invalid", "subject must be a Patient reference such as Patient/12")
+			return
+		}
+		patient, ok := fhirPatient(c, user, id)
+		if !ok {
+			return
+		}
+		search.PatientIDs = []uint{patient.ID}
+	} else {
+		ids, err := accessiblePatientIDs(user)
+		if err != nil {
+			log.Printf("Error listing FHIR patients: %v", err)
+			respondFHIRError(c, http.StatusInternalServerError, "exception", "Failed to retrieve observations")
+			return
+		}
+		search.PatientIDs = ids
+	}
+
+	period, err := fhir.ParseDates(c.QueryArray("date"))
+	if err != nil {
+		respondFHIRError(c, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	search.Period = period
+	if code := c.Query("code"); code != "" {
+		search.Metrics = fhir.ParseCodes(code)
+	}
+
+	list, total, err := fhir.Search(initializers.DB, search)
+	if err != nil {
+		log.Printf("Error searching FHIR observations: %v", err)
+		respondFHIRError(c, http.StatusInternalServerError, "exception", "Failed to retrieve observations")
+		return
+	}
+
+	base := fhirBaseURL(c)
+	entries := make([]fhir.BundleEntry, 0, len(list))
+	for _, o := range list {
+		if resource, ok := fhir.ObservationResource(o); ok {
+			entries = append(entries, fhir.Entry(base, resource, "match"))
+		}
+	}
+	self, next := fhirPageLinks(c, count, offset, total)
+	respondFHIR(c, http.StatusOK, fhir.SearchSet(self, next, total, entries))
+}
@@ -3,12 +3,14 @@ package controllers
 import (
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
 	"my-health/initializers"
 	"my-health/models"
+	"my-health/services/news2"
 )
 
 func GetHouseholdPatients(c *gin.Context) {
@@ -49,21 +51,51 @@ func GetHouseholdPatients(c *gin.Context) {
 		return
 	}
 
+	type News2Response struct {
+		Total           int       `json:"total"`
+		Band            string    `json:"band"`
+		ComputedAt      time.Time `json:"computed_at"`
+		LatestReadingAt time.Time `json:"latest_reading_at"`
+	}
+
 	type PatientResponse struct {
-		ID      uint   `json:"id"`
-		Name    string `json:"name"`
-		Surname string `json:"surname"`
+		ID      uint           `json:"id"`
+		Name    string         `json:"name"`
+		Surname string         `json:"surname"`
+		News2   *News2Response `json:"news2"`
+	}
+
+	patientIDs := make([]uint, 0, len(household.Patients))
+	for _, patient := range household.Patients {
+		patientIDs = append(patientIDs, patient.ID)
+	}
+	scores, err := news2.Latest(initializers.DB, patientIDs)
+	if err != nil {
+		log.Printf("Error fetching NEWS2 scores: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch NEWS2 scores"})
+		return
 	}
 
 	var patients []PatientResponse
 	for _, patient := range household.Patients {
 		// Only include patients that have details set
 		if patient.Name != "" && patient.Surname != "" {
-			patients = append(patients, PatientResponse{
+			response := PatientResponse{
 				ID:      patient.ID,
 				Name:    patient.Name,
 				Surname: patient.Surname,
-			})
+			}
+			// A score is no longer current once its newest reading is too old to
+			// count, however recently it was computed
+			if score, ok := scores[patient.ID]; ok && time.Since(score.LatestReadingAt) <= news2.MaxAge {
+				response.News2 = &News2Response{
+					Total:           score.Total,
+					Band:            score.Band,
+					ComputedAt:      score.ComputedAt,
+					LatestReadingAt: score.LatestReadingAt,
+				}
+			}
+			patients = append(patients, response)
 		}
 	}
 
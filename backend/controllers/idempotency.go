@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+
+	"my-health/initializers"
+	"my-health/models"
+)
+
+// idempotencyTTL is how long a stored response can be replayed
+const idempotencyTTL = 24 * time.Hour
+
+// idempotencyLease is how long a claimed key waits for its request to answer.
+// After that a retry can claim it again, so a request that crashed does not
+// block the key until it expires.
+const idempotencyLease = 2 * time.Minute
+
+// beginIdempotentRequest claims the request's Idempotency-Key header for the user.
+// It returns the claimed key (nil if the client sent none) and false when it has
+// already answered the request itself, by replaying the stored response or with an error.
+func beginIdempotentRequest(c *gin.Context, user models.User, body []byte) (*models.IdempotencyKey, bool) {
+	key := c.GetHeader("Idempotency-Key")
+	if key == "" {
+		return nil, true
+	}
+	if len(key) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+		return nil, false
+	}
+
+	hash := sha256.Sum256(body)
+	now := time.Now()
+	record := models.IdempotencyKey{
+		UserID:      user.ID,
+		Key:         key,
+		Endpoint:    c.Request.Method + " " + c.Request.URL.Path,
+		RequestHash: hex.EncodeToString(hash[:]),
+		ClaimedAt:   now,
+		ExpiresAt:   now.Add(idempotencyTTL),
+	}
+
+	// Expired keys are cleared lazily so they can be claimed again
+	if err := initializers.DB.Unscoped().Where("expires_at < ?", now).Delete(&models.IdempotencyKey{}).Error; err != nil {
+		log.Printf("Error clearing expired idempotency keys: %v", err)
+	}
+
+	result := initializers.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+	if result.Error != nil {
+		log.Printf("Error claiming idempotency key: %v", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process Idempotency-Key"})
+		return nil, false
+	}
+	if result.RowsAffected == 1 {
+		return &record, true
+	}
+
+	var existing models.IdempotencyKey
+	if err := initializers.DB.Where("user_id = ? AND key = ?", user.ID, key).First(&existing).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process Idempotency-Key"})
+		return nil, false
+	}
+	if existing.Endpoint != record.Endpoint || existing.RequestHash != record.RequestHash {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+		return nil, false
+	}
+	if existing.StatusCode == 0 {
+		result := initializers.DB.Model(&models.IdempotencyKey{}).
+			Where("id = ? AND status_code = 0 AND (claimed_at IS NULL OR claimed_at < ?)", existing.ID, now.Add(-idempotencyLease)).
+			Update("claimed_at", now)
+		if result.Error != nil {
+			log.Printf("Error reclaiming idempotency key: %v", result.Error)
+		} else if result.RowsAffected == 1 {
+			existing.ClaimedAt = now
+			return &existing, true
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still being processed"})
+		return nil, false
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(existing.StatusCode, "application/json; charset=utf-8", existing.Response)
+	return nil, false
+}
+
+// respondIdempotent writes the response and stores it against the claimed key.
+// Server errors release the key instead, so the client can retry.
+func respondIdempotent(c *gin.Context, key *models.IdempotencyKey, status int, response gin.H) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error encoding response: %v", err)
+		status = http.StatusInternalServerError
+		body = []byte(`{"error":"Failed to encode response"}`)
+	}
+
+	if key != nil {
+		if status >= http.StatusInternalServerError {
+			err = initializers.DB.Unscoped().Delete(key).Error
+		} else {
+			err = initializers.DB.Model(key).Updates(map[string]interface{}{"status_code": status, "response": body}).Error
+		}
+		if err != nil {
+			log.Printf("Error storing idempotent response: %v", err)
+		}
+	}
+
+	c.Data(status, "application/json; charset=utf-8", body)
+}
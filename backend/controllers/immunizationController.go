@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"my-health/initializers"
+	"my-health/models"
+	"my-health/services/immunization"
+	"my-health/validation"
+)
+
+type ImmunizationRequest struct {
+	VaccineCode       string `json:"vaccineCode" binding:"required"`
+	DoseNumber        int    `json:"doseNumber"`
+	AdministeredOn    string `json:"administeredOn" binding:"required"` // YYYY-MM-DD
+	LotNumber         string `json:"lotNumber"`
+	AdministeringSite string `json:"administeringSite"`
+	Notes             string `json:"notes"`
+}
+
+// applyImmunizationRequest validates the request and copies it onto the record
+func applyImmunizationRequest(record *models.Immunization, patient models.Patient, req ImmunizationRequest) validation.Errors {
+	errs := validation.Errors{}
+
+	if _, ok := models.VaccineCodes[req.VaccineCode]; !ok {
+		errs.Add("vaccineCode", "unknown vaccine code")
+	}
+	doseNumber := req.DoseNumber
+	if doseNumber == 0 {
+		doseNumber = 1
+	}
+	if doseNumber < 1 || doseNumber > 20 {
+		errs.Add("doseNumber", "must be between 1 and 20")
+	}
+
+	administeredOn, err := time.Parse("2006-01-02", req.AdministeredOn)
+	if err != nil {
+		errs.Add("administeredOn", "must be a date in YYYY-MM-DD format")
+	} else if administeredOn.After(time.Now()) {
+		errs.Add("administeredOn", "cannot be in the future")
+	} else if !patient.DateOfBirth.IsZero() && administeredOn.Before(patient.DateOfBirth) {
+		errs.Add("administeredOn", "cannot be before the patient's date of birth")
+	}
+
+	errs.MaxLength("lotNumber", req.LotNumber, validation.MaxNameLength)
+	errs.MaxLength("administeringSite", req.AdministeringSite, validation.MaxAddressLength)
+	errs.MaxLength("notes", req.Notes, validation.MaxClinicalTextLength)
+	if errs.Any() {
+		return errs
+	}
+
+	record.VaccineCode = req.VaccineCode
+	record.DoseNumber = doseNumber
+	record.AdministeredOn = administeredOn
+	record.LotNumber = strings.TrimSpace(req.LotNumber)
+	record.AdministeringSite = strings.TrimSpace(req.AdministeringSite)
+	record.Notes = req.Notes
+	return nil
+}
+
+// forecastHorizon reads the ?days= look-ahead for upcoming vaccines, 90 days by default
+func forecastHorizon(c *gin.Context) (time.Duration, bool) {
+	days := 90
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 || parsed > 730 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 0 and 730"})
+			return 0, false
+		}
+		days = parsed
+	}
+	return time.Duration(days) * 24 * time.Hour, true
+}
+
+// GetPatientImmunizations lists a patient's vaccination history, most recent first
+func GetPatientImmunizations(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	query := initializers.DB.Where("patient_id = ?", patient.ID)
+	if code := c.Query("vaccine"); code != "" {
+		query = query.Where("vaccine_code = ?", code)
+	}
+
+	var records []models.Immunization
+	if err := query.Order("administered_on DESC").Find(&records).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch immunizations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"immunizations": records})
+}
+
+// CreatePatientImmunization records a vaccine dose given to a patient
+func CreatePatientImmunization(c *gin.Context) {
+	patient, user, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	var requestBody ImmunizationRequest
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	record := models.Immunization{PatientID: patient.ID, RecordedByID: user.ID}
+	if errs := applyImmunizationRequest(&record, patient, requestBody); errs.Any() {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	if err := initializers.DB.Create(&record).Error; err != nil {
+		log.Printf("Error creating immunization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save immunization"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"immunization": record})
+}
+
+// UpdatePatientImmunization corrects a vaccination record
+func UpdatePatientImmunization(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	var record models.Immunization
+	if err := initializers.DB.Where("id = ? AND patient_id = ?", c.Param("immunizationId"), patient.ID).
+		First(&record).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Immunization not found"})
+		return
+	}
+
+	var requestBody ImmunizationRequest
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errs := applyImmunizationRequest(&record, patient, requestBody); errs.Any() {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	if err := initializers.DB.Save(&record).Error; err != nil {
+		log.Printf("Error updating immunization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update immunization"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"immunization": record})
+}
+
+// DeletePatientImmunization removes a vaccination record entered by mistake
+func DeletePatientImmunization(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	result := initializers.DB.Where("id = ? AND patient_id = ?", c.Param("immunizationId"), patient.ID).
+		Delete(&models.Immunization{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete immunization"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Immunization not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": "Immunization deleted"})
+}
+
+// GetPatientImmunizationForecast lists the vaccines a patient is overdue for or will need soon
+func GetPatientImmunizationForecast(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+	horizon, ok := forecastHorizon(c)
+	if !ok {
+		return
+	}
+	if patient.DateOfBirth.IsZero() {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Patient date of birth is required for a forecast"})
+		return
+	}
+
+	var records []models.Immunization
+	if err := initializers.DB.Where("patient_id = ?", patient.ID).Find(&records).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch immunizations"})
+		return
+	}
+
+	forecast := immunization.ForecastPatient(immunization.Schedule(), patient.DateOfBirth, records, time.Now(), horizon)
+	c.JSON(http.StatusOK, gin.H{"forecast": forecast})
+}
+
+// GetHouseholdImmunizationForecast lists overdue and upcoming vaccines for every patient in the admin's household
+func GetHouseholdImmunizationForecast(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+	horizon, ok := forecastHorizon(c)
+	if !ok {
+		return
+	}
+
+	patientIDs, err := householdPatientIDs(admin.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch household"})
+		return
+	}
+
+	type PatientForecast struct {
+		PatientID      uint                    `json:"patient_id"`
+		PatientName    string                  `json:"patient_name"`
+		PatientSurname string                  `json:"patient_surname"`
+		Forecast       []immunization.Forecast `json:"forecast"`
+	}
+
+	results := []PatientForecast{}
+	if len(patientIDs) > 0 {
+		var patients []models.Patient
+		if err := initializers.DB.Where("id IN ?", patientIDs).Order("surname, name").Find(&patients).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch patients"})
+			return
+		}
+
+		var records []models.Immunization
+		if err := initializers.DB.Where("patient_id IN ?", patientIDs).Find(&records).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch immunizations"})
+			return
+		}
+		byPatient := map[uint][]models.Immunization{}
+		for _, record := range records {
+			byPatient[record.PatientID] = append(byPatient[record.PatientID], record)
+		}
+
+		now := time.Now()
+		rules := immunization.Schedule()
+		for _, patient := range patients {
+			// Patients who haven't completed their profile can't be forecast
+			if patient.DateOfBirth.IsZero() {
+				continue
+			}
+			forecast := immunization.ForecastPatient(rules, patient.DateOfBirth, byPatient[patient.ID], now, horizon)
+			if len(forecast) == 0 {
+				continue
+			}
+			results = append(results, PatientForecast{
+				PatientID:      patient.ID,
+				PatientName:    patient.Name,
+				PatientSurname: patient.Surname,
+				Forecast:       forecast,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"patients": results})
+}
@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"my-health/initializers"
+	"my-health/models"
+	"my-health/services/imports"
+	"my-health/services/timeseries"
+	"my-health/validation"
+)
+
+// maxImportBytes caps the size of an uploaded CSV file
+const maxImportBytes = 20 << 20
+
+// previewRows is the number of lines returned by PreviewPatientImport
+const previewRows = 10
+
+func newImportStorageKey(patientID uint) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("patients/%d/imports/%s", patientID, hex.EncodeToString(b)), nil
+}
+
+// openImportFile opens the "file" part of a multipart upload. It responds with
+// an error and returns false if the file is missing, empty or too large.
+func openImportFile(c *gin.Context) (multipart.File, *multipart.FileHeader, bool) {
+	// Leave some room for the mapping and other form fields
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes+1<<20)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return nil, nil, false
+	}
+	if fileHeader.Size > maxImportBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("file exceeds the %d byte limit", maxImportBytes)})
+		return nil, nil, false
+	}
+	if fileHeader.Size == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is empty"})
+		return nil, nil, false
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return nil, nil, false
+	}
+	return file, fileHeader, true
+}
+
+// PreviewPatientImport reads the headers and first lines of a CSV upload and
+// suggests a column mapping for them, the first step of an import
+func PreviewPatientImport(c *gin.Context) {
+	if _, _, ok := authorizedPatient(c, "id"); !ok {
+		return
+	}
+	file, _, ok := openImportFile(c)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	sample, err := imports.Preview(file, c.PostForm("delimiter"), previewRows)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CSV: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sample":  sample,
+		"mapping": imports.Suggest(sample),
+		"fields":  imports.Fields,
+	})
+}
+
+// ImportPatientMetrics imports historical readings from a CSV upload. The
+// "mapping" form field holds the column mapping as JSON; without it the
+// suggested mapping is used, and without a delimiter it is detected. With dryRun=true every line is validated and
+// checked for duplicates and the report is returned without storing anything.
+// Otherwise the file is queued and imported in the background; poll the
+// returned batch for progress.
+func ImportPatientMetrics(c *gin.Context) {
+	patient, user, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+	file, fileHeader, ok := openImportFile(c)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	sample, err := imports.Preview(file, "", 0)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CSV: " + err.Error()})
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	var mapping models.ImportMapping
+	if value := c.PostForm("mapping"); value == "" {
+		mapping = imports.Suggest(sample)
+	} else {
+		if err := json.Unmarshal([]byte(value), &mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mapping JSON: " + err.Error()})
+			return
+		}
+		if mapping.Delimiter == "" {
+			mapping.Delimiter = sample.Delimiter
+		}
+	}
+
+	now := time.Now()
+	reader, err := imports.NewReader(file, mapping, patient.ID, now, timeseries.RetentionCutoff(now))
+	var errs validation.Errors
+	if errors.As(err, &errs) {
+		respondValidationErrors(c, errs)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CSV: " + err.Error()})
+		return
+	}
+
+	if dryRun, _ := strconv.ParseBool(c.DefaultPostForm("dryRun", c.Query("dryRun"))); dryRun {
+		report, err := imports.DryRun(initializers.DB, reader)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CSV: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"dry_run": true, "mapping": mapping, "report": report})
+		return
+	}
+
+	// Read the whole file once so malformed CSV is rejected now rather than
+	// halfway through the background import
+	total, err := imports.Count(reader)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CSV: " + err.Error()})
+		return
+	}
+	if total == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file has no readings"})
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	key, err := newImportStorageKey(patient.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store import"})
+		return
+	}
+	if err := initializers.Blobs.Put(c.Request.Context(), key, file, fileHeader.Size, "text/csv"); err != nil {
+		log.Printf("Error storing import file: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store import"})
+		return
+	}
+
+	batch := models.ImportBatch{
+		PatientID:   patient.ID,
+		CreatedByID: user.ID,
+		FileName:    filepath.Base(fileHeader.Filename),
+		StorageKey:  key,
+		Mapping:     mapping,
+		Status:      models.ImportQueued,
+		TotalRows:   total,
+		RowErrors:   []models.ImportRowError{},
+	}
+	if err := initializers.DB.Create(&batch).Error; err != nil {
+		log.Printf("Error creating import batch: %v", err)
+		if err := initializers.Blobs.Delete(c.Request.Context(), key); err != nil {
+			log.Printf("Error deleting import file %s: %v", key, err)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store import"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"import": batch})
+}
+
+// GetPatientImports lists the patient's imports, newest first
+func GetPatientImports(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	var batches []models.ImportBatch
+	if err := initializers.DB.Where("patient_id = ?", patient.ID).
+		Order("created_at DESC").
+		Find(&batches).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve imports"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"imports": batches})
+}
+
+func findPatientImport(c *gin.Context) (models.ImportBatch, models.User, bool) {
+	patient, user, ok := authorizedPatient(c, "id")
+	if !ok {
+		return models.ImportBatch{}, models.User{}, false
+	}
+
+	var batch models.ImportBatch
+	if err := initializers.DB.Where("id = ? AND patient_id = ?", c.Param("importId"), patient.ID).
+		First(&batch).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+		return models.ImportBatch{}, models.User{}, false
+	}
+	return batch, user, true
+}
+
+// GetPatientImport returns an import with its progress
+func GetPatientImport(c *gin.Context) {
+	batch, _, ok := findPatientImport(c)
+	if !ok {
+		return
+	}
+
+	progress := 0.0
+	if batch.TotalRows > 0 {
+		progress = float64(batch.ProcessedRows) / float64(batch.TotalRows)
+	}
+	c.JSON(http.StatusOK, gin.H{"import": batch, "progress": progress})
+}
+
+// UndoPatientImport removes every reading an import stored, or cancels it if
+// it has not started
+func UndoPatientImport(c *gin.Context) {
+	batch, user, ok := findPatientImport(c)
+	if !ok {
+		return
+	}
+
+	removed, err := imports.Undo(c.Request.Context(), initializers.DB, initializers.Blobs, &batch, user.ID, time.Now())
+	if errors.Is(err, imports.ErrNotUndoable) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Import is running or already undone"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error undoing import %d: %v", batch.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to undo import"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"import": batch, "removed": removed})
+}
@@ -0,0 +1,348 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"my-health/initializers"
+	"my-health/models"
+	"my-health/services/labs"
+	"my-health/validation"
+)
+
+type LabResultRequest struct {
+	TestCode  string   `json:"testCode"`
+	TestName  string   `json:"testName"`
+	Value     *float64 `json:"value"`
+	Unit      string   `json:"unit"`
+	RangeLow  *float64 `json:"rangeLow"`  // overrides the built-in reference range
+	RangeHigh *float64 `json:"rangeHigh"` // overrides the built-in reference range
+	Notes     string   `json:"notes"`
+}
+
+type LabReportRequest struct {
+	Panel       string             `json:"panel"`
+	CollectedAt string             `json:"collectedAt" binding:"required"` // RFC 3339
+	Laboratory  string             `json:"laboratory"`
+	Results     []LabResultRequest `json:"results"`
+}
+
+// applyLabResultRequest validates one result, copies it onto the record and flags it
+// against the report's or the built-in reference range
+func applyLabResultRequest(result *models.LabResult, patient models.Patient, req LabResultRequest, field string, errs validation.Errors) {
+	testCode := strings.ToLower(strings.TrimSpace(req.TestCode))
+	analyte, known := labs.Analytes[testCode]
+	if testCode == "" {
+		errs.Add(field+".testCode", "is required")
+	}
+	if req.Value == nil {
+		errs.Add(field+".value", "is required")
+	}
+
+	unit := strings.TrimSpace(req.Unit)
+	if known {
+		if unit == "" {
+			unit = analyte.Unit
+		} else if unit != analyte.Unit {
+			errs.Add(field+".unit", fmt.Sprintf("must be %s", analyte.Unit))
+		}
+	} else if unit == "" {
+		errs.Add(field+".unit", "is required for tests without a built-in definition")
+	}
+
+	if req.RangeLow != nil && req.RangeHigh != nil && *req.RangeLow >= *req.RangeHigh {
+		errs.Add(field+".rangeHigh", "must be greater than rangeLow")
+	}
+	errs.MaxLength(field+".testName", req.TestName, validation.MaxNameLength)
+	errs.MaxLength(field+".notes", req.Notes, validation.MaxClinicalTextLength)
+	if errs.Any() {
+		return
+	}
+
+	low, high := req.RangeLow, req.RangeHigh
+	if low == nil && high == nil && !patient.DateOfBirth.IsZero() {
+		if r, ok := labs.RangeFor(testCode, patient.Gender, labs.AgeAt(patient.DateOfBirth, result.CollectedAt)); ok {
+			low, high = r.Low, r.High
+		}
+	}
+
+	testName := strings.TrimSpace(req.TestName)
+	if testName == "" {
+		testName = analyte.Name
+	}
+
+	result.TestCode = testCode
+	result.TestName = testName
+	result.Value = *req.Value
+	result.Unit = unit
+	result.RangeLow = low
+	result.RangeHigh = high
+	result.Flag = labs.Flag(*req.Value, low, high)
+	result.Notes = req.Notes
+}
+
+// GetLabAnalytes lists the lab tests with built-in units and reference ranges
+func GetLabAnalytes(c *gin.Context) {
+	analytes := make([]labs.Analyte, 0, len(labs.Analytes))
+	for _, analyte := range labs.Analytes {
+		analytes = append(analytes, analyte)
+	}
+	sort.Slice(analytes, func(i, j int) bool {
+		if analytes[i].Panel != analytes[j].Panel {
+			return analytes[i].Panel < analytes[j].Panel
+		}
+		return analytes[i].Code < analytes[j].Code
+	})
+
+	c.JSON(http.StatusOK, gin.H{"analytes": analytes})
+}
+
+// GetPatientLabResults lists a patient's lab results grouped into panels, most recent first
+func GetPatientLabResults(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	query := initializers.DB.Where("patient_id = ?", patient.ID)
+	if panel := c.Query("panel"); panel != "" {
+		query = query.Where("panel = ?", panel)
+	}
+	if flagged := c.Query("flagged"); flagged == "true" {
+		query = query.Where("flag IN ?", []string{models.LabFlagLow, models.LabFlagHigh})
+	}
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from, expected RFC 3339"})
+			return
+		}
+		query = query.Where("collected_at >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to, expected RFC 3339"})
+			return
+		}
+		query = query.Where("collected_at < ?", t)
+	}
+
+	var results []models.LabResult
+	if err := query.Order("collected_at DESC, panel, test_code").Find(&results).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lab results"})
+		return
+	}
+
+	type LabPanel struct {
+		Panel       string             `json:"panel"`
+		CollectedAt time.Time          `json:"collected_at"`
+		Laboratory  string             `json:"laboratory"`
+		Abnormal    int                `json:"abnormal"`
+		Results     []models.LabResult `json:"results"`
+	}
+
+	// Results come back ordered by collection time, so each panel's results are adjacent
+	panels := []LabPanel{}
+	for _, result := range results {
+		last := len(panels) - 1
+		if last < 0 || panels[last].Panel != result.Panel || !panels[last].CollectedAt.Equal(result.CollectedAt) {
+			panels = append(panels, LabPanel{Panel: result.Panel, CollectedAt: result.CollectedAt, Laboratory: result.Laboratory})
+			last++
+		}
+		if result.Flag == models.LabFlagLow || result.Flag == models.LabFlagHigh {
+			panels[last].Abnormal++
+		}
+		panels[last].Results = append(panels[last].Results, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"panels": panels})
+}
+
+// CreatePatientLabResults records the results of one lab panel
+func CreatePatientLabResults(c *gin.Context) {
+	patient, user, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	var requestBody LabReportRequest
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	errs := validation.Errors{}
+	collectedAt, err := time.Parse(time.RFC3339, requestBody.CollectedAt)
+	if err != nil {
+		errs.Add("collectedAt", "must be an RFC 3339 timestamp")
+	} else if collectedAt.After(time.Now().Add(5 * time.Minute)) {
+		errs.Add("collectedAt", "cannot be in the future")
+	}
+	if len(requestBody.Results) == 0 {
+		errs.Add("results", "at least one result is required")
+	}
+	errs.MaxLength("panel", requestBody.Panel, validation.MaxRelationshipLength)
+	errs.MaxLength("laboratory", requestBody.Laboratory, validation.MaxNameLength)
+	if errs.Any() {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	panel := strings.ToLower(strings.TrimSpace(requestBody.Panel))
+	results := make([]models.LabResult, len(requestBody.Results))
+	for i, req := range requestBody.Results {
+		results[i] = models.LabResult{
+			PatientID:    patient.ID,
+			RecordedByID: user.ID,
+			CollectedAt:  collectedAt,
+			Laboratory:   strings.TrimSpace(requestBody.Laboratory),
+		}
+		applyLabResultRequest(&results[i], patient, req, fmt.Sprintf("results[%d]", i), errs)
+
+		results[i].Panel = panel
+		if results[i].Panel == "" {
+			results[i].Panel = labs.Analytes[strings.ToLower(strings.TrimSpace(req.TestCode))].Panel
+		}
+		if results[i].Panel == "" {
+			errs.Add(fmt.Sprintf("results[%d].testCode", i), "panel is required for tests without a built-in definition")
+		}
+	}
+	if errs.Any() {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	if err := initializers.DB.Create(&results).Error; err != nil {
+		log.Printf("Error creating lab results: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save lab results"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"results": results})
+}
+
+// UpdatePatientLabResult corrects a single lab result and flags it again
+func UpdatePatientLabResult(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	var result models.LabResult
+	if err := initializers.DB.Where("id = ? AND patient_id = ?", c.Param("resultId"), patient.ID).
+		First(&result).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Lab result not found"})
+		return
+	}
+
+	var requestBody LabResultRequest
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if requestBody.TestCode == "" {
+		requestBody.TestCode = result.TestCode
+	}
+
+	errs := validation.Errors{}
+	applyLabResultRequest(&result, patient, requestBody, "result", errs)
+	if errs.Any() {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	if err := initializers.DB.Save(&result).Error; err != nil {
+		log.Printf("Error updating lab result: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update lab result"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": result})
+}
+
+// DeletePatientLabResult removes a lab result entered by mistake
+func DeletePatientLabResult(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	result := initializers.DB.Where("id = ? AND patient_id = ?", c.Param("resultId"), patient.ID).
+		Delete(&models.LabResult{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete lab result"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Lab result not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": "Lab result deleted"})
+}
+
+// GetPatientLabSeries returns every value of one analyte over time, oldest first, for trend charts
+func GetPatientLabSeries(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	testCode := strings.ToLower(c.Param("testCode"))
+	query := initializers.DB.Where("patient_id = ? AND test_code = ?", patient.ID, testCode)
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from, expected RFC 3339"})
+			return
+		}
+		query = query.Where("collected_at >= ?", t)
+	}
+
+	var results []models.LabResult
+	if err := query.Order("collected_at ASC").Find(&results).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lab results"})
+		return
+	}
+
+	type SeriesPoint struct {
+		ResultID    uint      `json:"result_id"`
+		CollectedAt time.Time `json:"collected_at"`
+		Value       float64   `json:"value"`
+		Unit        string    `json:"unit"`
+		Flag        string    `json:"flag"`
+	}
+
+	points := make([]SeriesPoint, 0, len(results))
+	for _, result := range results {
+		points = append(points, SeriesPoint{
+			ResultID:    result.ID,
+			CollectedAt: result.CollectedAt,
+			Value:       result.Value,
+			Unit:        result.Unit,
+			Flag:        result.Flag,
+		})
+	}
+
+	response := gin.H{"test_code": testCode, "points": points}
+	if analyte, ok := labs.Analytes[testCode]; ok {
+		response["name"] = analyte.Name
+		response["unit"] = analyte.Unit
+	}
+	// The range that applies to the patient today, for drawing the normal band
+	if !patient.DateOfBirth.IsZero() {
+		if r, ok := labs.RangeFor(testCode, patient.Gender, labs.AgeAt(patient.DateOfBirth, time.Now())); ok {
+			response["range_low"] = r.Low
+			response["range_high"] = r.High
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
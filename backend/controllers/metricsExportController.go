@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"my-health/initializers"
+	"my-health/services/export"
+)
+
+// ExportPatientMetrics streams the patient's readings as a spreadsheet, e.g.
+// ?format=xlsx&from=2024-01-01&to=2024-04-01&metrics=heart_rate,weight&tz=Europe/Athens.
+// CSV has one row per reading; XLSX has a summary sheet and one sheet per
+// metric group. Without from the last 30 days are exported.
+func ExportPatientMetrics(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "xlsx" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format, expected csv or xlsx"})
+		return
+	}
+	loc, ok := locationParam(c)
+	if !ok {
+		return
+	}
+
+	query := export.Query{
+		PatientID: patient.ID,
+		To:        time.Now(),
+		Metrics:   splitList(c.Query("metrics")),
+		Location:  loc,
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := parseTimeParam(to, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query.To = t
+	}
+	query.From = query.To.AddDate(0, 0, -30)
+	if from := c.Query("from"); from != "" {
+		t, err := parseTimeParam(from, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query.From = t
+	}
+	if err := query.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fileName := fmt.Sprintf("metrics-%d-%s-%s.%s", patient.ID,
+		query.From.In(loc).Format("20060102"), query.To.In(loc).Format("20060102"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	// The file is streamed, so an error after the first bytes can only be logged
+	var err error
+	if format == "xlsx" {
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		c.Status(http.StatusOK)
+		name := strings.TrimSpace(patient.Name + " " + patient.Surname)
+		err = export.WriteXLSX(c.Writer, initializers.DB, query, name)
+	} else {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		err = export.WriteCSV(c.Writer, initializers.DB, query)
+	}
+	if err != nil {
+		log.Printf("Error exporting metrics of patient %d: %v", patient.ID, err)
+	}
+}
@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"my-health/initializers"
+	"my-health/models"
+	"my-health/services/observations"
+	"my-health/services/pipeline"
+	"my-health/validation"
+)
+
+// maxIngestBatch caps the number of readings accepted in one request
+const maxIngestBatch = 500
+
+// maxIngestBytes caps the request body, comfortably above a full batch
+const maxIngestBytes = 1 << 20
+
+// maxReadingAge rejects readings older than this, which are usually a device with a wrong clock
+const maxReadingAge = 2 * 365 * 24 * time.Hour
+
+type SleepStagesRequest struct {
+	Light     float64 `json:"light"`
+	Deep      float64 `json:"deep"`
+	REM       float64 `json:"rem"`
+	AwakeTime int     `json:"awakeTime"`
+}
+
+// MetricReadingRequest is one timestamped reading from a device. Metrics left
+// at zero were not measured.
+type MetricReadingRequest struct {
+	Timestamp        string              `json:"timestamp"` // RFC 3339
+	Source           string              `json:"source"`
+	DeviceID         string              `json:"deviceId"`
+	Weight           float64             `json:"weight"`
+	HeartRate        int                 `json:"heartRate"`
+	SystolicBP       int                 `json:"systolicBP"`
+	DiastolicBP      int                 `json:"diastolicBP"`
+	OxygenSaturation float64             `json:"oxygenSaturation"`
+	StepsCount       int                 `json:"stepsCount"`
+	SleepDuration    float64             `json:"sleepDuration"`
+	Sleep            *SleepStagesRequest `json:"sleep"`
+	RespirationRate  int                 `json:"respirationRate"`
+	BodyTemperature  float64             `json:"bodyTemperature"` // °C
+	IrregularRhythm  bool                `json:"irregularRhythm"`
+	FallDetected     bool                `json:"fallDetected"`
+}
+
+// MetricBatchRequest wraps several readings; a body without "readings" is a single reading
+type MetricBatchRequest struct {
+	Readings []MetricReadingRequest `json:"readings"`
+}
+
+// Ingest result statuses
+const (
+	ReadingCreated   = "created"
+	ReadingDuplicate = "duplicate"
+	ReadingRejected  = "rejected"
+)
+
+type MetricReadingResult struct {
+	Index  int               `json:"index"`
+	Status string            `json:"status"`
+	ID     uint              `json:"id,omitempty"` // the reading's first observation
+	Errors validation.Errors `json:"errors,omitempty"`
+}
+
+// buildReading validates a reading and converts it to a HealthMetrics row, which
+// observations.Record then splits into one observation per metric
+func buildReading(patientID uint, req MetricReadingRequest, now time.Time) (models.HealthMetrics, validation.Errors) {
+	errs := validation.Errors{}
+
+	timestamp, err := time.Parse(time.RFC3339, req.Timestamp)
+	if err != nil {
+		errs.Add("timestamp", "must be an RFC 3339 timestamp")
+	} else if timestamp.After(now.Add(5 * time.Minute)) {
+		errs.Add("timestamp", "cannot be in the future")
+	} else if timestamp.Before(now.Add(-maxReadingAge)) {
+		errs.Add("timestamp", "is more than two years old")
+	}
+
+	errs.MaxLength("source", req.Source, validation.MaxRelationshipLength)
+	errs.MaxLength("deviceId", req.DeviceID, validation.MaxNameLength)
+	errs.Weight("weight", req.Weight)
+	errs.HeartRate("heartRate", req.HeartRate)
+	errs.OxygenSaturation("oxygenSaturation", req.OxygenSaturation)
+	errs.StepsCount("stepsCount", req.StepsCount)
+	errs.SleepDuration("sleepDuration", req.SleepDuration)
+	errs.RespirationRate("respirationRate", req.RespirationRate)
+	errs.BodyTemperature("bodyTemperature", req.BodyTemperature)
+	if req.SystolicBP != 0 || req.DiastolicBP != 0 {
+		if !validation.MeasuredBloodPressure(req.SystolicBP, req.DiastolicBP) {
+			errs.Add("systolicBP", "must be between 50/20 and 300/200 mmHg with systolic above diastolic")
+		}
+	}
+
+	measured := req.Weight != 0 || req.HeartRate != 0 || req.SystolicBP != 0 || req.OxygenSaturation != 0 ||
+		req.StepsCount != 0 || req.SleepDuration != 0 || req.RespirationRate != 0 || req.BodyTemperature != 0 ||
+		req.IrregularRhythm || req.FallDetected
+	if !measured {
+		errs.Add("reading", "must contain at least one metric")
+	}
+
+	reading := models.HealthMetrics{
+		PatientID:        patientID,
+		Date:             timestamp,
+		Weight:           req.Weight,
+		HeartRate:        req.HeartRate,
+		SystolicBP:       req.SystolicBP,
+		DiastolicBP:      req.DiastolicBP,
+		OxygenSaturation: req.OxygenSaturation,
+		StepsCount:       req.StepsCount,
+		SleepDuration:    req.SleepDuration,
+		RespirationRate:  req.RespirationRate,
+		BodyTemperature:  req.BodyTemperature,
+		IrregularRhythm:  req.IrregularRhythm,
+		FallDetected:     req.FallDetected,
+		Source:           strings.TrimSpace(req.Source),
+		DeviceID:         strings.TrimSpace(req.DeviceID),
+	}
+	if req.SystolicBP != 0 {
+		reading.BloodPressure = fmt.Sprintf("%d/%d", req.SystolicBP, req.DiastolicBP)
+	}
+	if req.Sleep != nil {
+		reading.Sleep = models.SleepStages{
+			Light:     req.Sleep.Light,
+			Deep:      req.Sleep.Deep,
+			REM:       req.Sleep.REM,
+			AwakeTime: req.Sleep.AwakeTime,
+		}
+	}
+	return reading, errs
+}
+
+// existingDeviceReading returns the first observation already stored for the
+// reading's device at the reading's instant, or 0
+func existingDeviceReading(patientID uint, reading models.HealthMetrics) (uint, error) {
+	var existing models.Observation
+	err := initializers.DB.Where("patient_id = ? AND device_id = ? AND effective_at = ?", patientID, reading.DeviceID, reading.Date).
+		Order("id").Limit(1).Find(&existing).Error
+	return existing.ID, err
+}
+
+// IngestPatientHealthMetrics stores one reading or a batch of readings sent by a device.
+// Each reading is accepted or rejected on its own; readings already stored for the same
+// device and timestamp are reported as duplicates. Send an Idempotency-Key header to make
+// retries safe.
+func IngestPatientHealthMetrics(c *gin.Context) {
+	patient, user, ok := authorizedPatient(c, "patientId")
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxIngestBytes)
+	body, err := c.GetRawData()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("request body exceeds the %d byte limit", maxIngestBytes)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	var batch MetricBatchRequest
+	if err := json.Unmarshal(body, &batch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	if len(batch.Readings) == 0 {
+		var single MetricReadingRequest
+		if err := json.Unmarshal(body, &single); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+			return
+		}
+		batch.Readings = []MetricReadingRequest{single}
+	}
+	if len(batch.Readings) > maxIngestBatch {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("at most %d readings per request", maxIngestBatch)})
+		return
+	}
+
+	key, ok := beginIdempotentRequest(c, user, body)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	results := make([]MetricReadingResult, len(batch.Readings))
+	created, duplicates, rejected := 0, 0, 0
+	for i, req := range batch.Readings {
+		results[i].Index = i
+
+		reading, errs := buildReading(patient.ID, req, now)
+		if errs.Any() {
+			results[i].Status = ReadingRejected
+			results[i].Errors = errs
+			rejected++
+			continue
+		}
+
+		// Devices re-send readings after reconnecting, so a reading from the same device at
+		// the same instant is only stored once. Concurrent retries that both pass this check
+		// are caught by the unique index Record inserts against.
+		if reading.DeviceID != "" {
+			existingID, err := existingDeviceReading(patient.ID, reading)
+			if err != nil {
+				log.Printf("Error checking for duplicate reading: %v", err)
+				respondIdempotent(c, key, http.StatusInternalServerError, gin.H{"error": "Failed to store readings"})
+				return
+			}
+			if existingID != 0 {
+				results[i].Status = ReadingDuplicate
+				results[i].ID = existingID
+				duplicates++
+				continue
+			}
+		}
+
+		stored, err := observations.Record(initializers.DB, reading)
+		if err != nil {
+			log.Printf("Error storing reading: %v", err)
+			respondIdempotent(c, key, http.StatusInternalServerError, gin.H{"error": "Failed to store readings"})
+			return
+		}
+		if len(stored) == 0 {
+			existingID, err := existingDeviceReading(patient.ID, reading)
+			if err != nil {
+				log.Printf("Error checking for duplicate reading: %v", err)
+			}
+			results[i].Status = ReadingDuplicate
+			results[i].ID = existingID
+			duplicates++
+			continue
+		}
+		results[i].Status = ReadingCreated
+		results[i].ID = stored[0].ID
+		created++
+
+		if err := pipeline.Process(initializers.DB, stored); err != nil {
+			log.Printf("Error processing reading: %v", err)
+		}
+	}
+
+	status := http.StatusCreated
+	switch {
+	case rejected == len(results):
+		status = http.StatusBadRequest
+	case rejected > 0:
+		status = http.StatusMultiStatus
+	case created == 0:
+		status = http.StatusOK
+	}
+
+	respondIdempotent(c, key, status, gin.H{
+		"created":    created,
+		"duplicates": duplicates,
+		"rejected":   rejected,
+		"results":    results,
+	})
+}
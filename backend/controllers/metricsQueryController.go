@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"my-health/initializers"
+	"my-health/models"
+	"my-health/services/derived"
+	"my-health/services/observations"
+	"my-health/services/timeseries"
+)
+
+// seriesQueryParams switch GetPatientHealthMetrics from raw rows to the column format
+var seriesQueryParams = []string{"from", "to", "metrics", "bucket", "agg", "tz"}
+
+func wantsSeriesQuery(c *gin.Context) bool {
+	for _, param := range seriesQueryParams {
+		if _, ok := c.GetQuery(param); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTimeParam accepts an RFC 3339 timestamp or a YYYY-MM-DD date in loc
+func parseTimeParam(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339 or YYYY-MM-DD", value)
+}
+
+// locationParam reads the tz query parameter, defaulting to UTC. It responds
+// with 400 and returns false if the zone is unknown.
+func locationParam(c *gin.Context) (*time.Location, bool) {
+	tz := c.Query("tz")
+	if tz == "" {
+		return time.UTC, true
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tz, expected an IANA time zone such as Europe/Athens"})
+		return nil, false
+	}
+	return loc, true
+}
+
+// splitList splits a comma separated query parameter, dropping blanks
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// respondHealthMetricSeries answers GetPatientHealthMetrics with compact column arrays,
+// e.g. ?from=2024-01-01&metrics=heart_rate,weight&bucket=day&agg=avg,max&tz=Europe/Athens.
+// Without a bucket the individual readings in the range are returned; bucket=auto
+// picks one from the length of the range. Derived
+// metrics (bmi, mean_arterial_pressure, pulse_pressure, sleep_efficiency) can be
+// asked for by name and come with their categories.
+func respondHealthMetricSeries(c *gin.Context, patient models.Patient) {
+	loc, ok := locationParam(c)
+	if !ok {
+		return
+	}
+
+	query := timeseries.Query{
+		PatientID:    patient.ID,
+		To:           time.Now(),
+		Metrics:      splitList(c.Query("metrics")),
+		Bucket:       c.Query("bucket"),
+		Aggregations: splitList(c.Query("agg")),
+		Location:     loc,
+		HeightCm:     patient.Height,
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := parseTimeParam(to, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query.To = t
+	}
+	// By default the last 30 days, from the start of a day so the rollups can answer
+	start := query.To.In(loc).AddDate(0, 0, -30)
+	query.From = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+	if from := c.Query("from"); from != "" {
+		t, err := parseTimeParam(from, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query.From = t
+	}
+	if err := query.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := timeseries.Run(initializers.DB, query)
+	if err != nil {
+		log.Printf("Error querying health metrics: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving metrics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"patient_id": patient.ID,
+		"from":       query.From,
+		"to":         query.To,
+		"bucket":     query.Bucket,
+		"time":       result.Time,
+		"series":     result.Series,
+		"units":      result.Units,
+		"categories": result.Categories,
+		"truncated":  result.Truncated,
+	})
+}
+
+// GetPatientDerivedMetrics returns BMI, mean arterial pressure, pulse pressure
+// and sleep efficiency computed from the patient's latest readings, each with
+// its category
+func GetPatientDerivedMetrics(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	latest, err := observations.Latest(initializers.DB, patient.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Error fetching latest readings: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving metrics"})
+		return
+	}
+
+	type DerivedValue struct {
+		Metric   string  `json:"metric"`
+		Value    float64 `json:"value"`
+		Unit     string  `json:"unit"`
+		Category string  `json:"category"`
+	}
+
+	values := derived.Values(latest, patient.Height)
+	result := []DerivedValue{}
+	for _, metric := range derived.Metrics() {
+		value, ok := values[metric]
+		if !ok {
+			continue
+		}
+		result = append(result, DerivedValue{
+			Metric:   metric,
+			Value:    math.Round(value*10) / 10,
+			Unit:     derived.Units[metric],
+			Category: derived.Classify(metric, value),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"patient_id": patient.ID, "date": latest.Date, "derived": result})
+}
@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"my-health/initializers"
+	"my-health/models"
+	"my-health/services/news2"
+)
+
+// GetPatientNews2 scores the patient's latest vitals with NEWS2, showing the
+// points for each parameter and the risk band
+func GetPatientNews2(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	result, err := news2.Current(initializers.DB, patient.ID, time.Now())
+	if err != nil {
+		log.Printf("Error computing NEWS2 for patient %d: %v", patient.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute NEWS2 score"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"news2": result})
+}
+
+// GetPatientNews2History lists the patient's stored NEWS2 scores over the last
+// ?days= (default 30), oldest first
+func GetPatientNews2History(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+	since, ok := reportSince(c, 30)
+	if !ok {
+		return
+	}
+
+	var scores []models.NewsScore
+	if err := initializers.DB.Where("patient_id = ? AND computed_at >= ?", patient.ID, since).
+		Order("computed_at, id").Limit(2000).Find(&scores).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch NEWS2 history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"history": scores})
+}
@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+
+	"my-health/initializers"
+	"my-health/models"
+	"my-health/services/notify"
+	"my-health/validation"
+)
+
+type NotificationPreferenceRequest struct {
+	Enabled         bool   `json:"enabled"`
+	Address         string `json:"address"`
+	QuietHoursStart string `json:"quietHoursStart"`
+	QuietHoursEnd   string `json:"quietHoursEnd"`
+	Timezone        string `json:"timezone"`
+}
+
+// validatePreference checks the address for the channel and the quiet hours,
+// and returns the normalised address. Webhook hosts are resolved to make sure
+// they are public.
+func validatePreference(ctx context.Context, channel string, req NotificationPreferenceRequest) (string, validation.Errors) {
+	errs := validation.Errors{}
+	address := strings.TrimSpace(req.Address)
+
+	switch channel {
+	case models.ChannelEmail:
+		if parsed, err := mail.ParseAddress(address); err != nil {
+			errs.Add("address", "must be a valid email address")
+		} else {
+			address = strings.ToLower(parsed.Address)
+		}
+	case models.ChannelSMS:
+		errs.Required("address", address)
+		address = errs.Phone("address", address)
+	case models.ChannelWebhook:
+		if err := notify.ValidateWebhookURL(ctx, address); err != nil {
+			errs.Add("address", err.Error())
+		}
+	case models.ChannelInApp:
+		address = ""
+	}
+
+	if (req.QuietHoursStart == "") != (req.QuietHoursEnd == "") {
+		errs.Add("quietHoursEnd", "quiet hours need both a start and an end")
+	}
+	if req.QuietHoursStart != "" && !notify.ValidClock(req.QuietHoursStart) {
+		errs.Add("quietHoursStart", "must be a time as HH:MM")
+	}
+	if req.QuietHoursEnd != "" && !notify.ValidClock(req.QuietHoursEnd) {
+		errs.Add("quietHoursEnd", "must be a time as HH:MM")
+	}
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			errs.Add("timezone", "must be an IANA time zone, e.g. Europe/Athens")
+		}
+	}
+	return address, errs
+}
+
+// GetNotificationPreferences lists the current user's channel settings
+func GetNotificationPreferences(c *gin.Context) {
+	user, ok := sessionUser(c)
+	if !ok {
+		return
+	}
+
+	var prefs []models.NotificationPreference
+	if err := initializers.DB.Where("user_id = ?", user.ID).Order("channel").Find(&prefs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"preferences": prefs})
+}
+
+// UpdateNotificationPreference creates or replaces the current user's settings for a channel
+func UpdateNotificationPreference(c *gin.Context) {
+	user, ok := sessionUser(c)
+	if !ok {
+		return
+	}
+
+	channel := c.Param("channel")
+	if !models.NotificationChannels[channel] {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown notification channel"})
+		return
+	}
+
+	var req NotificationPreferenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	address, errs := validatePreference(c.Request.Context(), channel, req)
+	if errs.Any() {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	pref := models.NotificationPreference{UserID: user.ID, Channel: channel}
+	if err := initializers.DB.Where(&pref).FirstOrInit(&pref).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification preference"})
+		return
+	}
+	pref.Enabled = req.Enabled
+	pref.Address = address
+	pref.QuietHoursStart = req.QuietHoursStart
+	pref.QuietHoursEnd = req.QuietHoursEnd
+	pref.Timezone = req.Timezone
+
+	if err := initializers.DB.Save(&pref).Error; err != nil {
+		log.Printf("Error saving notification preference: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save notification preference"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"preference": pref})
+}
+
+// GetInbox lists the current user's in-app notifications, newest first.
+// ?unread=true limits it to unread messages.
+func GetInbox(c *gin.Context) {
+	user, ok := sessionUser(c)
+	if !ok {
+		return
+	}
+
+	query := initializers.DB.Where("user_id = ?", user.ID)
+	if c.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var messages []models.InboxMessage
+	if err := query.Order("created_at DESC").Limit(100).Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+
+	var unread int64
+	if err := initializers.DB.Model(&models.InboxMessage{}).
+		Where("user_id = ? AND read_at IS NULL", user.ID).Count(&unread).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notifications": messages, "unread": unread})
+}
+
+// MarkInboxMessageRead marks one of the current user's in-app notifications as read
+func MarkInboxMessageRead(c *gin.Context) {
+	user, ok := sessionUser(c)
+	if !ok {
+		return
+	}
+
+	result := initializers.DB.Model(&models.InboxMessage{}).
+		Where("id = ? AND user_id = ? AND read_at IS NULL", c.Param("messageId"), user.ID).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unread notification not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": "Notification marked as read"})
+}
+
+// MarkInboxRead marks all of the current user's in-app notifications as read
+func MarkInboxRead(c *gin.Context) {
+	user, ok := sessionUser(c)
+	if !ok {
+		return
+	}
+
+	if err := initializers.DB.Model(&models.InboxMessage{}).
+		Where("user_id = ? AND read_at IS NULL", user.ID).
+		Update("read_at", time.Now()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": "Notifications marked as read"})
+}
+
+// GetNotificationDeliveries lists the current user's outgoing notifications
+// with their delivery state; ?status=dead shows the ones that failed
+func GetNotificationDeliveries(c *gin.Context) {
+	user, ok := sessionUser(c)
+	if !ok {
+		return
+	}
+
+	query := initializers.DB.Where("user_id = ?", user.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var deliveries []models.Notification
+	if err := query.Order("created_at DESC").Limit(100).Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// RetryNotificationDelivery queues a dead notification for another round of attempts
+func RetryNotificationDelivery(c *gin.Context) {
+	user, ok := sessionUser(c)
+	if !ok {
+		return
+	}
+
+	var notification models.Notification
+	if err := initializers.DB.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND user_id = ? AND status = ?", c.Param("notificationId"), user.ID, models.NotificationDead).
+		First(&notification).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed notification not found"})
+		return
+	}
+
+	if err := notify.Retry(initializers.DB, &notification); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry notification"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": "Notification queued for delivery"})
+}
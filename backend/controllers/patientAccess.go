@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"my-health/initializers"
+	"my-health/models"
+)
+
+// findPatient looks a patient up by ID, falling back to user_id like the patient routes do
+func findPatient(idParam string) (models.Patient, error) {
+	var patient models.Patient
+	err := initializers.DB.Where("id = ?", idParam).First(&patient).Error
+	if err != nil {
+		err = initializers.DB.Where("user_id = ?", idParam).First(&patient).Error
+	}
+	return patient, err
+}
+
+// canAccessPatient reports whether the user is the patient or the admin of a household the patient belongs to
+func canAccessPatient(user models.User, patient models.Patient) bool {
+	if patient.UserID == user.ID {
+		return true
+	}
+	if user.Role != "admin" {
+		return false
+	}
+
+	var count int64
+	if err := initializers.DB.Table("household_patients").
+		Joins("JOIN households ON households.id = household_patients.household_id").
+		Where("households.admin_id = ? AND household_patients.patient_id = ? AND households.deleted_at IS NULL", user.ID, patient.ID).
+		Count(&count).Error; err != nil {
+		log.Printf("Error checking household membership: %v", err)
+		return false
+	}
+	return count > 0
+}
+
+// authorizedPatient resolves the patient in the given URL parameter and checks that
+// the current user may access it. On failure the response has already been written.
+func authorizedPatient(c *gin.Context, param string) (models.Patient, models.User, bool) {
+	currentUser, exists := c.Get("currentUser")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return models.Patient{}, models.User{}, false
+	}
+	user := currentUser.(models.User)
+
+	patient, err := findPatient(c.Param(param))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+		return models.Patient{}, user, false
+	}
+
+	if !canAccessPatient(user, patient) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return models.Patient{}, user, false
+	}
+
+	return patient, user, true
+}
+
+// householdPatientIDs returns the IDs of all patients in the admin's household
+func householdPatientIDs(adminID uint) ([]uint, error) {
+	var ids []uint
+	err := initializers.DB.Table("household_patients").
+		Joins("JOIN households ON households.id = household_patients.household_id").
+		Where("households.admin_id = ? AND households.deleted_at IS NULL", adminID).
+		Pluck("household_patients.patient_id", &ids).Error
+	return ids, err
+}
+
+// currentAdmin returns the current user if they are an admin. On failure the response has already been written.
+func currentAdmin(c *gin.Context) (models.User, bool) {
+	currentUser, exists := c.Get("currentUser")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return models.User{}, false
+	}
+	admin := currentUser.(models.User)
+
+	if admin.Role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "user is not an admin"})
+		return models.User{}, false
+	}
+	return admin, true
+}
+
+// sessionUser returns the current user. On failure the response has already been written.
+func sessionUser(c *gin.Context) (models.User, bool) {
+	currentUser, exists := c.Get("currentUser")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return models.User{}, false
+	}
+	return currentUser.(models.User), true
+}
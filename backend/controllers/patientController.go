@@ -6,21 +6,23 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 
 	"my-health/initializers"
 	"my-health/models"
 	"my-health/services/mockhealth"
+	"my-health/services/news2"
+	"my-health/services/observations"
+	"my-health/services/pipeline"
+	"my-health/validation"
 )
 
 // ensurePatientMetrics checks and generates health metrics if needed
 func ensurePatientMetrics(patientID uint) error {
 	// Check for data in the last 30 days
 	thirtyDaysAgo := time.Now().AddDate(0, 0, -30)
-	var metrics []models.HealthMetrics
-
-	if err := initializers.DB.Where("patient_id = ? AND date >= ?", patientID, thirtyDaysAgo).
-		Order("date ASC").
-		Find(&metrics).Error; err != nil {
+	metrics, err := observations.Load(initializers.DB, patientID, thirtyDaysAgo, time.Now().Add(time.Minute))
+	if err != nil {
 		return err
 	}
 
@@ -53,11 +55,6 @@ func ensurePatientMetrics(patientID uint) error {
 	return nil
 }
 
-// validateBloodPressure checks if blood pressure values are within normal range
-func validateBloodPressure(systolic, diastolic int) bool {
-	return systolic >= 70 && systolic <= 190 && diastolic >= 40 && diastolic <= 130
-}
-
 type EmergencyContactRequest struct {
 	Name         string `json:"name"`
 	Relationship string `json:"relationship"`
@@ -98,14 +95,59 @@ func UpdatePatient(c *gin.Context) {
 		return
 	}
 
-	// Validate blood pressure if provided
+	// Validate and normalise every field before touching the database
+	errs := validation.Errors{}
+	errs.Required("name", requestBody.Name)
+	errs.MaxLength("name", requestBody.Name, validation.MaxNameLength)
+	errs.Required("surname", requestBody.Surname)
+	errs.MaxLength("surname", requestBody.Surname, validation.MaxNameLength)
+	errs.MaxLength("address", requestBody.Address, validation.MaxAddressLength)
+	errs.MaxLength("medicalRecord", requestBody.MedicalRecord, validation.MaxRecordNumberLength)
+	errs.MaxLength("medicalHistory", requestBody.MedicalHistory, validation.MaxClinicalTextLength)
+	errs.MaxLength("allergies", requestBody.Allergies, validation.MaxClinicalTextLength)
+	errs.MaxLength("medications", requestBody.Medications, validation.MaxClinicalTextLength)
+
+	dateOfBirth, err := time.Parse("2006-01-02", requestBody.DateOfBirth)
+	if err != nil {
+		errs.Add("dateOfBirth", "must be a date in YYYY-MM-DD format")
+	} else if err := validation.DateOfBirth(dateOfBirth, time.Now()); err != nil {
+		errs.Add("dateOfBirth", err.Error())
+	}
+
+	if requestBody.Gender != "" {
+		gender, ok := validation.Gender(requestBody.Gender)
+		if !ok {
+			errs.Add("gender", "must be one of male, female, other, prefer_not_to_say")
+		}
+		requestBody.Gender = gender
+	}
+	if requestBody.BloodType != "" {
+		bloodType, ok := validation.BloodType(requestBody.BloodType)
+		if !ok {
+			errs.Add("bloodType", "must be one of A+, A-, B+, B-, AB+, AB-, O+, O-")
+		}
+		requestBody.BloodType = bloodType
+	}
+	errs.Height("height", requestBody.Height)
+
+	errs.MaxLength("emergencyContact.name", requestBody.EmergencyContact.Name, validation.MaxNameLength)
+	errs.MaxLength("emergencyContact.relationship", requestBody.EmergencyContact.Relationship, validation.MaxRelationshipLength)
+	requestBody.EmergencyContact.PhoneNumber = errs.Phone("emergencyContact.phoneNumber", requestBody.EmergencyContact.PhoneNumber)
+
+	errs.Weight("healthMetrics.weight", requestBody.HealthMetrics.Weight)
+	errs.HeartRate("healthMetrics.heartRate", requestBody.HealthMetrics.HeartRate)
+	errs.OxygenSaturation("healthMetrics.oxygenSaturation", requestBody.HealthMetrics.OxygenSaturation)
 	if requestBody.HealthMetrics.SystolicBP != 0 || requestBody.HealthMetrics.DiastolicBP != 0 {
-		if !validateBloodPressure(requestBody.HealthMetrics.SystolicBP, requestBody.HealthMetrics.DiastolicBP) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid blood pressure values"})
-			return
+		if !validation.BloodPressure(requestBody.HealthMetrics.SystolicBP, requestBody.HealthMetrics.DiastolicBP) {
+			errs.Add("healthMetrics.bloodPressure", "systolic must be 70-190 and diastolic 40-130 mmHg, with systolic above diastolic")
 		}
 	}
 
+	if errs.Any() {
+		respondValidationErrors(c, errs)
+		return
+	}
+
 	var patient models.Patient
 	// First try to find by ID
 	result := initializers.DB.Where("id = ?", patientID).First(&patient)
@@ -146,12 +188,6 @@ func UpdatePatient(c *gin.Context) {
 	// Log which patient we're updating
 	log.Printf("Updating patient - ID: %d, UserID: %d", patient.ID, patient.UserID)
 
-	// Parse and validate date of birth
-	dateOfBirth, err := time.Parse("2006-01-02", requestBody.DateOfBirth)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format for date of birth"})
-		return
-	}
 	patient.DateOfBirth = dateOfBirth
 
 	// Update basic information and log the data types
@@ -208,6 +244,7 @@ func UpdatePatient(c *gin.Context) {
 	}
 
 	// Update or create health metrics if provided
+	var recorded []models.Observation
 	if requestBody.HealthMetrics.Weight != 0 ||
 		requestBody.HealthMetrics.BloodPressure != "" {
 
@@ -216,41 +253,39 @@ func UpdatePatient(c *gin.Context) {
 			lastCheckup = time.Now()
 		}
 
-		// Try to find existing health metrics
-		var healthMetrics models.HealthMetrics
-		result := tx.Where("patient_id = ?", patient.ID).Order("created_at desc").First(&healthMetrics)
-
-		if result.Error != nil {
-			// Create new health metrics if none exist
-			healthMetrics = models.HealthMetrics{
-				PatientID:        patient.ID,
-				Weight:           requestBody.HealthMetrics.Weight,
-				HeartRate:        requestBody.HealthMetrics.HeartRate,
-				SystolicBP:       requestBody.HealthMetrics.SystolicBP,
-				DiastolicBP:      requestBody.HealthMetrics.DiastolicBP,
-				OxygenSaturation: requestBody.HealthMetrics.OxygenSaturation,
-				BloodPressure:    requestBody.HealthMetrics.BloodPressure,
-				Date:             lastCheckup,
-			}
-			if err := tx.Create(&healthMetrics).Error; err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create health metrics"})
-				return
+		// Record the values as manual readings, skipping any that match the latest
+		// reading so saving the profile again doesn't duplicate them
+		reading := models.HealthMetrics{
+			PatientID:        patient.ID,
+			Date:             lastCheckup,
+			Weight:           requestBody.HealthMetrics.Weight,
+			HeartRate:        requestBody.HealthMetrics.HeartRate,
+			SystolicBP:       requestBody.HealthMetrics.SystolicBP,
+			DiastolicBP:      requestBody.HealthMetrics.DiastolicBP,
+			OxygenSaturation: requestBody.HealthMetrics.OxygenSaturation,
+			BloodPressure:    requestBody.HealthMetrics.BloodPressure,
+			Source:           "manual",
+		}
+		latest, err := observations.Latest(tx, patient.ID)
+		if err != nil && err != gorm.ErrRecordNotFound {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update health metrics"})
+			return
+		}
+		var changed []models.Observation
+		for _, observation := range observations.Split(reading) {
+			if observations.SameAsLatest(observation, latest) {
+				continue
 			}
-		} else {
-			// Update existing health metrics
-			healthMetrics.Weight = requestBody.HealthMetrics.Weight
-			healthMetrics.HeartRate = requestBody.HealthMetrics.HeartRate
-			healthMetrics.SystolicBP = requestBody.HealthMetrics.SystolicBP
-			healthMetrics.DiastolicBP = requestBody.HealthMetrics.DiastolicBP
-			healthMetrics.OxygenSaturation = requestBody.HealthMetrics.OxygenSaturation
-			healthMetrics.BloodPressure = requestBody.HealthMetrics.BloodPressure
-			healthMetrics.Date = lastCheckup
-			if err := tx.Save(&healthMetrics).Error; err != nil {
+			changed = append(changed, observation)
+		}
+		if len(changed) > 0 {
+			if err := tx.Create(&changed).Error; err != nil {
 				tx.Rollback()
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update health metrics"})
 				return
 			}
+			recorded = changed
 		}
 	}
 
@@ -264,6 +299,10 @@ func UpdatePatient(c *gin.Context) {
 	}
 	log.Printf("Transaction committed successfully")
 
+	if err := pipeline.Process(initializers.DB, recorded); err != nil {
+		log.Printf("Error processing manual reading: %v", err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Patient updated successfully",
 		"patient": gin.H{
@@ -334,10 +373,8 @@ func GetPatientDetails(c *gin.Context) {
 	}
 
 	// Get latest health metrics
-	var healthMetrics models.HealthMetrics
-	if err := initializers.DB.Where("patient_id = ?", patient.ID).
-		Order("date DESC").
-		First(&healthMetrics).Error; err != nil {
+	healthMetrics, err := observations.Latest(initializers.DB, patient.ID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve health metrics"})
 		return
 	}
@@ -375,12 +412,29 @@ func GetPatientDetails(c *gin.Context) {
 		"relationship": patient.EmergencyContact.Relationship,
 		"phoneNumber":  patient.EmergencyContact.PhoneNumber,
 	}
+	// Prefer the last completed checkup appointment over the metrics date
+	lastCheckup := healthMetrics.Date
+	var checkup models.Appointment
+	if err := initializers.DB.Where("patient_id = ? AND type = ? AND status = ?", patient.ID, "checkup", models.AppointmentCompleted).
+		Order("start_time DESC").
+		First(&checkup).Error; err == nil {
+		lastCheckup = checkup.StartTime
+	}
+
 	patientData["healthMetrics"] = gin.H{
 		"weight":        healthMetrics.Weight,
 		"heartRate":     healthMetrics.HeartRate,
 		"bloodPressure": healthMetrics.BloodPressure,
-		"lastCheckup":   healthMetrics.Date.Format("2006-01-02"),
+		"lastCheckup":   lastCheckup.Format("2006-01-02"),
+	}
+
+	news, err := news2.Current(initializers.DB, patient.ID, time.Now())
+	if err != nil {
+		log.Printf("Error computing NEWS2 for patient %d: %v", patient.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute NEWS2 score"})
+		return
 	}
+	patientData["news2"] = news
 
 	log.Printf("Final patient data: %+v", patientData)
 
@@ -441,14 +495,15 @@ func GetPatientHealthMetrics(c *gin.Context) {
 		return
 	}
 
+	if wantsSeriesQuery(c) {
+		respondHealthMetricSeries(c, patient)
+		return
+	}
+
 	// Get the last 30 days of metrics
-	var metrics []models.HealthMetrics
 	thirtyDaysAgo := time.Now().AddDate(0, 0, -30).Truncate(24 * time.Hour)
-	result := initializers.DB.Where("patient_id = ? AND date >= ?", patient.ID, thirtyDaysAgo).
-		Order("date ASC").
-		Find(&metrics)
-
-	if result.Error != nil {
+	metrics, err := observations.Load(initializers.DB, patient.ID, thirtyDaysAgo, time.Now().Add(time.Minute))
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving metrics"})
 		return
 	}
@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"my-health/initializers"
+	"my-health/models"
+)
+
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+)
+
+// fullNameExpr is the expression the trigram index on patients is built on
+const fullNameExpr = "lower(patients.name || ' ' || patients.surname)"
+
+// patientSort describes one sort order of the patient search. Every order is
+// made stable by falling back to the patient ID in the same direction.
+type patientSort struct {
+	expr    string
+	desc    bool
+	sqlType string // type the cursor value is cast back to
+}
+
+var patientSorts = map[string]patientSort{
+	"name":     {expr: "lower(patients.surname || ' ' || patients.name)", sqlType: "text"},
+	"-name":    {expr: "lower(patients.surname || ' ' || patients.name)", desc: true, sqlType: "text"},
+	"age":      {expr: "patients.date_of_birth", desc: true, sqlType: "timestamptz"}, // youngest first
+	"-age":     {expr: "patients.date_of_birth", sqlType: "timestamptz"},
+	"created":  {expr: "patients.created_at", sqlType: "timestamptz"},
+	"-created": {expr: "patients.created_at", desc: true, sqlType: "timestamptz"},
+}
+
+// patientCursor marks the position of the last patient on a page
+type patientCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+func encodePatientCursor(cursor patientCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePatientCursor(value string) (patientCursor, error) {
+	var cursor patientCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
+
+type patientSearchRow struct {
+	models.Patient
+	SortValue string
+}
+
+type PatientSearchResult struct {
+	ID              uint   `json:"id"`
+	Name            string `json:"name"`
+	Surname         string `json:"surname"`
+	Age             *int   `json:"age"`
+	Gender          string `json:"gender"`
+	BloodType       string `json:"bloodType"`
+	ProfileComplete bool   `json:"profileComplete"`
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// looksLikePhoneNumber reports whether a search term should also be matched against phone numbers
+func looksLikePhoneNumber(q string) bool {
+	digits := 0
+	for _, r := range q {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case strings.ContainsRune("+ -()", r):
+		default:
+			return false
+		}
+	}
+	return digits >= 8
+}
+
+// SearchPatients finds patients across the admin's households with filters, sorting and cursor pagination
+func SearchPatients(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	limit := defaultSearchPageSize
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxSearchPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxSearchPageSize)})
+			return
+		}
+		limit = parsed
+	}
+
+	q := strings.TrimSpace(c.Query("q"))
+	sortName := c.Query("sort")
+	if sortName == "" {
+		sortName = "name"
+		if q != "" {
+			sortName = "relevance"
+		}
+	}
+
+	var sort patientSort
+	var sortArgs []interface{}
+	if sortName == "relevance" {
+		if q == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sort=relevance requires q"})
+			return
+		}
+		sort = patientSort{expr: "word_similarity(lower(?), " + fullNameExpr + ")", desc: true, sqlType: "real"}
+		sortArgs = []interface{}{q}
+	} else {
+		var found bool
+		sort, found = patientSorts[sortName]
+		if !found {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort"})
+			return
+		}
+	}
+
+	var cursor *patientCursor
+	if value := c.Query("cursor"); value != "" {
+		decoded, err := decodePatientCursor(value)
+		if err != nil || decoded.Sort != sortName {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		cursor = &decoded
+	}
+
+	patientIDs, err := householdPatientIDs(admin.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch household"})
+		return
+	}
+	if len(patientIDs) == 0 {
+		c.JSON(http.StatusOK, gin.H{"patients": []PatientSearchResult{}, "next_cursor": nil})
+		return
+	}
+
+	base := initializers.DB.Table("patients").
+		Where("patients.deleted_at IS NULL AND patients.id IN ?", patientIDs)
+
+	if q != "" {
+		nameMatch := initializers.DB.
+			Where("lower(?) <% "+fullNameExpr, q).
+			Or(fullNameExpr+" LIKE lower(?)", "%"+escapeLike(q)+"%")
+		if looksLikePhoneNumber(q) {
+			if index, err := models.PhoneBlindIndex(q); err == nil && index != "" {
+				nameMatch = nameMatch.Or("patients.emergency_contact_phone_index = ?", index)
+			}
+		}
+		base = base.Where(nameMatch)
+	}
+	if gender := c.Query("gender"); gender != "" {
+		base = base.Where("lower(patients.gender) = lower(?)", gender)
+	}
+	if bloodType := c.Query("blood_type"); bloodType != "" {
+		base = base.Where("upper(patients.blood_type) = upper(?)", bloodType)
+	}
+	now := time.Now()
+	if value := c.Query("min_age"); value != "" {
+		minAge, err := strconv.Atoi(value)
+		if err != nil || minAge < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid min_age"})
+			return
+		}
+		base = base.Where("patients.date_of_birth <= ?", now.AddDate(-minAge, 0, 0))
+	}
+	if value := c.Query("max_age"); value != "" {
+		maxAge, err := strconv.Atoi(value)
+		if err != nil || maxAge < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid max_age"})
+			return
+		}
+		base = base.Where("patients.date_of_birth > ?", now.AddDate(-maxAge-1, 0, 0))
+	}
+	if c.Query("complete") == "true" {
+		base = base.Where("patients.name <> '' AND patients.surname <> ''")
+	}
+
+	// Medical history is encrypted, so the condition filter runs after decryption
+	condition := strings.ToLower(strings.TrimSpace(c.Query("condition")))
+
+	direction, comparison := "ASC", ">"
+	if sort.desc {
+		direction, comparison = "DESC", "<"
+	}
+	fetch := func(position *patientCursor, size int) ([]patientSearchRow, error) {
+		query := base.Session(&gorm.Session{}).
+			Select("patients.*, ("+sort.expr+")::text AS sort_value", sortArgs...)
+		if position != nil {
+			args := append(append([]interface{}{}, sortArgs...), position.Value, position.ID)
+			query = query.Where(fmt.Sprintf("((%s), patients.id) %s (?::%s, ?)", sort.expr, comparison, sort.sqlType), args...)
+		}
+		var rows []patientSearchRow
+		err := query.
+			Clauses(clause.OrderBy{Expression: clause.Expr{
+				SQL:                fmt.Sprintf("(%s) %s, patients.id %s", sort.expr, direction, direction),
+				Vars:               sortArgs,
+				WithoutParentheses: true,
+			}}).
+			Limit(size).
+			Scan(&rows).Error
+		return rows, err
+	}
+
+	// Fetch one extra match to know whether there is a next page
+	var matches []patientSearchRow
+	position := cursor
+	batchSize := limit + 1
+	if condition != "" {
+		batchSize = limit * 4
+	}
+	for len(matches) <= limit {
+		rows, err := fetch(position, batchSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search patients"})
+			return
+		}
+		for _, row := range rows {
+			if condition == "" || strings.Contains(strings.ToLower(row.MedicalHistory), condition) {
+				matches = append(matches, row)
+			}
+		}
+		if len(rows) < batchSize {
+			break
+		}
+		last := rows[len(rows)-1]
+		position = &patientCursor{Sort: sortName, Value: last.SortValue, ID: last.ID}
+	}
+
+	var nextCursor *string
+	if len(matches) > limit {
+		matches = matches[:limit]
+		last := matches[limit-1]
+		encoded := encodePatientCursor(patientCursor{Sort: sortName, Value: last.SortValue, ID: last.ID})
+		nextCursor = &encoded
+	}
+
+	results := make([]PatientSearchResult, 0, len(matches))
+	for _, row := range matches {
+		result := PatientSearchResult{
+			ID:              row.ID,
+			Name:            row.Name,
+			Surname:         row.Surname,
+			Gender:          row.Gender,
+			BloodType:       row.BloodType,
+			ProfileComplete: row.Name != "" && row.Surname != "" && !row.DateOfBirth.IsZero(),
+		}
+		if !row.DateOfBirth.IsZero() {
+			age := row.Age()
+			result.Age = &age
+		}
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"patients": results, "next_cursor": nextCursor})
+}
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"my-health/initializers"
+	"my-health/services/summary"
+)
+
+// GetPatientSummary reports how the patient's week or month went:
+// ?period=week|month (default week), ?end=YYYY-MM-DD for the last day of the
+// period (default today) and ?tz= for the time zone days are counted in
+func GetPatientSummary(c *gin.Context) {
+	patient, _, ok := authorizedPatient(c, "id")
+	if !ok {
+		return
+	}
+
+	loc := time.UTC
+	if tz := c.Query("tz"); tz != "" {
+		parsed, err := time.LoadLocation(tz)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tz, expected an IANA time zone such as Europe/Athens"})
+			return
+		}
+		loc = parsed
+	}
+
+	end := time.Now()
+	if value := c.Query("end"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end, expected YYYY-MM-DD"})
+			return
+		}
+		end = parsed
+	}
+
+	window, err := summary.NewWindow(c.DefaultQuery("period", summary.PeriodWeek), end, loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := summary.ForPatient(initializers.DB, patient.ID, window, loc)
+	if err != nil {
+		log.Printf("Error building summary for patient %d: %v", patient.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build summary"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"summary": report})
+}
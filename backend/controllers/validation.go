@@ -0,0 +1,17 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"my-health/validation"
+)
+
+// respondValidationErrors writes the standard envelope for per-field validation errors
+func respondValidationErrors(c *gin.Context, errs validation.Errors) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":  "validation failed",
+		"fields": errs,
+	})
+}
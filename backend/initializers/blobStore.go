@@ -0,0 +1,19 @@
+package initializers
+
+import (
+	"log"
+
+	"my-health/services/blobstore"
+)
+
+var Blobs blobstore.BlobStore
+
+func ConnectBlobStore() {
+	store, err := blobstore.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to set up blob store: %v", err)
+	}
+
+	Blobs = store
+	log.Println("Blob store ready")
+}
@@ -25,7 +25,16 @@ func ConnectDatabase() {
 		log.Fatalf("Failed to connect to DB: %v", err)
 	}
 	if err := database.AutoMigrate(&models.User{}, &models.Patient{}, &models.Household{},
-		&models.Invitation{}, &models.HealthMetrics{},
+		&models.Invitation{}, &models.HealthMetrics{}, &models.PatientContact{},
+		&models.MedicalDocument{}, &models.Appointment{}, &models.AppointmentReminder{},
+		&models.CareNote{}, &models.CareNoteRevision{}, &models.CarePlan{}, &models.CareGoal{},
+		&models.Immunization{}, &models.LabResult{},
+		&models.IdempotencyKey{}, &models.Observation{},
+		&models.Alert{}, &models.AlertThreshold{}, &models.AlertEvent{},
+		&models.EscalationPolicy{}, &models.EscalationStep{},
+		&models.MetricBaseline{}, &models.DeviationFlag{}, &models.NewsScore{},
+		&models.MetricRollup{}, &models.RollupDirty{}, &models.ObservationArchive{}, &models.ImportBatch{},
+		&models.Notification{}, &models.NotificationPreference{}, &models.InboxMessage{},
 	); err != nil {
 		panic(err)
 	}
@@ -40,8 +49,93 @@ func SyncDatabase() {
 		&models.Household{},
 		&models.HealthMetrics{},
 		&models.Invitation{},
+		&models.PatientContact{},
+		&models.MedicalDocument{},
+		&models.Appointment{},
+		&models.AppointmentReminder{},
+		&models.CareNote{},
+		&models.CareNoteRevision{},
+		&models.CarePlan{},
+		&models.CareGoal{},
+		&models.Immunization{},
+		&models.LabResult{},
+		&models.IdempotencyKey{},
+		&models.Observation{},
+		&models.Alert{},
+		&models.AlertThreshold{},
+		&models.AlertEvent{},
+		&models.EscalationPolicy{},
+		&models.EscalationStep{},
+		&models.MetricBaseline{},
+		&models.DeviationFlag{},
+		&models.NewsScore{},
+		&models.MetricRollup{},
+		&models.RollupDirty{},
+		&models.ObservationArchive{},
+		&models.ImportBatch{},
+		&models.Notification{},
+		&models.NotificationPreference{},
+		&models.InboxMessage{},
 	)
 	if err != nil {
 		log.Fatal("Failed to sync database:", err)
 	}
+
+	createSearchIndexes()
+	createObservationIndexes()
+}
+
+// createSearchIndexes adds the full-text search columns AutoMigrate can't express
+func createSearchIndexes() {
+	statements := []string{
+		`ALTER TABLE care_notes ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (
+				setweight(to_tsvector('english', coalesce(category, '')), 'B') ||
+				setweight(to_tsvector('english', coalesce(body, '')), 'A')
+			) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_care_notes_search ON care_notes USING GIN (search_vector)`,
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+		`CREATE INDEX IF NOT EXISTS idx_patients_full_name_trgm ON patients
+			USING GIN (lower(name || ' ' || surname) gin_trgm_ops)`,
+	}
+	for _, statement := range statements {
+		if err := DB.Exec(statement).Error; err != nil {
+			log.Fatal("Failed to create search indexes:", err)
+		}
+	}
+}
+
+// createObservationIndexes adds the partial unique index that stops a device's
+// re-sent reading from being stored twice. Duplicates stored before the index
+// existed are soft-deleted first, keeping the oldest, and their hours are
+// marked for a rollup rebuild.
+func createObservationIndexes() {
+	statements := []string{
+		`WITH removed AS (
+			UPDATE observations SET deleted_at = now()
+			WHERE id IN (
+				SELECT id FROM (
+					SELECT id, row_number() OVER (
+						PARTITION BY patient_id, device_id, effective_at, metric ORDER BY id
+					) AS n
+					FROM observations
+					WHERE device_id <> '' AND deleted_at IS NULL
+				) ranked
+				WHERE n > 1
+			)
+			RETURNING patient_id, effective_at
+		)
+		INSERT INTO rollup_dirty (patient_id, hour, created_at)
+		SELECT DISTINCT patient_id, date_trunc('hour', effective_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', now()
+		FROM removed
+		ON CONFLICT DO NOTHING`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_observations_device_reading
+			ON observations (patient_id, device_id, effective_at, metric)
+			WHERE device_id <> '' AND deleted_at IS NULL`,
+	}
+	for _, statement := range statements {
+		if err := DB.Exec(statement).Error; err != nil {
+			log.Fatal("Failed to create observation indexes:", err)
+		}
+	}
 }
@@ -0,0 +1,40 @@
+package initializers
+
+import (
+	"log"
+	"strings"
+
+	"my-health/models"
+	"my-health/services/fieldcrypt"
+	"my-health/utils"
+)
+
+// fieldKeys provides the models' data keys and blind indexes from the loaded keyring
+type fieldKeys struct{}
+
+func (fieldKeys) NewDataKey() (string, error) {
+	return fieldcrypt.NewDataKey()
+}
+
+// PhoneBlindIndex hashes the digits of the number's E.164 form. Text that is
+// not a valid number, such as a partial one typed into a search, falls back
+// to its plain digits.
+func (fieldKeys) PhoneBlindIndex(phone string) (string, error) {
+	if normalized, err := utils.NormalizePhoneNumber(phone); err == nil {
+		phone = normalized
+	}
+	var digits strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	return fieldcrypt.BlindIndex(digits.String())
+}
+
+func LoadEncryptionKeys() {
+	if err := fieldcrypt.LoadFromEnv(); err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+	models.RegisterKeyProvider(fieldKeys{})
+}
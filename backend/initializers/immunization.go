@@ -0,0 +1,25 @@
+package initializers
+
+import (
+	"log"
+	"os"
+
+	"my-health/services/immunization"
+)
+
+// LoadImmunizationSchedule replaces the default vaccine schedule with the one in
+// IMMUNIZATION_SCHEDULE_FILE, if set
+func LoadImmunizationSchedule() {
+	path := os.Getenv("IMMUNIZATION_SCHEDULE_FILE")
+	if path == "" {
+		return
+	}
+
+	rules, err := immunization.LoadSchedule(path)
+	if err != nil {
+		log.Fatalf("Failed to load immunization schedule: %v", err)
+	}
+
+	immunization.SetSchedule(rules)
+	log.Printf("Loaded %d immunization rules from %s", len(rules), path)
+}
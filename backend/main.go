@@ -7,23 +7,30 @@ import (
 
 	"my-health/initializers"
 	"my-health/routes"
+	"my-health/services/alerts"
+	"my-health/services/imports"
+	"my-health/services/notify"
+	"my-health/services/reminders"
+	"my-health/services/timeseries"
 )
 
 func init() {
 	initializers.LoadEnvs()
+	initializers.LoadEncryptionKeys()
 	initializers.ConnectDatabase()
 	initializers.SyncDatabase()
-
+	initializers.ConnectBlobStore()
+	initializers.LoadImmunizationSchedule()
 }
 
 // CORS Middleware
 func CORS(c *gin.Context) {
 	c.Header("Access-Control-Allow-Origin", "http://localhost:3000") // specify frontend origin explicitly
 	c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	c.Header("Access-Control-Allow-Headers", "Authorization, Content-Type")
+	c.Header("Access-Control-Allow-Headers", "Authorization, Content-Type, Idempotency-Key")
 	c.Header("Access-Control-Allow-Credentials", "true")
 	c.Header("Access-Control-Max-Age", "43200") // 12 hours in seconds
-	c.Header("Access-Control-Expose-Headers", "Authorization")
+	c.Header("Access-Control-Expose-Headers", "Authorization, Idempotent-Replayed")
 
 	// Handle OPTIONS requests
 	if c.Request.Method == "OPTIONS" {
@@ -39,5 +46,11 @@ func main() {
 	router.Use(CORS)
 	routes.SetupRoutes(router)
 
+	notify.StartWorker(initializers.DB, notify.ChannelsFromEnv(initializers.DB))
+	alerts.StartEscalationWorker(initializers.DB)
+	reminders.StartReminderWorker(reminders.QueueNotifier{})
+	timeseries.StartRollupWorker(initializers.DB, timeseries.RetentionFromEnv())
+	imports.StartWorker(initializers.DB, initializers.Blobs)
+
 	router.Run(":8080")
 }
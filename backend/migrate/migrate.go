@@ -3,19 +3,108 @@ package main
 import (
 	"log"
 
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
 	"my-health/initializers"
+	"my-health/models"
+	"my-health/services/observations"
+	"my-health/utils"
 )
 
 func init() {
 	initializers.LoadEnvs()
+	initializers.LoadEncryptionKeys()
 	initializers.ConnectDatabase()
 }
 
+// migrateEmergencyContacts copies the single embedded emergency contact of each
+// patient into the patient_contacts list, for patients that have no contacts yet
+func migrateEmergencyContacts() error {
+	var patients []models.Patient
+	if err := initializers.DB.
+		Where("emergency_contact_emergency_contact_name <> ''").
+		Where("NOT EXISTS (SELECT 1 FROM patient_contacts pc WHERE pc.patient_id = patients.id AND pc.deleted_at IS NULL)").
+		Find(&patients).Error; err != nil {
+		return err
+	}
+
+	for _, patient := range patients {
+		contact := models.PatientContact{
+			PatientID:        patient.ID,
+			Name:             patient.EmergencyContact.Name,
+			Relationship:     patient.EmergencyContact.Relationship,
+			PreferredChannel: models.ContactChannelPhone,
+			ReceiveAlerts:    true,
+		}
+		if patient.EmergencyContact.PhoneNumber != "" {
+			// Keep the number as entered if it cannot be normalised
+			number, err := utils.NormalizePhoneNumber(patient.EmergencyContact.PhoneNumber)
+			if err != nil {
+				number = patient.EmergencyContact.PhoneNumber
+			}
+			contact.PhoneNumbers = []models.ContactPhone{{Label: "mobile", Number: number}}
+		}
+		if err := initializers.DB.Create(&contact).Error; err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Migrated %d emergency contacts", len(patients))
+	return nil
+}
+
+// migrateHealthMetrics converts each wide health_metrics row into one observation
+// per measured metric and points care notes at the converted readings. Each batch
+// is stored in one transaction, so a row is either fully converted or not at all;
+// rows that were already converted are skipped, so it is safe to run again.
+// Readings a device sent twice are stored once, as the unique index on device
+// readings requires.
+func migrateHealthMetrics() error {
+	rows := 0
+	var batch []models.HealthMetrics
+	err := initializers.DB.
+		Where("NOT EXISTS (SELECT 1 FROM observations o WHERE o.legacy_metrics_id = health_metrics.id)").
+		FindInBatches(&batch, 200, func(tx *gorm.DB, _ int) error {
+			var converted []models.Observation
+			for _, row := range batch {
+				converted = append(converted, observations.Split(row)...)
+			}
+			rows += len(batch)
+			if len(converted) == 0 {
+				return nil
+			}
+			return initializers.DB.Transaction(func(tx *gorm.DB) error {
+				return tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(converted, 500).Error
+			})
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	if err := initializers.DB.Exec(`UPDATE care_notes SET observation_id = (
+			SELECT MIN(o.id) FROM observations o WHERE o.legacy_metrics_id = care_notes.health_metrics_id
+		) WHERE observation_id IS NULL AND health_metrics_id IS NOT NULL`).Error; err != nil {
+		return err
+	}
+
+	log.Printf("Converted %d health metrics rows to observations", rows)
+	return nil
+}
+
 func main() {
 	log.Println("Starting database migration...")
 
 	// Use the SyncDatabase function which already includes all models
 	initializers.SyncDatabase()
 
+	if err := migrateEmergencyContacts(); err != nil {
+		log.Fatalf("Failed to migrate emergency contacts: %v", err)
+	}
+
+	if err := migrateHealthMetrics(); err != nil {
+		log.Fatalf("Failed to migrate health metrics: %v", err)
+	}
+
 	log.Println("Database migration completed successfully")
 }
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Alert severities, in increasing order of urgency
+const (
+	AlertInfo     = "info"
+	AlertWarning  = "warning"
+	AlertCritical = "critical"
+)
+
+// AlertSeverityRank orders severities so a repeated alert can only be raised, never lowered
+var AlertSeverityRank = map[string]int{
+	AlertInfo:     1,
+	AlertWarning:  2,
+	AlertCritical: 3,
+}
+
+// Alert statuses. Resolved and false-positive alerts are closed.
+const (
+	AlertOpen          = "open"
+	AlertAcknowledged  = "acknowledged"
+	AlertAssigned      = "assigned"
+	AlertResolved      = "resolved"
+	AlertFalsePositive = "false_positive"
+)
+
+// Alert is raised when a reading breaks one of the patient's alert rules. While
+// it is open, further breaches of the same rule are counted on it instead of
+// raising new alerts; once closed, the rule stays quiet until CooldownUntil.
+type Alert struct {
+	gorm.Model
+	PatientID     uint       `json:"patient_id" gorm:"not null;index;uniqueIndex:idx_alerts_active_rule,where:closed_at IS NULL"`
+	RuleKey       string     `json:"rule_key" gorm:"not null;uniqueIndex:idx_alerts_active_rule,where:closed_at IS NULL"`
+	Metric        string     `json:"metric"`
+	Severity      string     `json:"severity" gorm:"not null;index"`
+	Status        string     `json:"status" gorm:"not null;default:open;index"`
+	Message       string     `json:"message"`
+	Value         float64    `json:"value"`
+	Threshold     float64    `json:"threshold"`
+	ObservationID uint       `json:"observation_id"`
+	Occurrences   int        `json:"occurrences" gorm:"not null;default:1"`
+	FirstSeenAt   time.Time  `json:"first_seen_at"`
+	LastSeenAt    time.Time  `json:"last_seen_at"`
+	CooldownUntil time.Time  `json:"cooldown_until"`
+	ClosedAt      *time.Time `json:"closed_at" gorm:"index"`
+
+	// AcknowledgedAt is when a caregiver first acted on the alert, whether
+	// acknowledging, assigning or closing it
+	AcknowledgedAt   *time.Time `json:"acknowledged_at"`
+	AcknowledgedByID *uint      `json:"acknowledged_by_id"`
+	AssignedToID     *uint      `json:"assigned_to_id" gorm:"index"`
+	// EscalationPolicyID is the household policy escalating this alert, and
+	// EscalationStep how many of its steps have run. NextEscalationAt is when
+	// the next step is due; it is kept in the database so that pending
+	// escalations survive a restart.
+	EscalationPolicyID *uint      `json:"escalation_policy_id"`
+	EscalationStep     int        `json:"escalation_step"`
+	NextEscalationAt   *time.Time `json:"next_escalation_at" gorm:"index"`
+}
+
+// Alert timeline event types
+const (
+	AlertEventRaised        = "raised"
+	AlertEventEscalated     = "escalated"
+	AlertEventSkipped       = "escalation_skipped"
+	AlertEventAcknowledged  = "acknowledged"
+	AlertEventAssigned      = "assigned"
+	AlertEventResolved      = "resolved"
+	AlertEventFalsePositive = "false_positive"
+)
+
+// AlertEvent is one entry on an alert's timeline. ActorID is the user who
+// acted, or nil for the system; Recipient describes who an escalation reached.
+// Status changes record the status before and after.
+type AlertEvent struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	AlertID    uint      `json:"alert_id" gorm:"not null;index"`
+	Type       string    `json:"type" gorm:"not null"`
+	ActorID    *uint     `json:"actor_id"`
+	FromStatus string    `json:"from_status,omitempty"`
+	ToStatus   string    `json:"to_status,omitempty"`
+	AssigneeID *uint     `json:"assignee_id,omitempty"`
+	Step       int       `json:"step,omitempty"`
+	Channel    string    `json:"channel,omitempty"`
+	Recipient  string    `json:"recipient,omitempty"`
+	Comment    string    `json:"comment,omitempty"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
+
+// AlertThreshold overrides one of the default alert rules for a patient
+type AlertThreshold struct {
+	gorm.Model
+	PatientID       uint     `json:"patient_id" gorm:"not null;uniqueIndex:idx_alert_threshold_rule"`
+	RuleKey         string   `json:"rule_key" gorm:"not null;uniqueIndex:idx_alert_threshold_rule"`
+	Warning         *float64 `json:"warning"`
+	Critical        *float64 `json:"critical"`
+	Enabled         bool     `json:"enabled" gorm:"not null"`
+	CooldownMinutes int      `json:"cooldown_minutes"`
+	UpdatedByID     uint     `json:"updated_by_id"`
+}
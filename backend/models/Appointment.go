@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Appointment statuses
+const (
+	AppointmentScheduled = "scheduled"
+	AppointmentConfirmed = "confirmed"
+	AppointmentCompleted = "completed"
+	AppointmentCancelled = "cancelled"
+	AppointmentMissed    = "missed"
+)
+
+var AppointmentStatuses = map[string]bool{
+	AppointmentScheduled: true,
+	AppointmentConfirmed: true,
+	AppointmentCompleted: true,
+	AppointmentCancelled: true,
+	AppointmentMissed:    true,
+}
+
+var AppointmentTypes = map[string]bool{
+	"checkup":     true,
+	"specialist":  true,
+	"lab":         true,
+	"dental":      true,
+	"vaccination": true,
+	"therapy":     true,
+	"other":       true,
+}
+
+type Appointment struct {
+	gorm.Model
+	PatientID   uint      `json:"patient_id" gorm:"not null;index"`
+	CreatedByID uint      `json:"created_by_id"`
+	Provider    string    `json:"provider"`
+	Location    string    `json:"location"`
+	Type        string    `json:"type" gorm:"not null"`
+	StartTime   time.Time `json:"start_time" gorm:"not null;index"`
+	EndTime     time.Time `json:"end_time"`
+	Status      string    `json:"status" gorm:"not null;default:scheduled;index"`
+	Notes       string    `json:"notes"`
+	// RecurrenceMonths schedules the next visit this many months after the
+	// current one once it is completed; 0 means a one-off appointment
+	RecurrenceMonths int `json:"recurrence_months"`
+	// SeriesID is the ID of the first appointment of a recurring series
+	SeriesID        uint  `json:"series_id" gorm:"index"`
+	ReminderMinutes []int `json:"reminder_minutes" gorm:"serializer:json"`
+}
+
+// IsActive reports whether the appointment is still going to take place
+func (a *Appointment) IsActive() bool {
+	return a.Status == AppointmentScheduled || a.Status == AppointmentConfirmed
+}
+
+// AppointmentReminder records a reminder that has been sent, so each one goes out only once
+type AppointmentReminder struct {
+	gorm.Model
+	AppointmentID uint      `json:"appointment_id" gorm:"not null;uniqueIndex:idx_appointment_reminder"`
+	OffsetMinutes int       `json:"offset_minutes" gorm:"not null;uniqueIndex:idx_appointment_reminder"`
+	SentAt        time.Time `json:"sent_at"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MetricBaseline is a patient's usual level of one metric: the median and the
+// median absolute deviation of their readings in the window before ComputedAt
+type MetricBaseline struct {
+	gorm.Model
+	PatientID   uint      `json:"patient_id" gorm:"not null;uniqueIndex:idx_metric_baseline"`
+	Metric      string    `json:"metric" gorm:"not null;uniqueIndex:idx_metric_baseline"`
+	Median      float64   `json:"median"`
+	MAD         float64   `json:"mad"`
+	Samples     int       `json:"samples"`
+	WindowStart time.Time `json:"window_start"`
+	ComputedAt  time.Time `json:"computed_at"`
+}
+
+// Deviation directions
+const (
+	DeviationHigh = "high"
+	DeviationLow  = "low"
+)
+
+// DeviationFlag marks a reading that is unusual for the patient compared with
+// their own baseline at the time it was taken. Score is the robust z-score of
+// the reading; the sign matches Direction.
+type DeviationFlag struct {
+	gorm.Model
+	PatientID     uint      `json:"patient_id" gorm:"not null;index"`
+	ObservationID uint      `json:"observation_id" gorm:"not null;uniqueIndex:idx_deviation_observation"`
+	Metric        string    `json:"metric" gorm:"not null;uniqueIndex:idx_deviation_observation"`
+	Value         float64   `json:"value"`
+	EffectiveAt   time.Time `json:"effective_at" gorm:"index"`
+	Median        float64   `json:"median"`
+	MAD           float64   `json:"mad"`
+	Samples       int       `json:"samples"`
+	Score         float64   `json:"score"`
+	Direction     string    `json:"direction"`
+	Explanation   string    `json:"explanation"`
+}
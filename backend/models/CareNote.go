@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var CareNoteCategories = map[string]bool{
+	"observation": true,
+	"mood":        true,
+	"medication":  true,
+	"nutrition":   true,
+	"mobility":    true,
+	"sleep":       true,
+	"incident":    true,
+	"handover":    true,
+	"other":       true,
+}
+
+// CareNote is a caregiver's journal entry about a patient
+type CareNote struct {
+	gorm.Model
+	PatientID  uint      `json:"patient_id" gorm:"not null;index"`
+	AuthorID   uint      `json:"author_id" gorm:"not null"`
+	Author     User      `json:"-" gorm:"foreignKey:AuthorID"`
+	Category   string    `json:"category" gorm:"not null;index"`
+	Body       string    `json:"body" gorm:"type:text;not null"`
+	ObservedAt time.Time `json:"observed_at" gorm:"not null;index"`
+	// HealthMetricsID is the legacy link to a health_metrics row; new notes link an observation
+	HealthMetricsID *uint          `json:"health_metrics_id"`
+	HealthMetrics   *HealthMetrics `json:"health_metrics,omitempty" gorm:"foreignKey:HealthMetricsID"`
+	ObservationID   *uint          `json:"observation_id" gorm:"index"`
+	Observation     *Observation   `json:"observation,omitempty" gorm:"foreignKey:ObservationID"`
+	Pinned          bool           `json:"pinned" gorm:"not null;default:false"`
+	PinnedAt        *time.Time     `json:"pinned_at"`
+	EditedAt        *time.Time     `json:"edited_at"`
+}
+
+// CareNoteRevision keeps the previous content of a care note each time it is edited
+type CareNoteRevision struct {
+	gorm.Model
+	CareNoteID uint   `json:"care_note_id" gorm:"not null;index"`
+	EditorID   uint   `json:"editor_id"`
+	Category   string `json:"category"`
+	Body       string `json:"body" gorm:"type:text"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	CarePlanActive     = "active"
+	CarePlanSuperseded = "superseded"
+)
+
+// Goal comparators
+const (
+	GoalAtLeast = "at_least"
+	GoalAtMost  = "at_most"
+	GoalBetween = "between"
+)
+
+// CarePlan is one version of a patient's care plan. Changing a plan creates a
+// new version and marks the previous one superseded, so past goals stay reviewable.
+type CarePlan struct {
+	gorm.Model
+	PatientID    uint       `json:"patient_id" gorm:"not null;uniqueIndex:idx_care_plan_version"`
+	Version      int        `json:"version" gorm:"not null;uniqueIndex:idx_care_plan_version"`
+	Status       string     `json:"status" gorm:"not null;default:active;index"`
+	Title        string     `json:"title"`
+	Notes        string     `json:"notes"`
+	CreatedByID  uint       `json:"created_by_id"`
+	SupersededAt *time.Time `json:"superseded_at"`
+	Goals        []CareGoal `json:"goals" gorm:"foreignKey:CarePlanID"`
+}
+
+// CareGoal is a measurable target on one health metric, e.g. steps_count at_least 5000
+type CareGoal struct {
+	gorm.Model
+	CarePlanID  uint      `json:"care_plan_id" gorm:"not null;index"`
+	Metric      string    `json:"metric" gorm:"not null"`
+	Comparator  string    `json:"comparator" gorm:"not null"`
+	Target      float64   `json:"target"`
+	TargetMax   float64   `json:"target_max"` // upper bound for "between" goals
+	Description string    `json:"description"`
+	StartDate   time.Time `json:"start_date"`
+	ReviewDate  time.Time `json:"review_date"`
+	OwnerID     uint      `json:"owner_id"`
+}
+
+// IsMet reports whether a value satisfies the goal
+func (g *CareGoal) IsMet(value float64) bool {
+	switch g.Comparator {
+	case GoalAtLeast:
+		return value >= g.Target
+	case GoalAtMost:
+		return value <= g.Target
+	case GoalBetween:
+		return value >= g.Target && value <= g.TargetMax
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Escalation step targets
+const (
+	// EscalateToUser notifies a caregiver with an account in the household
+	EscalateToUser = "user"
+	// EscalateToEmergencyContact texts the patient's emergency contact
+	EscalateToEmergencyContact = "emergency_contact"
+)
+
+// EscalationPolicy says who to notify, in order, when an alert of a household
+// patient is not acknowledged in time. Alerts below MinSeverity are not escalated.
+type EscalationPolicy struct {
+	gorm.Model
+	HouseholdID uint             `json:"household_id" gorm:"not null;uniqueIndex"`
+	MinSeverity string           `json:"min_severity" gorm:"not null"`
+	UpdatedByID uint             `json:"updated_by_id"`
+	Steps       []EscalationStep `json:"steps" gorm:"foreignKey:PolicyID"`
+}
+
+// EscalationStep runs TimeoutMinutes after the alert was raised or the previous
+// step ran, unless the alert has been acknowledged or resolved by then
+type EscalationStep struct {
+	gorm.Model
+	PolicyID       uint   `json:"policy_id" gorm:"not null;index"`
+	Position       int    `json:"position" gorm:"not null"`
+	Target         string `json:"target" gorm:"not null"`
+	UserID         *uint  `json:"user_id"`
+	Channel        string `json:"channel" gorm:"not null"`
+	TimeoutMinutes int    `json:"timeout_minutes" gorm:"not null"`
+}
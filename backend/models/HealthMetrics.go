@@ -13,6 +13,9 @@ type SleepStages struct {
 	AwakeTime int     `json:"awake_time"` // in minutes
 }
 
+// HealthMetrics is the original one-row-per-reading shape. Readings are now stored
+// as Observations; this type is kept for the health_metrics table converted by
+// migrate and as the compatibility projection built by observations.Project.
 type HealthMetrics struct {
 	gorm.Model
 	PatientID        uint        `json:"patient_id"`
@@ -26,8 +29,13 @@ type HealthMetrics struct {
 	StepsCount       int         `json:"steps_count"`
 	Sleep            SleepStages `json:"sleep" gorm:"embedded"`
 	SleepDuration    float64     `json:"sleep_duration"` // in hours
+	RespirationRate  int         `json:"respiration_rate"`
+	BodyTemperature  float64     `json:"body_temperature"` // in °C
 	IrregularRhythm  bool        `json:"irregular_rhythm"`
 	FallDetected     bool        `json:"fall_detected"`
+	// Source and DeviceID identify where an ingested reading came from, e.g. "omron" and the cuff's serial
+	Source   string `json:"source" gorm:"index"`
+	DeviceID string `json:"device_id" gorm:"index"`
 }
 
 // BeforeCreate will set the Date field to current time if not set
@@ -37,3 +45,66 @@ func (h *HealthMetrics) BeforeCreate(tx *gorm.DB) error {
 	}
 	return nil
 }
+
+// Metric names used by goals, queries and thresholds
+const (
+	MetricWeight           = "weight"
+	MetricHeartRate        = "heart_rate"
+	MetricSystolicBP       = "systolic_bp"
+	MetricDiastolicBP      = "diastolic_bp"
+	MetricOxygenSaturation = "oxygen_saturation"
+	MetricStepsCount       = "steps_count"
+	MetricSleepDuration    = "sleep_duration"
+	MetricRespirationRate  = "respiration_rate"
+	MetricBodyTemperature  = "body_temperature"
+)
+
+// Derived metrics are computed from the stored ones when queried
+const (
+	MetricBMI                  = "bmi"
+	MetricMeanArterialPressure = "mean_arterial_pressure"
+	MetricPulsePressure        = "pulse_pressure"
+	MetricSleepEfficiency      = "sleep_efficiency"
+)
+
+// MetricUnits maps each metric to the unit it is stored in
+var MetricUnits = map[string]string{
+	MetricWeight:           "kg",
+	MetricHeartRate:        "bpm",
+	MetricSystolicBP:       "mmHg",
+	MetricDiastolicBP:      "mmHg",
+	MetricOxygenSaturation: "%",
+	MetricStepsCount:       "steps",
+	MetricSleepDuration:    "h",
+	MetricRespirationRate:  "breaths/min",
+	MetricBodyTemperature:  "°C",
+}
+
+// Value returns the named metric of the reading. Zero values mean the metric
+// was not measured and are reported as missing.
+func (h *HealthMetrics) Value(metric string) (float64, bool) {
+	var v float64
+	switch metric {
+	case MetricWeight:
+		v = h.Weight
+	case MetricHeartRate:
+		v = float64(h.HeartRate)
+	case MetricSystolicBP:
+		v = float64(h.SystolicBP)
+	case MetricDiastolicBP:
+		v = float64(h.DiastolicBP)
+	case MetricOxygenSaturation:
+		v = h.OxygenSaturation
+	case MetricStepsCount:
+		v = float64(h.StepsCount)
+	case MetricSleepDuration:
+		v = h.SleepDuration
+	case MetricRespirationRate:
+		v = float64(h.RespirationRate)
+	case MetricBodyTemperature:
+		v = h.BodyTemperature
+	default:
+		return 0, false
+	}
+	return v, v != 0
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// IdempotencyKey remembers the response to a request sent with an Idempotency-Key
+// header, so a client retrying after a timeout gets the same answer instead of
+// creating duplicates. StatusCode is 0 while the first request is still running;
+// ClaimedAt lets a retry take over the key of a request that died without answering.
+type IdempotencyKey struct {
+	gorm.Model
+	UserID      uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_idempotency_user_key"`
+	Key         string    `json:"key" gorm:"not null;uniqueIndex:idx_idempotency_user_key"`
+	Endpoint    string    `json:"endpoint"`
+	RequestHash string    `json:"request_hash"`
+	StatusCode  int       `json:"status_code"`
+	ClaimedAt   time.Time `json:"claimed_at"`
+	Response    []byte    `json:"-"`
+	ExpiresAt   time.Time `json:"expires_at" gorm:"index"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Vaccine codes tracked for immunization records
+const (
+	VaccineInfluenza    = "influenza"
+	VaccinePneumococcal = "pneumococcal"
+	VaccineZoster       = "zoster"
+	VaccineCovid19      = "covid19"
+	VaccineTetanus      = "td"
+)
+
+var VaccineCodes = map[string]string{
+	VaccineInfluenza:    "Influenza",
+	VaccinePneumococcal: "Pneumococcal conjugate",
+	VaccineZoster:       "Shingles (recombinant zoster)",
+	VaccineCovid19:      "COVID-19",
+	VaccineTetanus:      "Tetanus, diphtheria (Td/Tdap)",
+}
+
+// Immunization is a single vaccine dose given to a patient
+type Immunization struct {
+	gorm.Model
+	PatientID         uint      `json:"patient_id" gorm:"not null;index"`
+	RecordedByID      uint      `json:"recorded_by_id"`
+	VaccineCode       string    `json:"vaccine_code" gorm:"not null;index"`
+	DoseNumber        int       `json:"dose_number" gorm:"not null;default:1"`
+	AdministeredOn    time.Time `json:"administered_on" gorm:"not null;index"`
+	LotNumber         string    `json:"lot_number"`
+	AdministeringSite string    `json:"administering_site"`
+	Notes             string    `json:"notes"`
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Import batch statuses
+const (
+	ImportQueued    = "queued"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+	ImportUndone    = "undone"
+)
+
+// ImportMapping tells how to read a CSV export of readings
+type ImportMapping struct {
+	// Columns maps an import field, e.g. "systolic_bp", to the CSV header holding it
+	Columns map[string]string `json:"columns"`
+	// TimeFormat is the Go layout of the timestamp, or of the date and time
+	// columns joined by a space; empty accepts RFC 3339 and ISO 8601 forms
+	TimeFormat string `json:"timeFormat"`
+	// Timezone applies to timestamps without an offset; defaults to UTC
+	Timezone        string `json:"timezone"`
+	WeightUnit      string `json:"weightUnit"`      // kg (default) or lb
+	TemperatureUnit string `json:"temperatureUnit"` // C (default) or F
+	// Source is recorded on readings whose row has no source column
+	Source    string `json:"source"`
+	Delimiter string `json:"delimiter"` // "," (default), ";" or "\t"
+}
+
+// ImportRowError lists the problems with one line of an import file
+type ImportRowError struct {
+	Line   int               `json:"line"`
+	Errors map[string]string `json:"errors"`
+}
+
+// ImportBatch is a CSV file of historical readings imported in the
+// background. The file lives in the blob store until the import finishes;
+// the observations it creates carry the batch ID so the import can be undone.
+type ImportBatch struct {
+	gorm.Model
+	PatientID     uint          `json:"patient_id" gorm:"not null;index"`
+	CreatedByID   uint          `json:"created_by_id"`
+	FileName      string        `json:"file_name"`
+	StorageKey    string        `json:"-"`
+	Mapping       ImportMapping `json:"mapping" gorm:"type:jsonb;serializer:json"`
+	Status        string        `json:"status" gorm:"not null;index"`
+	TotalRows     int           `json:"total_rows"`
+	ProcessedRows int           `json:"processed_rows"`
+	Created       int           `json:"created"`
+	Duplicates    int           `json:"duplicates"`
+	Rejected      int           `json:"rejected"`
+	// RowErrors holds the first rejected lines
+	RowErrors  []ImportRowError `json:"row_errors" gorm:"type:jsonb;serializer:json"`
+	Error      string           `json:"error,omitempty"`
+	StartedAt  *time.Time       `json:"started_at"`
+	FinishedAt *time.Time       `json:"finished_at"`
+	UndoneAt   *time.Time       `json:"undone_at"`
+	UndoneByID *uint            `json:"undone_by_id"`
+}
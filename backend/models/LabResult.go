@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Lab result flags
+const (
+	LabFlagNormal = "normal"
+	LabFlagLow    = "low"
+	LabFlagHigh   = "high"
+)
+
+// LabResult is one analyte measured in a lab panel, e.g. LDL in a lipid panel
+type LabResult struct {
+	gorm.Model
+	PatientID    uint    `json:"patient_id" gorm:"not null;index:idx_lab_results_patient_test"`
+	RecordedByID uint    `json:"recorded_by_id"`
+	Panel        string  `json:"panel" gorm:"not null;index"`
+	TestCode     string  `json:"test_code" gorm:"not null;index:idx_lab_results_patient_test"`
+	TestName     string  `json:"test_name"`
+	Value        float64 `json:"value"`
+	Unit         string  `json:"unit"`
+	// RangeLow and RangeHigh are the reference range the value was judged against;
+	// either end may be open
+	RangeLow    *float64  `json:"range_low"`
+	RangeHigh   *float64  `json:"range_high"`
+	Flag        string    `json:"flag"`
+	CollectedAt time.Time `json:"collected_at" gorm:"not null;index:idx_lab_results_patient_test"`
+	Laboratory  string    `json:"laboratory"`
+	Notes       string    `json:"notes"`
+}
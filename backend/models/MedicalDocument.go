@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Document types accepted for medical documents
+var DocumentTypes = map[string]bool{
+	"discharge_letter": true,
+	"lab_report":       true,
+	"ecg":              true,
+	"imaging":          true,
+	"prescription":     true,
+	"referral":         true,
+	"other":            true,
+}
+
+// MedicalDocument is a file attached to a patient. The file itself lives in the
+// blob store under StorageKey; this row only holds its metadata.
+type MedicalDocument struct {
+	gorm.Model
+	PatientID    uint      `json:"patient_id" gorm:"not null;index"`
+	UploadedByID uint      `json:"uploaded_by_id"`
+	UploadedBy   User      `json:"-" gorm:"foreignKey:UploadedByID"`
+	Type         string    `json:"type" gorm:"not null;index"`
+	DocumentDate time.Time `json:"document_date"`
+	FileName     string    `json:"file_name"`
+	Description  string    `json:"description"`
+	Tags         []string  `json:"tags" gorm:"type:jsonb;serializer:json"`
+	ContentType  string    `json:"content_type"`
+	SizeBytes    int64     `json:"size_bytes"`
+	SHA256       string    `json:"sha256" gorm:"column:sha256;size:64"`
+	StorageKey   string    `json:"-" gorm:"uniqueIndex"`
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Rollup resolutions; buckets start on UTC hour, day and month boundaries
+const (
+	RollupHour  = "hour"
+	RollupDay   = "day"
+	RollupMonth = "month"
+)
+
+// MetricRollup aggregates a patient's readings of one query metric over an
+// hour, day or month. Rollups outlive the raw readings they were computed from;
+// the average is Sum / Count.
+type MetricRollup struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	PatientID   uint      `json:"patient_id" gorm:"not null;uniqueIndex:idx_metric_rollups_bucket"`
+	Metric      string    `json:"metric" gorm:"not null;uniqueIndex:idx_metric_rollups_bucket"`
+	Resolution  string    `json:"resolution" gorm:"not null;uniqueIndex:idx_metric_rollups_bucket"`
+	BucketStart time.Time `json:"bucket_start" gorm:"not null;uniqueIndex:idx_metric_rollups_bucket"`
+	Count       int       `json:"count"`
+	Sum         float64   `json:"sum"`
+	Min         float64   `json:"min"`
+	Max         float64   `json:"max"`
+	// Last is the value of the latest reading in the bucket, taken at LastAt
+	Last      float64   `json:"last"`
+	LastAt    time.Time `json:"last_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RollupDirty marks an hour of a patient's readings whose rollups are stale
+type RollupDirty struct {
+	PatientID uint      `gorm:"primaryKey;autoIncrement:false"`
+	Hour      time.Time `gorm:"primaryKey"`
+	CreatedAt time.Time
+}
+
+func (RollupDirty) TableName() string {
+	return "rollup_dirty"
+}
+
+// ObservationArchive keeps an observation removed from observations by the
+// retention policy
+type ObservationArchive struct {
+	gorm.Model
+	PatientID       uint               `json:"patient_id" gorm:"not null;index"`
+	Metric          string             `json:"metric" gorm:"not null"`
+	Value           float64            `json:"value"`
+	Value2          *float64           `json:"value2,omitempty"`
+	Unit            string             `json:"unit"`
+	Components      map[string]float64 `json:"components,omitempty" gorm:"type:jsonb;serializer:json"`
+	EffectiveAt     time.Time          `json:"effective_at" gorm:"not null"`
+	Source          string             `json:"source"`
+	DeviceID        string             `json:"device_id"`
+	Status          string             `json:"status"`
+	LegacyMetricsID uint               `json:"-"`
+	ImportBatchID   *uint              `json:"import_batch_id,omitempty"`
+	ArchivedAt      time.Time          `json:"archived_at" gorm:"not null"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// NewsScore is a National Early Warning Score (NEWS2) computed for a patient.
+// Scores holds the points per parameter and Values the readings they came from;
+// LatestReadingAt is when the newest of those readings was taken.
+type NewsScore struct {
+	gorm.Model
+	PatientID       uint               `json:"patient_id" gorm:"not null;index:idx_news_scores_patient_time"`
+	Total           int                `json:"total"`
+	Band            string             `json:"band" gorm:"not null"`
+	Scores          map[string]int     `json:"scores" gorm:"type:jsonb;serializer:json"`
+	Values          map[string]float64 `json:"values" gorm:"type:jsonb;serializer:json"`
+	Missing         []string           `json:"missing" gorm:"type:jsonb;serializer:json"`
+	LatestReadingAt time.Time          `json:"latest_reading_at"`
+	ComputedAt      time.Time          `json:"computed_at" gorm:"not null;index:idx_news_scores_patient_time"`
+}
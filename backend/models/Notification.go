@@ -0,0 +1,102 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Notification channels
+const (
+	ChannelEmail   = "email"
+	ChannelSMS     = "sms"
+	ChannelWebhook = "webhook"
+	ChannelInApp   = "in_app"
+)
+
+var NotificationChannels = map[string]bool{
+	ChannelEmail:   true,
+	ChannelSMS:     true,
+	ChannelWebhook: true,
+	ChannelInApp:   true,
+}
+
+// Notification delivery statuses
+const (
+	NotificationPending = "pending"
+	NotificationSending = "sending"
+	NotificationSent    = "sent"
+	// NotificationDead is a notification that failed permanently or ran out of retries
+	NotificationDead = "dead"
+)
+
+// Notification is one message queued for delivery to a user over one channel.
+// UserID is 0 for recipients without an account, such as emergency contacts.
+type Notification struct {
+	gorm.Model
+	UserID        uint                   `json:"user_id" gorm:"not null;index"`
+	Channel       string                 `json:"channel" gorm:"not null"`
+	Event         string                 `json:"event" gorm:"not null"`
+	Address       string                 `json:"address" gorm:"serializer:encrypted"`
+	Subject       string                 `json:"subject"`
+	Body          string                 `json:"body" gorm:"type:text"`
+	Payload       map[string]interface{} `json:"payload,omitempty" gorm:"type:jsonb;serializer:json"`
+	Urgent        bool                   `json:"urgent"`
+	Status        string                 `json:"status" gorm:"not null;index:idx_notifications_due"`
+	Attempts      int                    `json:"attempts"`
+	NextAttemptAt time.Time              `json:"next_attempt_at" gorm:"index:idx_notifications_due"`
+	LastError     string                 `json:"last_error,omitempty"`
+	SentAt        *time.Time             `json:"sent_at"`
+	DataKey       string                 `json:"-"`
+}
+
+// BeforeSave makes sure the record has a data key for its encrypted address
+func (n *Notification) BeforeSave(tx *gorm.DB) error {
+	if n.DataKey != "" {
+		return nil
+	}
+	key, err := newDataKey()
+	if err != nil {
+		return err
+	}
+	n.DataKey = key
+	return nil
+}
+
+// NotificationPreference is a user's settings for one channel. QuietHoursStart
+// and QuietHoursEnd ("HH:MM" in Timezone) hold back non-urgent notifications.
+type NotificationPreference struct {
+	gorm.Model
+	UserID          uint   `json:"user_id" gorm:"not null;uniqueIndex:idx_notification_preference"`
+	Channel         string `json:"channel" gorm:"not null;uniqueIndex:idx_notification_preference"`
+	Enabled         bool   `json:"enabled" gorm:"not null"`
+	Address         string `json:"address" gorm:"serializer:encrypted"`
+	QuietHoursStart string `json:"quiet_hours_start"`
+	QuietHoursEnd   string `json:"quiet_hours_end"`
+	Timezone        string `json:"timezone"`
+	DataKey         string `json:"-"`
+}
+
+// BeforeSave makes sure the record has a data key for its encrypted address
+func (p *NotificationPreference) BeforeSave(tx *gorm.DB) error {
+	if p.DataKey != "" {
+		return nil
+	}
+	key, err := newDataKey()
+	if err != nil {
+		return err
+	}
+	p.DataKey = key
+	return nil
+}
+
+// InboxMessage is a notification delivered to the in-app inbox
+type InboxMessage struct {
+	gorm.Model
+	UserID         uint       `json:"user_id" gorm:"not null;index"`
+	NotificationID uint       `json:"notification_id" gorm:"uniqueIndex"`
+	Event          string     `json:"event"`
+	Subject        string     `json:"subject"`
+	Body           string     `json:"body" gorm:"type:text"`
+	ReadAt         *time.Time `json:"read_at"`
+}
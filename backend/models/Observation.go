@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Observation metrics that are not plain HealthMetrics columns
+const (
+	MetricBloodPressure   = "blood_pressure"
+	MetricIrregularRhythm = "irregular_rhythm"
+	MetricFallDetected    = "fall_detected"
+)
+
+// ObservationMetrics maps each observation metric to its unit
+var ObservationMetrics = map[string]string{
+	MetricHeartRate:        "bpm",
+	MetricBloodPressure:    "mmHg",
+	MetricOxygenSaturation: "%",
+	MetricWeight:           "kg",
+	MetricStepsCount:       "steps",
+	MetricSleepDuration:    "h",
+	MetricRespirationRate:  "breaths/min",
+	MetricBodyTemperature:  "°C",
+	MetricIrregularRhythm:  "event",
+	MetricFallDetected:     "event",
+}
+
+// SourceMock marks observations generated by the mock data worker. They are
+// charted like real readings but never raise alerts or notifications.
+const SourceMock = "mock"
+
+// Observation statuses
+const (
+	ObservationFinal          = "final"
+	ObservationPreliminary    = "preliminary"
+	ObservationAmended        = "amended"
+	ObservationEnteredInError = "entered_in_error"
+)
+
+// Observation is a single measurement of one metric. Readings taken together,
+// e.g. a cuff reporting pressure and pulse, share EffectiveAt, Source and DeviceID.
+type Observation struct {
+	gorm.Model
+	PatientID uint    `json:"patient_id" gorm:"not null;index:idx_observations_patient_metric_time"`
+	Metric    string  `json:"metric" gorm:"not null;index:idx_observations_patient_metric_time"`
+	Value     float64 `json:"value"`
+	// Value2 is the second value of two-valued metrics: the diastolic pressure of blood_pressure
+	Value2 *float64 `json:"value2,omitempty"`
+	Unit   string   `json:"unit"`
+	// Components holds extra detail, e.g. the sleep stages of a sleep_duration observation
+	Components  map[string]float64 `json:"components,omitempty" gorm:"type:jsonb;serializer:json"`
+	EffectiveAt time.Time          `json:"effective_at" gorm:"not null;index:idx_observations_patient_metric_time"`
+	Source      string             `json:"source"`
+	DeviceID    string             `json:"device_id" gorm:"index"`
+	Status      string             `json:"status" gorm:"not null;default:final"`
+	// LegacyMetricsID is the health_metrics row the observation was converted from
+	LegacyMetricsID uint `json:"-" gorm:"index"`
+	// ImportBatchID is the CSV import that created the observation
+	ImportBatchID *uint `json:"import_batch_id,omitempty" gorm:"index"`
+}
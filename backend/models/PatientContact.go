@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Preferred channels for reaching an emergency contact
+const (
+	ContactChannelPhone = "phone"
+	ContactChannelSMS   = "sms"
+	ContactChannelEmail = "email"
+)
+
+type ContactPhone struct {
+	Label  string `json:"label"`  // e.g. mobile, home, work
+	Number string `json:"number"` // E.164, e.g. +306912345678
+}
+
+// PatientContact is one entry in a patient's ordered list of emergency contacts.
+// Lower Priority values are contacted first.
+type PatientContact struct {
+	gorm.Model
+	PatientID        uint           `json:"patient_id" gorm:"not null;index"`
+	Priority         int            `json:"priority" gorm:"not null;default:0"`
+	Name             string         `json:"name" gorm:"not null;serializer:encrypted"`
+	Relationship     string         `json:"relationship"`
+	PhoneNumbers     []ContactPhone `json:"phone_numbers" gorm:"serializer:encrypted"`
+	Emails           []string       `json:"emails" gorm:"serializer:encrypted"`
+	PreferredChannel string         `json:"preferred_channel" gorm:"default:phone"`
+	AvailableFrom    string         `json:"available_from"` // "HH:MM", empty means any time
+	AvailableTo      string         `json:"available_to"`   // "HH:MM", may be earlier than AvailableFrom for overnight windows
+	ReceiveAlerts    bool           `json:"receive_alerts"`
+	DataKey          string         `json:"-"` // wrapped per-record key for the encrypted columns
+}
+
+// BeforeSave makes sure the record has a data key for its encrypted columns
+func (pc *PatientContact) BeforeSave(tx *gorm.DB) error {
+	if pc.DataKey != "" {
+		return nil
+	}
+	key, err := newDataKey()
+	if err != nil {
+		return err
+	}
+	pc.DataKey = key
+	return nil
+}
+
+// IsAvailableAt reports whether t falls inside the contact's availability hours
+func (pc *PatientContact) IsAvailableAt(t time.Time) bool {
+	if pc.AvailableFrom == "" || pc.AvailableTo == "" {
+		return true
+	}
+
+	from, err := time.Parse("15:04", pc.AvailableFrom)
+	if err != nil {
+		return true
+	}
+	to, err := time.Parse("15:04", pc.AvailableTo)
+	if err != nil {
+		return true
+	}
+
+	minutes := t.Hour()*60 + t.Minute()
+	fromMinutes := from.Hour()*60 + from.Minute()
+	toMinutes := to.Hour()*60 + to.Minute()
+
+	if fromMinutes <= toMinutes {
+		return minutes >= fromMinutes && minutes < toMinutes
+	}
+	// Window wraps past midnight, e.g. 22:00-06:00
+	return minutes >= fromMinutes || minutes < toMinutes
+}
+
+// PrimaryPhone returns the first phone number of the contact, if any
+func (pc *PatientContact) PrimaryPhone() string {
+	if len(pc.PhoneNumbers) == 0 {
+		return ""
+	}
+	return pc.PhoneNumbers[0].Number
+}
@@ -0,0 +1,39 @@
+package models
+
+import "errors"
+
+// ErrNoKeyProvider is returned when a record with encrypted columns is saved
+// before a KeyProvider was registered
+var ErrNoKeyProvider = errors.New("models: no key provider registered")
+
+// KeyProvider creates the data keys and blind indexes of records with
+// encrypted columns. initializers registers one when the encryption keys are
+// loaded, which keeps models free of the encryption service.
+type KeyProvider interface {
+	NewDataKey() (string, error)
+	// PhoneBlindIndex hashes a phone number in its E.164 form, so the same
+	// number written with or without the country code has one index
+	PhoneBlindIndex(phone string) (string, error)
+}
+
+var keys KeyProvider
+
+// RegisterKeyProvider sets the KeyProvider used by the models' save hooks
+func RegisterKeyProvider(p KeyProvider) {
+	keys = p
+}
+
+func newDataKey() (string, error) {
+	if keys == nil {
+		return "", ErrNoKeyProvider
+	}
+	return keys.NewDataKey()
+}
+
+// PhoneBlindIndex hashes a phone number for exact-match lookups, ignoring formatting
+func PhoneBlindIndex(phone string) (string, error) {
+	if keys == nil {
+		return "", ErrNoKeyProvider
+	}
+	return keys.PhoneBlindIndex(phone)
+}
@@ -7,9 +7,9 @@ import (
 )
 
 type EmergencyContact struct {
-	Name         string `json:"name" gorm:"column:emergency_contact_name"`
-	Relationship string `json:"relationship" gorm:"column:emergency_contact_relationship"`
-	PhoneNumber  string `json:"phone_number" gorm:"column:emergency_contact_phone_number"`
+	Name         string `json:"name" gorm:"column:emergency_contact_name;serializer:encrypted"`
+	Relationship string `json:"relationship" gorm:"column:emergency_contact_relationship;serializer:encrypted"`
+	PhoneNumber  string `json:"phone_number" gorm:"column:emergency_contact_phone_number;serializer:encrypted"`
 }
 
 type Patient struct {
@@ -18,19 +18,42 @@ type Patient struct {
 	User          User      `json:"user" gorm:"foreignKey:UserID"`
 	Name          string    `json:"name"`
 	Surname       string    `json:"surname"`
-	Address       string    `json:"address"`
+	Address       string    `json:"address" gorm:"serializer:encrypted"`
 	MedicalRecord string    `json:"medical_record"`
 	DateOfBirth   time.Time `json:"date_of_birth"`
 
 	Gender           string           `json:"gender"`
 	BloodType        string           `json:"blood_type"`
 	Height           float64          `json:"height"`
-	MedicalHistory   string           `json:"medical_history"`
-	Allergies        string           `json:"allergies"`
-	Medications      string           `json:"medications"`
+	MedicalHistory   string           `json:"medical_history" gorm:"serializer:encrypted"`
+	Allergies        string           `json:"allergies" gorm:"serializer:encrypted"`
+	Medications      string           `json:"medications" gorm:"serializer:encrypted"`
 	EmergencyContact EmergencyContact `json:"emergency_contact" gorm:"embedded;embeddedPrefix:emergency_contact_"`
 	Households       []Household      `json:"households" gorm:"many2many:household_patients;"`
 	HealthMetrics    []HealthMetrics  `json:"health_metrics" gorm:"foreignKey:PatientID"`
+
+	// DataKey is the wrapped per-record key for the encrypted columns above
+	DataKey string `json:"-"`
+	// EmergencyContactPhoneIndex is a blind index of the emergency contact's phone number
+	EmergencyContactPhoneIndex string `json:"-" gorm:"index"`
+}
+
+// BeforeSave makes sure the record has a data key and refreshes its blind indexes
+func (p *Patient) BeforeSave(tx *gorm.DB) error {
+	if p.DataKey == "" {
+		key, err := newDataKey()
+		if err != nil {
+			return err
+		}
+		p.DataKey = key
+	}
+
+	index, err := PhoneBlindIndex(p.EmergencyContact.PhoneNumber)
+	if err != nil {
+		return err
+	}
+	p.EmergencyContactPhoneIndex = index
+	return nil
 }
 
 func (p *Patient) Age() int {
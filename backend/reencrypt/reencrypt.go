@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"my-health/initializers"
+	"my-health/models"
+	"my-health/services/fieldcrypt"
+)
+
+func init() {
+	initializers.LoadEnvs()
+	initializers.LoadEncryptionKeys()
+	initializers.ConnectDatabase()
+}
+
+// rewrapDataKey moves a record's data key to the active master key. Records
+// without a key get one from their BeforeSave hook when saved.
+func rewrapDataKey(dataKey *string) error {
+	if *dataKey == "" {
+		return nil
+	}
+	rewrapped, err := fieldcrypt.Rewrap(*dataKey)
+	if err != nil {
+		return err
+	}
+	*dataKey = rewrapped
+	return nil
+}
+
+// reencryptPatients re-saves every patient so all encrypted columns use the
+// active master key, encrypting legacy plaintext values on the way
+func reencryptPatients(batchSize int) (int, error) {
+	count := 0
+	var patients []models.Patient
+	result := initializers.DB.Unscoped().FindInBatches(&patients, batchSize, func(tx *gorm.DB, batch int) error {
+		for i := range patients {
+			if err := rewrapDataKey(&patients[i].DataKey); err != nil {
+				log.Printf("Patient %d: %v", patients[i].ID, err)
+				return err
+			}
+			if err := initializers.DB.Unscoped().Omit(clause.Associations).Save(&patients[i]).Error; err != nil {
+				return err
+			}
+			count++
+		}
+		log.Printf("Re-encrypted patient batch %d", batch)
+		return nil
+	})
+	return count, result.Error
+}
+
+// reencryptContacts does the same for emergency contacts
+func reencryptContacts(batchSize int) (int, error) {
+	count := 0
+	var contacts []models.PatientContact
+	result := initializers.DB.Unscoped().FindInBatches(&contacts, batchSize, func(tx *gorm.DB, batch int) error {
+		for i := range contacts {
+			if err := rewrapDataKey(&contacts[i].DataKey); err != nil {
+				log.Printf("Contact %d: %v", contacts[i].ID, err)
+				return err
+			}
+			if err := initializers.DB.Unscoped().Save(&contacts[i]).Error; err != nil {
+				return err
+			}
+			count++
+		}
+		log.Printf("Re-encrypted contact batch %d", batch)
+		return nil
+	})
+	return count, result.Error
+}
+
+func main() {
+	batchSize := flag.Int("batch", 100, "number of records processed per batch")
+	flag.Parse()
+
+	log.Println("Starting re-encryption...")
+
+	patients, err := reencryptPatients(*batchSize)
+	if err != nil {
+		log.Fatalf("Failed to re-encrypt patients: %v", err)
+	}
+
+	contacts, err := reencryptContacts(*batchSize)
+	if err != nil {
+		log.Fatalf("Failed to re-encrypt contacts: %v", err)
+	}
+
+	log.Printf("Re-encryption completed: %d patients, %d contacts", patients, contacts)
+}
@@ -12,6 +12,7 @@ func SetupRoutes(r *gin.Engine) {
 	r.POST("/login", controllers.Login)
 	r.POST("/create-user", controllers.CreateUser)
 	r.GET("/logout", controllers.Logout)
+	r.GET("/fhir/metadata", controllers.GetFHIRMetadata)
 
 	// Protected routes
 	protected := r.Group("/")
@@ -25,15 +26,121 @@ func SetupRoutes(r *gin.Engine) {
 		protected.POST("/admin/profile", controllers.UpdateAdminProfile)
 
 		// Patient routes
+		protected.GET("/patients", controllers.SearchPatients)
 		protected.GET("/patient/:id", controllers.GetPatientDetails)
 		protected.POST("/patient/edit/:id", controllers.UpdatePatient)
 		protected.GET("/patient/check-details/:userId", controllers.CheckPatientDetails)
 
+		// Emergency contact routes
+		protected.GET("/patient/:id/contacts", controllers.GetPatientContacts)
+		protected.POST("/patient/:id/contacts", controllers.CreatePatientContact)
+		protected.PUT("/patient/:id/contacts/order", controllers.ReorderPatientContacts)
+		protected.PUT("/patient/:id/contacts/:contactId", controllers.UpdatePatientContact)
+		protected.DELETE("/patient/:id/contacts/:contactId", controllers.DeletePatientContact)
+
+		// Medical document routes
+		protected.GET("/patient/:id/documents", controllers.GetPatientDocuments)
+		protected.POST("/patient/:id/documents", controllers.UploadPatientDocument)
+		protected.GET("/patient/:id/documents/:documentId", controllers.GetPatientDocument)
+		protected.GET("/patient/:id/documents/:documentId/download", controllers.DownloadPatientDocument)
+		protected.DELETE("/patient/:id/documents/:documentId", controllers.DeletePatientDocument)
+
+		// Appointment routes
+		protected.GET("/patient/:id/appointments", controllers.GetPatientAppointments)
+		protected.POST("/patient/:id/appointments", controllers.CreatePatientAppointment)
+		protected.PUT("/patient/:id/appointments/:appointmentId", controllers.UpdatePatientAppointment)
+		protected.DELETE("/patient/:id/appointments/:appointmentId", controllers.DeletePatientAppointment)
+
+		// Care note routes
+		protected.GET("/patient/:id/care-notes", controllers.GetPatientCareNotes)
+		protected.POST("/patient/:id/care-notes", controllers.CreatePatientCareNote)
+		protected.PUT("/patient/:id/care-notes/:noteId", controllers.UpdatePatientCareNote)
+		protected.PUT("/patient/:id/care-notes/:noteId/pin", controllers.PinPatientCareNote)
+		protected.GET("/patient/:id/care-notes/:noteId/history", controllers.GetPatientCareNoteHistory)
+		protected.DELETE("/patient/:id/care-notes/:noteId", controllers.DeletePatientCareNote)
+
+		// Care plan routes
+		protected.GET("/patient/:id/care-plan", controllers.GetPatientCarePlan)
+		protected.POST("/patient/:id/care-plan", controllers.CreatePatientCarePlan)
+		protected.GET("/patient/:id/care-plan/progress", controllers.GetPatientCarePlanProgress)
+		protected.GET("/patient/:id/care-plans", controllers.GetPatientCarePlanVersions)
+
+		// Immunization routes
+		protected.GET("/patient/:id/immunizations", controllers.GetPatientImmunizations)
+		protected.POST("/patient/:id/immunizations", controllers.CreatePatientImmunization)
+		protected.GET("/patient/:id/immunizations/forecast", controllers.GetPatientImmunizationForecast)
+		protected.PUT("/patient/:id/immunizations/:immunizationId", controllers.UpdatePatientImmunization)
+		protected.DELETE("/patient/:id/immunizations/:immunizationId", controllers.DeletePatientImmunization)
+
+		// Lab result routes
+		protected.GET("/labs/analytes", controllers.GetLabAnalytes)
+		protected.GET("/patient/:id/labs", controllers.GetPatientLabResults)
+		protected.POST("/patient/:id/labs", controllers.CreatePatientLabResults)
+		protected.GET("/patient/:id/labs/series/:testCode", controllers.GetPatientLabSeries)
+		protected.PUT("/patient/:id/labs/:resultId", controllers.UpdatePatientLabResult)
+		protected.DELETE("/patient/:id/labs/:resultId", controllers.DeletePatientLabResult)
+
+		// Alert routes
+		protected.GET("/patient/:id/alerts", controllers.GetPatientAlerts)
+		protected.GET("/patient/:id/alerts/:alertId/timeline", controllers.GetPatientAlertTimeline)
+		protected.PUT("/patient/:id/alerts/:alertId/acknowledge", controllers.AcknowledgePatientAlert)
+		protected.PUT("/patient/:id/alerts/:alertId/assign", controllers.AssignPatientAlert)
+		protected.PUT("/patient/:id/alerts/:alertId/resolve", controllers.ResolvePatientAlert)
+		protected.PUT("/patient/:id/alerts/:alertId/false-positive", controllers.MarkPatientAlertFalsePositive)
+		protected.GET("/patient/:id/alert-thresholds", controllers.GetPatientAlertThresholds)
+		protected.PUT("/patient/:id/alert-thresholds/:rule", controllers.UpdatePatientAlertThreshold)
+		protected.DELETE("/patient/:id/alert-thresholds/:rule", controllers.DeletePatientAlertThreshold)
+
+		// Notification routes
+		protected.GET("/notifications", controllers.GetInbox)
+		protected.PUT("/notifications/read", controllers.MarkInboxRead)
+		protected.PUT("/notifications/:messageId/read", controllers.MarkInboxMessageRead)
+		protected.GET("/notifications/preferences", controllers.GetNotificationPreferences)
+		protected.PUT("/notifications/preferences/:channel", controllers.UpdateNotificationPreference)
+		protected.GET("/notifications/deliveries", controllers.GetNotificationDeliveries)
+		protected.POST("/notifications/deliveries/:notificationId/retry", controllers.RetryNotificationDelivery)
+
+		// NEWS2 routes
+		protected.GET("/patient/:id/news2", controllers.GetPatientNews2)
+		protected.GET("/patient/:id/news2/history", controllers.GetPatientNews2History)
+
+		// Summary routes
+		protected.GET("/patient/:id/summary", controllers.GetPatientSummary)
+
+		// Personal baseline routes
+		protected.GET("/patient/:id/baselines", controllers.GetPatientBaselines)
+		protected.GET("/patient/:id/deviations", controllers.GetPatientDeviations)
+
 		// Health metrics routes
 		protected.GET("/api/health-metrics/:patientId", controllers.GetPatientHealthMetrics)
+		protected.POST("/api/health-metrics/:patientId", controllers.IngestPatientHealthMetrics)
+		protected.GET("/patient/:id/derived-metrics", controllers.GetPatientDerivedMetrics)
+		protected.GET("/patient/:id/metrics/export", controllers.ExportPatientMetrics)
+		protected.POST("/patient/:id/imports/preview", controllers.PreviewPatientImport)
+		protected.POST("/patient/:id/imports", controllers.ImportPatientMetrics)
+		protected.GET("/patient/:id/imports", controllers.GetPatientImports)
+		protected.GET("/patient/:id/imports/:importId", controllers.GetPatientImport)
+		protected.POST("/patient/:id/imports/:importId/undo", controllers.UndoPatientImport)
+
+		// FHIR routes
+		protected.GET("/fhir/Patient", controllers.SearchFHIRPatients)
+		protected.GET("/fhir/Patient/:id", controllers.GetFHIRPatient)
+		protected.GET("/fhir/Patient/:id/$everything", controllers.GetFHIRPatientEverything)
+		protected.GET("/fhir/Observation", controllers.SearchFHIRObservations)
+		protected.GET("/fhir/Observation/:id", controllers.GetFHIRObservation)
 
 		// Household routes
 		protected.GET("/household/patients", controllers.GetHouseholdPatients)
+		protected.GET("/household/appointments/upcoming", controllers.GetHouseholdUpcomingAppointments)
+		protected.GET("/household/care-notes/search", controllers.SearchHouseholdCareNotes)
+		protected.GET("/household/immunizations/forecast", controllers.GetHouseholdImmunizationForecast)
+		protected.GET("/household/alerts", controllers.GetHouseholdAlerts)
+		protected.POST("/household/alerts/acknowledge", controllers.BulkAcknowledgeHouseholdAlerts)
+		protected.GET("/household/alerts/stats", controllers.GetHouseholdAlertStats)
+		protected.GET("/household/alerts/tuning", controllers.GetHouseholdAlertTuningReport)
+		protected.GET("/household/escalation-policy", controllers.GetEscalationPolicy)
+		protected.PUT("/household/escalation-policy", controllers.UpdateEscalationPolicy)
+		protected.DELETE("/household/escalation-policy", controllers.DeleteEscalationPolicy)
 		protected.POST("/create-invitation", controllers.CreateInvitation)
 		protected.POST("/respond-invitation", controllers.RespondToInvitation)
 		protected.GET("/invitations", controllers.GetInvitations)
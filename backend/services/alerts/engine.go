@@ -0,0 +1,192 @@
+package alerts
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"my-health/models"
+	"my-health/services/observations"
+)
+
+// MaxReadingAge is how old a reading may be and still raise an alert; older
+// readings, e.g. synced late or imported, are stored without alerting
+var MaxReadingAge = 24 * time.Hour
+
+var metricLabels = map[string]string{
+	models.MetricHeartRate:        "Heart rate",
+	models.MetricSystolicBP:       "Systolic pressure",
+	models.MetricDiastolicBP:      "Diastolic pressure",
+	models.MetricOxygenSaturation: "SpO2",
+	models.MetricWeight:           "Weight",
+	models.MetricFallDetected:     "Fall detected",
+	models.MetricIrregularRhythm:  "Irregular heart rhythm detected",
+}
+
+// format prints a value with at most one decimal
+func format(v float64) string {
+	return strconv.FormatFloat(math.Round(v*10)/10, 'f', -1, 64)
+}
+
+// message describes a breach in plain language
+func message(rule Rule, severity string, v, limit float64) string {
+	label := metricLabels[rule.Metric]
+	unit := models.MetricUnits[rule.Metric]
+	switch rule.Condition {
+	case ConditionEvent:
+		return label
+	case ConditionRise:
+		return fmt.Sprintf("%s rose %s %s in %d days (%s threshold %s %s)", label, format(v), unit, rule.WindowDays, severity, format(limit), unit)
+	case ConditionBelow:
+		return fmt.Sprintf("%s %s %s is below the %s threshold of %s %s", label, format(v), unit, severity, format(limit), unit)
+	}
+	return fmt.Sprintf("%s %s %s is above the %s threshold of %s %s", label, format(v), unit, severity, format(limit), unit)
+}
+
+// Check evaluates newly stored observations against each patient's rules and
+// raises, or adds to, alerts. It returns the alerts that were newly raised.
+// Mock readings are skipped: synthetic values must not page anyone.
+func Check(db *gorm.DB, list []models.Observation) ([]models.Alert, error) {
+	now := time.Now()
+	rulesByPatient := map[uint][]Rule{}
+	var raised []models.Alert
+
+	for _, o := range list {
+		if o.Status == models.ObservationEnteredInError || o.Source == models.SourceMock ||
+			now.Sub(o.EffectiveAt) > MaxReadingAge {
+			continue
+		}
+
+		rules, ok := rulesByPatient[o.PatientID]
+		if !ok {
+			var err error
+			if rules, err = RulesForPatient(db, o.PatientID); err != nil {
+				return raised, err
+			}
+			rulesByPatient[o.PatientID] = rules
+		}
+
+		for _, rule := range rules {
+			if !rule.Enabled {
+				continue
+			}
+			v, ok := observations.Value(o, rule.Metric)
+			if !ok {
+				continue
+			}
+			if rule.Condition == ConditionRise {
+				rise, ok, err := riseOverWindow(db, o, v, rule.WindowDays)
+				if err != nil {
+					return raised, err
+				}
+				if !ok {
+					continue
+				}
+				v = rise
+			}
+
+			severity, limit, breached := rule.Breach(v)
+			if !breached {
+				continue
+			}
+			alert, isNew, err := raise(db, rule, o, severity, v, limit, now)
+			if err != nil {
+				return raised, err
+			}
+			if alert.ID == 0 {
+				continue
+			}
+			if isNew {
+				raised = append(raised, alert)
+				if err := db.Create(&models.AlertEvent{AlertID: alert.ID, Type: models.AlertEventRaised, Comment: alert.Message}).Error; err != nil {
+					return raised, err
+				}
+				notifyRaised(db, alert)
+			}
+			// An alert that was not severe enough to escalate may become so on a later breach
+			if err := startEscalation(db, &alert, now); err != nil {
+				return raised, err
+			}
+		}
+	}
+	return raised, nil
+}
+
+// riseOverWindow returns how much the reading is above the lowest reading of the
+// same metric in the preceding window, or false if there is no earlier reading
+func riseOverWindow(db *gorm.DB, o models.Observation, v float64, days int) (float64, bool, error) {
+	var lowest *float64
+	err := db.Model(&models.Observation{}).
+		Select("MIN(value)").
+		Where("patient_id = ? AND metric = ? AND status <> ?", o.PatientID, o.Metric, models.ObservationEnteredInError).
+		Where("effective_at >= ? AND effective_at < ?", o.EffectiveAt.AddDate(0, 0, -days), o.EffectiveAt).
+		Scan(&lowest).Error
+	if err != nil || lowest == nil {
+		return 0, false, err
+	}
+	return v - *lowest, true, nil
+}
+
+// raise records a breach. An open alert for the same rule is updated instead of
+// raising another, and a recently closed one suppresses the breach until its
+// cool-down ends.
+func raise(db *gorm.DB, rule Rule, o models.Observation, severity string, v, limit float64, now time.Time) (models.Alert, bool, error) {
+	var latest models.Alert
+	if err := db.Where("patient_id = ? AND rule_key = ?", o.PatientID, rule.Key).
+		Order("id DESC").Limit(1).Find(&latest).Error; err != nil {
+		return latest, false, err
+	}
+	if latest.ID != 0 && latest.ClosedAt != nil && now.Before(latest.CooldownUntil) {
+		return models.Alert{}, false, nil
+	}
+
+	alert := models.Alert{
+		PatientID:     o.PatientID,
+		RuleKey:       rule.Key,
+		Metric:        rule.Metric,
+		Severity:      severity,
+		Status:        models.AlertOpen,
+		Message:       message(rule, severity, v, limit),
+		Value:         v,
+		Threshold:     limit,
+		ObservationID: o.ID,
+		Occurrences:   1,
+		FirstSeenAt:   o.EffectiveAt,
+		LastSeenAt:    o.EffectiveAt,
+		CooldownUntil: now.Add(rule.Cooldown),
+	}
+	if latest.ID == 0 || latest.ClosedAt != nil {
+		// The partial unique index on open alerts makes concurrent raises of the same rule collapse into one
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&alert)
+		if result.Error != nil {
+			return alert, false, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return alert, true, nil
+		}
+		if err := db.Where("patient_id = ? AND rule_key = ? AND closed_at IS NULL", o.PatientID, rule.Key).
+			First(&latest).Error; err != nil {
+			return alert, false, err
+		}
+	}
+
+	updates := map[string]interface{}{
+		"occurrences":    gorm.Expr("occurrences + 1"),
+		"last_seen_at":   o.EffectiveAt,
+		"cooldown_until": alert.CooldownUntil,
+		"value":          v,
+		"observation_id": o.ID,
+	}
+	if models.AlertSeverityRank[severity] > models.AlertSeverityRank[latest.Severity] {
+		updates["severity"] = severity
+		updates["threshold"] = limit
+		updates["message"] = alert.Message
+		latest.Severity = severity
+	}
+	err := db.Model(&latest).Updates(updates).Error
+	return latest, false, err
+}
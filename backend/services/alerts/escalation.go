@@ -0,0 +1,214 @@
+package alerts
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"my-health/models"
+	"my-health/services/notify"
+)
+
+var (
+	escalationInterval = 30 * time.Second
+	// escalationLease holds a claimed alert while its step runs; if the server
+	// stops before the step is recorded, the step runs again once it expires
+	escalationLease = 5 * time.Minute
+	escalationBatch = 50
+
+	escalationOnce sync.Once
+)
+
+func orderedSteps(db *gorm.DB) *gorm.DB {
+	return db.Order("position")
+}
+
+// policyFor returns the escalation policy of the patient's household. A patient
+// in several households uses the policy of the oldest one that has a policy.
+func policyFor(db *gorm.DB, patientID uint) (models.EscalationPolicy, bool, error) {
+	var policy models.EscalationPolicy
+	err := db.Preload("Steps", orderedSteps).
+		Joins("JOIN households ON households.id = escalation_policies.household_id AND households.deleted_at IS NULL").
+		Joins("JOIN household_patients ON household_patients.household_id = households.id").
+		Where("household_patients.patient_id = ?", patientID).
+		Order("escalation_policies.household_id").Limit(1).
+		Find(&policy).Error
+	return policy, policy.ID != 0, err
+}
+
+// startEscalation schedules the first step of the household's policy for an
+// open, unacknowledged alert that is severe enough and not yet escalating
+func startEscalation(db *gorm.DB, alert *models.Alert, now time.Time) error {
+	if alert.EscalationPolicyID != nil || alert.AcknowledgedAt != nil || alert.ClosedAt != nil {
+		return nil
+	}
+	policy, found, err := policyFor(db, alert.PatientID)
+	if err != nil || !found || len(policy.Steps) == 0 {
+		return err
+	}
+	if models.AlertSeverityRank[alert.Severity] < models.AlertSeverityRank[policy.MinSeverity] {
+		return nil
+	}
+
+	next := now.Add(time.Duration(policy.Steps[0].TimeoutMinutes) * time.Minute)
+	if err := db.Model(&models.Alert{}).
+		Where("id = ? AND escalation_policy_id IS NULL", alert.ID).
+		Updates(map[string]interface{}{"escalation_policy_id": policy.ID, "next_escalation_at": next}).Error; err != nil {
+		return err
+	}
+	alert.EscalationPolicyID = &policy.ID
+	alert.NextEscalationAt = &next
+	return nil
+}
+
+// StartEscalationWorker starts the background worker that runs due escalation steps
+func StartEscalationWorker(db *gorm.DB) {
+	escalationOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(escalationInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				if _, err := EscalateDue(db, time.Now()); err != nil {
+					log.Printf("Error escalating alerts: %v", err)
+				}
+			}
+		}()
+	})
+}
+
+// EscalateDue runs the next escalation step of every alert whose step is due
+// and returns how many alerts it claimed. Claiming with SKIP LOCKED lets
+// several servers share the work without running a step twice.
+func EscalateDue(db *gorm.DB, now time.Time) (int, error) {
+	var ids []uint
+	if err := db.Raw(`UPDATE alerts SET next_escalation_at = ?
+		WHERE id IN (
+			SELECT id FROM alerts
+			WHERE next_escalation_at <= ? AND acknowledged_at IS NULL AND closed_at IS NULL AND deleted_at IS NULL
+			ORDER BY next_escalation_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id`,
+		now.Add(escalationLease), now, escalationBatch).
+		Scan(&ids).Error; err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err := escalate(db, id, now); err != nil {
+			log.Printf("Error escalating alert %d: %v", id, err)
+		}
+	}
+	return len(ids), nil
+}
+
+// escalate runs the alert's next step, records it on the timeline and
+// schedules the step after it, all in one transaction
+func escalate(db *gorm.DB, alertID uint, now time.Time) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var alert models.Alert
+		if err := tx.First(&alert, alertID).Error; err != nil {
+			return err
+		}
+		stop := func() error {
+			return tx.Model(&alert).Update("next_escalation_at", nil).Error
+		}
+		if alert.AcknowledgedAt != nil || alert.ClosedAt != nil || alert.EscalationPolicyID == nil {
+			return stop()
+		}
+
+		var policy models.EscalationPolicy
+		if err := tx.Preload("Steps", orderedSteps).Limit(1).Find(&policy, *alert.EscalationPolicyID).Error; err != nil {
+			return err
+		}
+		if alert.EscalationStep >= len(policy.Steps) {
+			// The policy was removed or shortened since the alert started escalating
+			return stop()
+		}
+
+		var patient models.Patient
+		if err := tx.First(&patient, alert.PatientID).Error; err != nil {
+			return err
+		}
+
+		step := policy.Steps[alert.EscalationStep]
+		event, err := runStep(tx, alert, patient, step)
+		if err != nil {
+			return err
+		}
+		event.Step = alert.EscalationStep + 1
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+
+		var next *time.Time
+		if alert.EscalationStep+1 < len(policy.Steps) {
+			at := now.Add(time.Duration(policy.Steps[alert.EscalationStep+1].TimeoutMinutes) * time.Minute)
+			next = &at
+		}
+		return tx.Model(&alert).Updates(map[string]interface{}{
+			"escalation_step":    alert.EscalationStep + 1,
+			"next_escalation_at": next,
+		}).Error
+	})
+}
+
+// runStep queues the step's notification and returns the timeline event
+// describing it. A step that cannot reach its recipient is recorded as skipped.
+func runStep(tx *gorm.DB, alert models.Alert, patient models.Patient, step models.EscalationStep) (models.AlertEvent, error) {
+	event := models.AlertEvent{AlertID: alert.ID, Type: models.AlertEventEscalated, Channel: step.Channel}
+	skip := func(reason string) (models.AlertEvent, error) {
+		event.Type = models.AlertEventSkipped
+		event.Comment = reason
+		return event, nil
+	}
+	data := alertData(alert, patient)
+
+	switch step.Target {
+	case models.EscalateToEmergencyContact:
+		contact := patient.EmergencyContact
+		if contact.PhoneNumber == "" {
+			return skip("the patient has no emergency contact phone number")
+		}
+		event.Recipient = contact.Name
+		if contact.Relationship != "" {
+			event.Recipient += " (" + contact.Relationship + ")"
+		}
+		_, err := notify.Send(tx, 0, step.Channel, contact.PhoneNumber, notify.EventAlertEscalated, data, true)
+		return event, err
+
+	case models.EscalateToUser:
+		if step.UserID == nil {
+			return skip("the step has no user")
+		}
+		var user models.User
+		if err := tx.Limit(1).Find(&user, *step.UserID).Error; err != nil {
+			return event, err
+		}
+		if user.ID == 0 {
+			return skip("the user no longer exists")
+		}
+		event.Recipient = user.Username
+
+		address := ""
+		if step.Channel != models.ChannelInApp {
+			var pref models.NotificationPreference
+			if err := tx.Where("user_id = ? AND channel = ?", user.ID, step.Channel).Limit(1).Find(&pref).Error; err != nil {
+				return event, err
+			}
+			address = pref.Address
+			if address == "" {
+				event.Channel = models.ChannelInApp
+				event.Comment = fmt.Sprintf("%s has no %s address, sent to the in-app inbox instead", user.Username, step.Channel)
+			}
+		}
+		_, err := notify.Send(tx, user.ID, event.Channel, address, notify.EventAlertEscalated, data, true)
+		return event, err
+	}
+	return skip(fmt.Sprintf("unknown target %q", step.Target))
+}
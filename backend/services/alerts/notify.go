@@ -0,0 +1,61 @@
+package alerts
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+
+	"my-health/models"
+	"my-health/services/notify"
+)
+
+// notifyRaised tells the patient and their caregivers about a new alert;
+// critical alerts are urgent and skip quiet hours. Failures are logged so
+// that they never keep an alert from being recorded.
+func notifyRaised(db *gorm.DB, alert models.Alert) {
+	var patient models.Patient
+	if err := db.Select("id", "name", "surname").First(&patient, alert.PatientID).Error; err != nil {
+		log.Printf("Error fetching patient %d for alert %d: %v", alert.PatientID, alert.ID, err)
+		return
+	}
+	recipients, err := notify.CaregiverIDs(db, alert.PatientID)
+	if err != nil {
+		log.Printf("Error fetching recipients for alert %d: %v", alert.ID, err)
+		return
+	}
+
+	err = notify.Notify(db, recipients, notify.EventAlertRaised, alertData(alert, patient), alert.Severity == models.AlertCritical)
+	if err != nil {
+		log.Printf("Error queueing notifications for alert %d: %v", alert.ID, err)
+	}
+}
+
+// NotifyAssigned tells a caregiver that an alert was assigned to them
+func NotifyAssigned(db *gorm.DB, alert models.Alert) {
+	if alert.AssignedToID == nil {
+		return
+	}
+	var patient models.Patient
+	if err := db.Select("id", "name", "surname").First(&patient, alert.PatientID).Error; err != nil {
+		log.Printf("Error fetching patient %d for alert %d: %v", alert.PatientID, alert.ID, err)
+		return
+	}
+	if err := notify.Notify(db, []uint{*alert.AssignedToID}, notify.EventAlertAssigned, alertData(alert, patient), false); err != nil {
+		log.Printf("Error queueing assignment notification for alert %d: %v", alert.ID, err)
+	}
+}
+
+// alertData is the template data describing an alert
+func alertData(alert models.Alert, patient models.Patient) map[string]interface{} {
+	return map[string]interface{}{
+		"AlertID":     alert.ID,
+		"PatientID":   alert.PatientID,
+		"PatientName": patient.Name + " " + patient.Surname,
+		"RuleKey":     alert.RuleKey,
+		"Severity":    alert.Severity,
+		"Message":     alert.Message,
+		"Value":       alert.Value,
+		"Threshold":   alert.Threshold,
+		"SeenAt":      alert.FirstSeenAt.Format("2006-01-02 15:04"),
+	}
+}
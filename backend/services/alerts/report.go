@@ -0,0 +1,142 @@
+package alerts
+
+import (
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+
+	"my-health/models"
+)
+
+// AcknowledgementStats summarises how quickly alerts of one severity were
+// acknowledged; Severity is empty for the total over all severities
+type AcknowledgementStats struct {
+	Severity       string   `json:"severity"`
+	Alerts         int      `json:"alerts"`
+	Acknowledged   int      `json:"acknowledged"`
+	MeanSeconds    *float64 `json:"mean_seconds"`
+	MedianSeconds  *float64 `json:"median_seconds"`
+	FalsePositives int      `json:"false_positives"`
+}
+
+// AcknowledgementTimes computes mean and median time to acknowledge for the
+// patients' alerts raised since the given time, per severity and in total
+func AcknowledgementTimes(db *gorm.DB, patientIDs []uint, since time.Time) ([]AcknowledgementStats, error) {
+	stats := []AcknowledgementStats{}
+	if len(patientIDs) == 0 {
+		return stats, nil
+	}
+	err := db.Raw(`SELECT COALESCE(severity, '') AS severity,
+			COUNT(*) AS alerts,
+			COUNT(acknowledged_at) AS acknowledged,
+			AVG(EXTRACT(EPOCH FROM acknowledged_at - created_at))::float8 AS mean_seconds,
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM acknowledged_at - created_at))::float8 AS median_seconds,
+			COUNT(*) FILTER (WHERE status = ?) AS false_positives
+		FROM alerts
+		WHERE patient_id IN ? AND created_at >= ? AND deleted_at IS NULL
+		GROUP BY ROLLUP (severity)
+		ORDER BY GROUPING(severity), severity`,
+		models.AlertFalsePositive, patientIDs, since).Scan(&stats).Error
+	return stats, err
+}
+
+// MinTuningAlerts is how many alerts a rule needs before a threshold change is suggested
+const MinTuningAlerts = 3
+
+// TuningRow reports how often one rule raised false positives for a patient
+type TuningRow struct {
+	PatientID         uint     `json:"patient_id"`
+	RuleKey           string   `json:"rule_key"`
+	Alerts            int      `json:"alerts"`
+	FalsePositives    int      `json:"false_positives"`
+	FalsePositiveRate float64  `json:"false_positive_rate"`
+	MinFalseValue     *float64 `json:"min_false_positive_value"`
+	MaxFalseValue     *float64 `json:"max_false_positive_value"`
+	Rule              *Rule    `json:"rule,omitempty"`
+	SuggestedWarning  *float64 `json:"suggested_warning,omitempty"`
+	Suggestion        string   `json:"suggestion,omitempty"`
+}
+
+// TuningReport lists, per patient and rule, the alerts raised since the given
+// time that caregivers marked as false positives, with a suggested warning
+// level that would have let them pass. Rules without false positives are left out.
+func TuningReport(db *gorm.DB, patientIDs []uint, since time.Time) ([]TuningRow, error) {
+	rows := []TuningRow{}
+	if len(patientIDs) == 0 {
+		return rows, nil
+	}
+	if err := db.Raw(`SELECT patient_id, rule_key,
+			COUNT(*) AS alerts,
+			COUNT(*) FILTER (WHERE status = ?) AS false_positives,
+			MIN(value) FILTER (WHERE status = ?) AS min_false_value,
+			MAX(value) FILTER (WHERE status = ?) AS max_false_value
+		FROM alerts
+		WHERE patient_id IN ? AND created_at >= ? AND deleted_at IS NULL
+		GROUP BY patient_id, rule_key
+		HAVING COUNT(*) FILTER (WHERE status = ?) > 0
+		ORDER BY patient_id, rule_key`,
+		models.AlertFalsePositive, models.AlertFalsePositive, models.AlertFalsePositive,
+		patientIDs, since, models.AlertFalsePositive).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	rulesByPatient := map[uint]map[string]Rule{}
+	for i := range rows {
+		row := &rows[i]
+		rules, ok := rulesByPatient[row.PatientID]
+		if !ok {
+			list, err := RulesForPatient(db, row.PatientID)
+			if err != nil {
+				return nil, err
+			}
+			rules = make(map[string]Rule, len(list))
+			for _, rule := range list {
+				rules[rule.Key] = rule
+			}
+			rulesByPatient[row.PatientID] = rules
+		}
+
+		row.FalsePositiveRate = math.Round(float64(row.FalsePositives)/float64(row.Alerts)*100) / 100
+		if rule, ok := rules[row.RuleKey]; ok {
+			row.Rule = &rule
+			suggest(row, rule)
+		}
+	}
+	return rows, nil
+}
+
+// suggest proposes a warning level just past the false-positive values, when a
+// rule has raised enough alerts and at least half of them were false positives
+func suggest(row *TuningRow, rule Rule) {
+	if row.Alerts < MinTuningAlerts || row.FalsePositiveRate < 0.5 {
+		return
+	}
+	switch rule.Condition {
+	case ConditionEvent:
+		row.Suggestion = "Most of these events were false positives; check the device or disable the rule"
+		return
+	case ConditionBelow:
+		if row.MinFalseValue == nil {
+			return
+		}
+		level := math.Ceil(*row.MinFalseValue) - 1
+		if rule.Critical != nil && level <= *rule.Critical {
+			row.Suggestion = "False positives reach the critical level; review the readings before changing thresholds"
+			return
+		}
+		row.SuggestedWarning = &level
+		row.Suggestion = "Lower the warning threshold to " + format(level) + " " + models.MetricUnits[rule.Metric]
+	default:
+		if row.MaxFalseValue == nil {
+			return
+		}
+		level := math.Floor(*row.MaxFalseValue) + 1
+		if rule.Critical != nil && level >= *rule.Critical {
+			row.Suggestion = "False positives reach the critical level; review the readings before changing thresholds"
+			return
+		}
+		row.SuggestedWarning = &level
+		row.Suggestion = "Raise the warning threshold to " + format(level) + " " + models.MetricUnits[rule.Metric]
+	}
+}
@@ -0,0 +1,135 @@
+package alerts
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"my-health/models"
+)
+
+// Rule conditions
+const (
+	ConditionBelow = "below"
+	ConditionAbove = "above"
+	// ConditionRise compares a reading with the lowest one in the previous WindowDays
+	ConditionRise = "rise"
+	// ConditionEvent fires whenever the event is observed
+	ConditionEvent = "event"
+)
+
+// Rule is an alert condition on one metric. Threshold conditions have a warning
+// and a critical level, either of which may be unset; events use Severity.
+type Rule struct {
+	Key        string        `json:"key"`
+	Metric     string        `json:"metric"`
+	Condition  string        `json:"condition"`
+	Warning    *float64      `json:"warning,omitempty"`
+	Critical   *float64      `json:"critical,omitempty"`
+	Severity   string        `json:"severity,omitempty"`
+	WindowDays int           `json:"window_days,omitempty"`
+	Cooldown   time.Duration `json:"-"`
+	Enabled    bool          `json:"enabled"`
+	// Overridden is set when the patient has their own threshold for the rule
+	Overridden bool `json:"overridden"`
+}
+
+func level(v float64) *float64 {
+	return &v
+}
+
+// DefaultRules apply to every patient unless overridden
+var DefaultRules = []Rule{
+	{Key: "oxygen_saturation_low", Metric: models.MetricOxygenSaturation, Condition: ConditionBelow,
+		Warning: level(92), Critical: level(88), Cooldown: 2 * time.Hour, Enabled: true},
+	{Key: "heart_rate_low", Metric: models.MetricHeartRate, Condition: ConditionBelow,
+		Warning: level(45), Critical: level(35), Cooldown: 2 * time.Hour, Enabled: true},
+	{Key: "heart_rate_high", Metric: models.MetricHeartRate, Condition: ConditionAbove,
+		Warning: level(120), Critical: level(140), Cooldown: 2 * time.Hour, Enabled: true},
+	{Key: "systolic_bp_high", Metric: models.MetricSystolicBP, Condition: ConditionAbove,
+		Warning: level(160), Critical: level(180), Cooldown: 4 * time.Hour, Enabled: true},
+	{Key: "systolic_bp_low", Metric: models.MetricSystolicBP, Condition: ConditionBelow,
+		Warning: level(90), Critical: level(80), Cooldown: 4 * time.Hour, Enabled: true},
+	{Key: "diastolic_bp_high", Metric: models.MetricDiastolicBP, Condition: ConditionAbove,
+		Warning: level(100), Critical: level(120), Cooldown: 4 * time.Hour, Enabled: true},
+	// A quick weight gain is an early sign of fluid retention in heart failure
+	{Key: "weight_gain", Metric: models.MetricWeight, Condition: ConditionRise,
+		Warning: level(2), Critical: level(3), WindowDays: 3, Cooldown: 24 * time.Hour, Enabled: true},
+	{Key: "fall_detected", Metric: models.MetricFallDetected, Condition: ConditionEvent,
+		Severity: models.AlertCritical, Cooldown: 5 * time.Minute, Enabled: true},
+	{Key: "irregular_rhythm", Metric: models.MetricIrregularRhythm, Condition: ConditionEvent,
+		Severity: models.AlertWarning, Cooldown: 12 * time.Hour, Enabled: true},
+}
+
+// DefaultRule looks up a default rule by key
+func DefaultRule(key string) (Rule, bool) {
+	for _, rule := range DefaultRules {
+		if rule.Key == key {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Apply returns the rule with the patient's override applied
+func (r Rule) Apply(override models.AlertThreshold) Rule {
+	r.Enabled = override.Enabled
+	if r.Condition != ConditionEvent {
+		r.Warning = override.Warning
+		r.Critical = override.Critical
+	}
+	if override.CooldownMinutes > 0 {
+		r.Cooldown = time.Duration(override.CooldownMinutes) * time.Minute
+	}
+	r.Overridden = true
+	return r
+}
+
+// RulesForPatient returns the default rules with the patient's overrides applied
+func RulesForPatient(db *gorm.DB, patientID uint) ([]Rule, error) {
+	var overrides []models.AlertThreshold
+	if err := db.Where("patient_id = ?", patientID).Find(&overrides).Error; err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]models.AlertThreshold, len(overrides))
+	for _, override := range overrides {
+		byKey[override.RuleKey] = override
+	}
+
+	rules := make([]Rule, 0, len(DefaultRules))
+	for _, rule := range DefaultRules {
+		if override, ok := byKey[rule.Key]; ok {
+			rule = rule.Apply(override)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Breach checks a value against the rule and returns the severity and the level
+// that was crossed. For ConditionRise the value is the rise over the window.
+func (r Rule) Breach(value float64) (string, float64, bool) {
+	if r.Condition == ConditionEvent {
+		return r.Severity, 0, value != 0
+	}
+
+	crossed := func(limit *float64) bool {
+		if limit == nil {
+			return false
+		}
+		switch r.Condition {
+		case ConditionBelow:
+			return value < *limit
+		case ConditionAbove:
+			return value > *limit
+		}
+		return value >= *limit
+	}
+	if crossed(r.Critical) {
+		return models.AlertCritical, *r.Critical, true
+	}
+	if crossed(r.Warning) {
+		return models.AlertWarning, *r.Warning, true
+	}
+	return "", 0, false
+}
@@ -0,0 +1,94 @@
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"my-health/models"
+)
+
+// ErrInvalidTransition is returned for a status change the workflow does not allow
+var ErrInvalidTransition = errors.New("invalid alert status transition")
+
+// transitions lists the statuses each status may move to. Closed alerts are final.
+var transitions = map[string][]string{
+	models.AlertOpen:         {models.AlertAcknowledged, models.AlertAssigned, models.AlertResolved, models.AlertFalsePositive},
+	models.AlertAcknowledged: {models.AlertAssigned, models.AlertResolved, models.AlertFalsePositive},
+	models.AlertAssigned:     {models.AlertAssigned, models.AlertResolved, models.AlertFalsePositive},
+}
+
+var transitionEvents = map[string]string{
+	models.AlertAcknowledged:  models.AlertEventAcknowledged,
+	models.AlertAssigned:      models.AlertEventAssigned,
+	models.AlertResolved:      models.AlertEventResolved,
+	models.AlertFalsePositive: models.AlertEventFalsePositive,
+}
+
+// IsClosed reports whether the status ends the alert
+func IsClosed(status string) bool {
+	return status == models.AlertResolved || status == models.AlertFalsePositive
+}
+
+// CanTransition reports whether an alert may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Change is a caregiver's status change on an alert
+type Change struct {
+	To      string
+	ActorID uint
+	Comment string
+	// AssigneeID is required when assigning
+	AssigneeID *uint
+}
+
+// Transition moves the alert to a new status and records it on the timeline.
+// Any change stops escalation and, the first time, counts as the
+// acknowledgement. The alert should be locked by the caller's transaction.
+func Transition(tx *gorm.DB, alert *models.Alert, change Change, now time.Time) error {
+	if !CanTransition(alert.Status, change.To) {
+		return fmt.Errorf("%w from %s to %s", ErrInvalidTransition, alert.Status, change.To)
+	}
+	if change.To == models.AlertAssigned && change.AssigneeID == nil {
+		return errors.New("an assignee is required")
+	}
+
+	updates := map[string]interface{}{
+		"status":             change.To,
+		"next_escalation_at": nil,
+	}
+	if alert.AcknowledgedAt == nil {
+		updates["acknowledged_at"] = now
+		updates["acknowledged_by_id"] = change.ActorID
+	}
+	if change.To == models.AlertAssigned {
+		updates["assigned_to_id"] = *change.AssigneeID
+	}
+	if IsClosed(change.To) {
+		updates["closed_at"] = now
+	}
+
+	from := alert.Status
+	if err := tx.Model(alert).Updates(updates).Error; err != nil {
+		return err
+	}
+	return tx.Create(&models.AlertEvent{
+		AlertID:    alert.ID,
+		Type:       transitionEvents[change.To],
+		ActorID:    &change.ActorID,
+		FromStatus: from,
+		ToStatus:   change.To,
+		AssigneeID: change.AssigneeID,
+		Comment:    change.Comment,
+		CreatedAt:  now,
+	}).Error
+}
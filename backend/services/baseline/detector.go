@@ -0,0 +1,199 @@
+package baseline
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"my-health/models"
+)
+
+// Config controls the detector
+type Config struct {
+	// Window is how far back readings count towards the baseline
+	Window time.Duration
+	// MinSamples is how many readings the window needs before anything is flagged
+	MinSamples int
+	// Threshold is the absolute robust z-score from which a reading is flagged
+	Threshold float64
+}
+
+// DefaultConfig uses four weeks of readings and the usual 3.5 cut-off for
+// modified z-scores
+var DefaultConfig = Config{
+	Window:     28 * 24 * time.Hour,
+	MinSamples: 10,
+	Threshold:  3.5,
+}
+
+// Metrics are the vitals that get a personal baseline
+var Metrics = []string{
+	models.MetricHeartRate,
+	models.MetricSystolicBP,
+	models.MetricDiastolicBP,
+	models.MetricOxygenSaturation,
+	models.MetricWeight,
+}
+
+// MinSpread is the smallest MAD used per metric, so that a very steady
+// baseline, e.g. a weight that never changes, does not turn measurement noise
+// into large scores
+var MinSpread = map[string]float64{
+	models.MetricHeartRate:        2,
+	models.MetricSystolicBP:       3,
+	models.MetricDiastolicBP:      2,
+	models.MetricOxygenSaturation: 0.5,
+	models.MetricWeight:           0.2,
+}
+
+var labels = map[string]string{
+	models.MetricHeartRate:        "Heart rate",
+	models.MetricSystolicBP:       "Systolic pressure",
+	models.MetricDiastolicBP:      "Diastolic pressure",
+	models.MetricOxygenSaturation: "SpO2",
+	models.MetricWeight:           "Weight",
+}
+
+// madScale turns a MAD into an estimate of the standard deviation of normally
+// distributed data, giving the modified z-score 0.6745 * (x - median) / MAD
+const madScale = 1.4826
+
+// Point is one reading of a metric
+type Point struct {
+	ID    uint
+	Time  time.Time
+	Value float64
+}
+
+// Stats summarises a set of readings
+type Stats struct {
+	Median  float64
+	MAD     float64
+	Samples int
+}
+
+// Summarize returns the median and median absolute deviation of the values
+func Summarize(values []float64) Stats {
+	if len(values) == 0 {
+		return Stats{}
+	}
+	median := Median(values)
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - median)
+	}
+	return Stats{Median: median, MAD: Median(deviations), Samples: len(values)}
+}
+
+// Median returns the middle of the values, or the mean of the two middle ones
+func Median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// spread is the MAD used for scoring, never below the metric's MinSpread
+func spread(metric string, stats Stats) float64 {
+	return math.Max(stats.MAD, MinSpread[metric])
+}
+
+// Score is the robust z-score of a value against the stats
+func Score(metric string, stats Stats, value float64) float64 {
+	return (value - stats.Median) / (madScale * spread(metric, stats))
+}
+
+// Deviation is a reading flagged as unusual for the patient
+type Deviation struct {
+	ObservationID uint
+	Metric        string
+	Value         float64
+	Time          time.Time
+	Stats         Stats
+	Score         float64
+	Direction     string
+	Explanation   string
+}
+
+// Detect scores each target against the series readings in the window before
+// it and returns the targets that deviate, in time order. The series must be
+// sorted by time; a target that is also in the series is left out of its own
+// baseline. The result depends only on the input.
+func Detect(metric string, series, targets []Point, cfg Config) []Deviation {
+	ordered := append([]Point(nil), targets...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if !ordered[i].Time.Equal(ordered[j].Time) {
+			return ordered[i].Time.Before(ordered[j].Time)
+		}
+		return ordered[i].ID < ordered[j].ID
+	})
+
+	var deviations []Deviation
+	for _, target := range ordered {
+		start := sort.Search(len(series), func(i int) bool { return !series[i].Time.Before(target.Time.Add(-cfg.Window)) })
+		end := sort.Search(len(series), func(i int) bool { return !series[i].Time.Before(target.Time) })
+
+		values := make([]float64, 0, end-start)
+		for _, p := range series[start:end] {
+			if p.ID == 0 || p.ID != target.ID {
+				values = append(values, p.Value)
+			}
+		}
+		if len(values) < cfg.MinSamples {
+			continue
+		}
+
+		stats := Summarize(values)
+		score := Score(metric, stats, target.Value)
+		if math.Abs(score) < cfg.Threshold {
+			continue
+		}
+		direction := models.DeviationHigh
+		if score < 0 {
+			direction = models.DeviationLow
+		}
+		deviations = append(deviations, Deviation{
+			ObservationID: target.ID,
+			Metric:        metric,
+			Value:         target.Value,
+			Time:          target.Time,
+			Stats:         stats,
+			Score:         math.Round(score*100) / 100,
+			Direction:     direction,
+			Explanation:   Explain(metric, stats, target.Value, direction, cfg.Window),
+		})
+	}
+	return deviations
+}
+
+// UsualRange is the band of about two standard deviations around the median
+func UsualRange(metric string, stats Stats) (float64, float64) {
+	width := 2 * madScale * spread(metric, stats)
+	return stats.Median - width, stats.Median + width
+}
+
+// Explain describes a deviation in plain language
+func Explain(metric string, stats Stats, value float64, direction string, window time.Duration) string {
+	unit := models.MetricUnits[metric]
+	low, high := UsualRange(metric, stats)
+	relation := "above"
+	if direction == models.DeviationLow {
+		relation = "below"
+	}
+	return fmt.Sprintf("%s %s %s is %s this patient's usual %s %s (usual range %s-%s %s from %d readings over the last %d days)",
+		labels[metric], format(value), unit, relation, format(stats.Median), unit,
+		format(low), format(high), unit, stats.Samples, int(window.Hours()/24))
+}
+
+// format prints a value with at most one decimal
+func format(v float64) string {
+	return strconv.FormatFloat(math.Round(v*10)/10, 'f', -1, 64)
+}
@@ -0,0 +1,235 @@
+package baseline
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"my-health/models"
+)
+
+var start = time.Date(2026, time.March, 1, 8, 0, 0, 0, time.UTC)
+
+// daily builds one reading a day from start with IDs counting from 1
+func daily(values ...float64) []Point {
+	points := make([]Point, len(values))
+	for i, v := range values {
+		points[i] = Point{ID: uint(i + 1), Time: start.AddDate(0, 0, i), Value: v}
+	}
+	return points
+}
+
+// repeat returns n copies of the pattern, one after another
+func repeat(n int, pattern ...float64) []float64 {
+	var values []float64
+	for i := 0; i < n; i++ {
+		values = append(values, pattern...)
+	}
+	return values
+}
+
+func TestSummarize(t *testing.T) {
+	cases := []struct {
+		name   string
+		values []float64
+		want   Stats
+	}{
+		{"empty", nil, Stats{}},
+		{"single", []float64{72}, Stats{Median: 72, MAD: 0, Samples: 1}},
+		{"odd", []float64{70, 60, 80, 75, 65}, Stats{Median: 70, MAD: 5, Samples: 5}},
+		{"even", []float64{60, 70, 80, 90}, Stats{Median: 75, MAD: 10, Samples: 4}},
+		{"flat", repeat(12, 70), Stats{Median: 70, MAD: 0, Samples: 12}},
+		{"outlier does not move the median", []float64{70, 71, 69, 70, 180}, Stats{Median: 70, MAD: 1, Samples: 5}},
+	}
+	for _, tc := range cases {
+		if got := Summarize(tc.values); got != tc.want {
+			t.Errorf("%s: Summarize = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	cases := []struct {
+		name   string
+		metric string
+		stats  Stats
+		value  float64
+		want   float64
+	}{
+		{"at the median", models.MetricHeartRate, Stats{Median: 70, MAD: 4}, 70, 0},
+		{"above", models.MetricHeartRate, Stats{Median: 70, MAD: 4}, 82, 12 / (madScale * 4)},
+		{"below", models.MetricHeartRate, Stats{Median: 70, MAD: 4}, 58, -12 / (madScale * 4)},
+		{"flat baseline uses the MinSpread floor", models.MetricHeartRate, Stats{Median: 70}, 80, 10 / (madScale * 2)},
+		{"small MAD uses the MinSpread floor", models.MetricWeight, Stats{Median: 80, MAD: 0.05}, 81, 1 / (madScale * 0.2)},
+	}
+	for _, tc := range cases {
+		got := Score(tc.metric, tc.stats, tc.value)
+		if math.IsInf(got, 0) || math.IsNaN(got) || math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%s: Score = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	// Heart rate between 66 and 74 with a MAD of 2
+	varied := repeat(3, 66, 68, 69, 70, 70, 71, 72, 74)
+	day := func(i int) time.Time { return start.AddDate(0, 0, i) }
+
+	cases := []struct {
+		name      string
+		metric    string
+		series    []Point
+		target    Point
+		flagged   bool
+		direction string
+		samples   int
+	}{
+		{
+			name:    "flat series, noise stays under the floor",
+			metric:  models.MetricHeartRate,
+			series:  daily(repeat(20, 70)...),
+			target:  Point{ID: 100, Time: day(20), Value: 80},
+			flagged: false,
+		},
+		{
+			name:      "flat series, a real change is flagged",
+			metric:    models.MetricHeartRate,
+			series:    daily(repeat(20, 70)...),
+			target:    Point{ID: 100, Time: day(20), Value: 81},
+			flagged:   true,
+			direction: models.DeviationHigh,
+			samples:   20,
+		},
+		{
+			name:      "flat weight",
+			metric:    models.MetricWeight,
+			series:    daily(repeat(15, 80)...),
+			target:    Point{ID: 100, Time: day(15), Value: 81.5},
+			flagged:   true,
+			direction: models.DeviationHigh,
+			samples:   15,
+		},
+		{
+			name:      "high spike",
+			metric:    models.MetricHeartRate,
+			series:    daily(varied...),
+			target:    Point{ID: 100, Time: day(24), Value: 120},
+			flagged:   true,
+			direction: models.DeviationHigh,
+			samples:   24,
+		},
+		{
+			name:      "low spike",
+			metric:    models.MetricHeartRate,
+			series:    daily(varied...),
+			target:    Point{ID: 100, Time: day(24), Value: 40},
+			flagged:   true,
+			direction: models.DeviationLow,
+			samples:   24,
+		},
+		{
+			name:    "ordinary reading",
+			metric:  models.MetricHeartRate,
+			series:  daily(varied...),
+			target:  Point{ID: 100, Time: day(24), Value: 73},
+			flagged: false,
+		},
+		{
+			name:    "fewer than MinSamples readings",
+			metric:  models.MetricHeartRate,
+			series:  daily(varied[:9]...),
+			target:  Point{ID: 100, Time: day(9), Value: 150},
+			flagged: false,
+		},
+		{
+			name:    "readings older than the window do not count",
+			metric:  models.MetricHeartRate,
+			series:  daily(varied...),
+			target:  Point{ID: 100, Time: day(24 + 28 - 5), Value: 150},
+			flagged: false,
+		},
+	}
+
+	for _, tc := range cases {
+		got := Detect(tc.metric, tc.series, []Point{tc.target}, DefaultConfig)
+		if !tc.flagged {
+			if len(got) != 0 {
+				t.Errorf("%s: flagged %+v, want nothing", tc.name, got)
+			}
+			continue
+		}
+		if len(got) != 1 {
+			t.Errorf("%s: got %d deviations, want 1", tc.name, len(got))
+			continue
+		}
+		d := got[0]
+		if math.Abs(d.Score) < DefaultConfig.Threshold {
+			t.Errorf("%s: score %v is below the threshold", tc.name, d.Score)
+		}
+		if d.Direction != tc.direction || d.ObservationID != tc.target.ID || d.Value != tc.target.Value ||
+			!d.Time.Equal(tc.target.Time) || d.Metric != tc.metric {
+			t.Errorf("%s: got %+v", tc.name, d)
+		}
+		if d.Stats.Samples != tc.samples {
+			t.Errorf("%s: baseline has %d samples, want %d", tc.name, d.Stats.Samples, tc.samples)
+		}
+		if d.Explanation == "" {
+			t.Errorf("%s: no explanation", tc.name)
+		}
+	}
+}
+
+func TestDetectExcludesTargetFromItsOwnBaseline(t *testing.T) {
+	cfg := DefaultConfig
+	// Nine earlier readings plus the spike itself: counting the spike would
+	// reach MinSamples and flag it against a baseline that contains it
+	points := daily(append(repeat(9, 70), 150)...)
+	spike := points[len(points)-1]
+	if got := Detect(models.MetricHeartRate, points, []Point{spike}, cfg); len(got) != 0 {
+		t.Fatalf("flagged %+v against a baseline that includes the reading itself", got)
+	}
+
+	// Other readings at the same instant are left out too
+	sameInstant := Point{ID: 500, Time: spike.Time, Value: 70}
+	withTwin := append(append([]Point(nil), points[:9]...), sameInstant, spike)
+	if got := Detect(models.MetricHeartRate, withTwin, []Point{spike}, cfg); len(got) != 0 {
+		t.Fatalf("flagged %+v counting a reading taken at the same instant", got)
+	}
+
+	// With a tenth earlier reading the spike is flagged, on ten samples
+	points = daily(append(repeat(10, 70), 150)...)
+	spike = points[len(points)-1]
+	got := Detect(models.MetricHeartRate, points, []Point{spike}, cfg)
+	if len(got) != 1 || got[0].Stats.Samples != 10 || got[0].Stats.Median != 70 {
+		t.Fatalf("got %+v, want one deviation on 10 samples around 70", got)
+	}
+}
+
+func TestDetectIsDeterministic(t *testing.T) {
+	points := daily(append(repeat(3, 66, 68, 69, 70, 70, 71, 72, 74), 120, 71, 40, 70, 125)...)
+	targets := points[24:]
+	reversed := make([]Point, len(targets))
+	for i, p := range targets {
+		reversed[len(targets)-1-i] = p
+	}
+
+	first := Detect(models.MetricHeartRate, points, targets, DefaultConfig)
+	if len(first) != 3 {
+		t.Fatalf("got %d deviations, want 3: %+v", len(first), first)
+	}
+	for i := 1; i < len(first); i++ {
+		if first[i].Time.Before(first[i-1].Time) {
+			t.Fatalf("deviations are not in time order: %+v", first)
+		}
+	}
+	for run := 0; run < 20; run++ {
+		input := targets
+		if run%2 == 1 {
+			input = reversed
+		}
+		if got := Detect(models.MetricHeartRate, points, input, DefaultConfig); !reflect.DeepEqual(got, first) {
+			t.Fatalf("run %d differs:\n got %+v\nwant %+v", run, got, first)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package baseline
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"my-health/models"
+	"my-health/services/observations"
+)
+
+// series loads a patient's readings of a metric in [from, to), oldest first
+func series(db *gorm.DB, patientID uint, metric string, from, to time.Time) ([]Point, error) {
+	var list []models.Observation
+	if err := db.Where("patient_id = ? AND metric = ? AND status <> ?", patientID, observations.Stored(metric), models.ObservationEnteredInError).
+		Where("effective_at >= ? AND effective_at < ?", from, to).
+		Order("effective_at, id").
+		Find(&list).Error; err != nil {
+		return nil, err
+	}
+
+	points := make([]Point, 0, len(list))
+	for _, o := range list {
+		if v, ok := observations.Value(o, metric); ok {
+			points = append(points, Point{ID: o.ID, Time: o.EffectiveAt, Value: v})
+		}
+	}
+	return points, nil
+}
+
+// Observe compares newly stored observations with each patient's baseline at
+// the time of the reading, stores a flag for every deviating one, and then
+// refreshes the patients' current baselines. It returns the new flags.
+func Observe(db *gorm.DB, list []models.Observation) ([]models.DeviationFlag, error) {
+	type key struct {
+		patientID uint
+		metric    string
+	}
+	targets := map[key][]Point{}
+	var order []key
+	for _, o := range list {
+		if o.Status == models.ObservationEnteredInError {
+			continue
+		}
+		for _, metric := range Metrics {
+			v, ok := observations.Value(o, metric)
+			if !ok {
+				continue
+			}
+			k := key{o.PatientID, metric}
+			if _, seen := targets[k]; !seen {
+				order = append(order, k)
+			}
+			targets[k] = append(targets[k], Point{ID: o.ID, Time: o.EffectiveAt, Value: v})
+		}
+	}
+
+	var flags []models.DeviationFlag
+	for _, k := range order {
+		points := targets[k]
+		from, to := points[0].Time, points[0].Time
+		for _, p := range points {
+			if p.Time.Before(from) {
+				from = p.Time
+			}
+			if p.Time.After(to) {
+				to = p.Time
+			}
+		}
+		history, err := series(db, k.patientID, k.metric, from.Add(-DefaultConfig.Window), to)
+		if err != nil {
+			return flags, err
+		}
+
+		for _, d := range Detect(k.metric, history, points, DefaultConfig) {
+			flag := models.DeviationFlag{
+				PatientID:     k.patientID,
+				ObservationID: d.ObservationID,
+				Metric:        d.Metric,
+				Value:         d.Value,
+				EffectiveAt:   d.Time,
+				Median:        d.Stats.Median,
+				MAD:           d.Stats.MAD,
+				Samples:       d.Stats.Samples,
+				Score:         d.Score,
+				Direction:     d.Direction,
+				Explanation:   d.Explanation,
+			}
+			result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&flag)
+			if result.Error != nil {
+				return flags, result.Error
+			}
+			if result.RowsAffected == 1 {
+				flags = append(flags, flag)
+			}
+		}
+
+		if _, err := Refresh(db, k.patientID, k.metric, time.Now()); err != nil {
+			return flags, err
+		}
+	}
+	return flags, nil
+}
+
+// Refresh recomputes and stores a patient's baseline of one metric from the
+// readings in the window before now
+func Refresh(db *gorm.DB, patientID uint, metric string, now time.Time) (models.MetricBaseline, error) {
+	from := now.Add(-DefaultConfig.Window)
+	points, err := series(db, patientID, metric, from, now)
+	if err != nil {
+		return models.MetricBaseline{}, err
+	}
+	values := make([]float64, len(points))
+	for i, p := range points {
+		values[i] = p.Value
+	}
+	stats := Summarize(values)
+
+	baseline := models.MetricBaseline{
+		PatientID:   patientID,
+		Metric:      metric,
+		Median:      stats.Median,
+		MAD:         stats.MAD,
+		Samples:     stats.Samples,
+		WindowStart: from,
+		ComputedAt:  now,
+	}
+	err = db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "patient_id"}, {Name: "metric"}},
+		DoUpdates: clause.AssignmentColumns([]string{"median", "mad", "samples", "window_start", "computed_at", "updated_at"}),
+	}).Create(&baseline).Error
+	return baseline, err
+}
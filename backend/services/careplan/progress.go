@@ -0,0 +1,185 @@
+package careplan
+
+import (
+	"math"
+	"time"
+
+	"my-health/models"
+)
+
+// Trend labels
+const (
+	TrendImproving    = "improving"
+	TrendWorsening    = "worsening"
+	TrendStable       = "stable"
+	TrendInsufficient = "insufficient_data"
+)
+
+type DailyResult struct {
+	Date  string  `json:"date"`
+	Value float64 `json:"value"`
+	Met   bool    `json:"met"`
+}
+
+type GoalProgress struct {
+	Goal          models.CareGoal `json:"goal"`
+	DaysWithData  int             `json:"days_with_data"`
+	DaysMet       int             `json:"days_met"`
+	Adherence     float64         `json:"adherence"` // share of days with data on which the goal was met, 0-1
+	CurrentStreak int             `json:"current_streak"`
+	LongestStreak int             `json:"longest_streak"`
+	Trend         string          `json:"trend"`
+	SlopePerWeek  float64         `json:"slope_per_week"`
+	LatestValue   *float64        `json:"latest_value"`
+	Days          []DailyResult   `json:"days"`
+}
+
+// DailyValues reduces readings to one value per calendar day: the daily total
+// for step counts, which devices report per sync rather than as a running
+// counter, and the mean for everything else
+func DailyValues(metrics []models.HealthMetrics, metric string, loc *time.Location) map[string]float64 {
+	sums := map[string]float64{}
+	counts := map[string]int{}
+	for i := range metrics {
+		value, ok := metrics[i].Value(metric)
+		if !ok {
+			continue
+		}
+		day := metrics[i].Date.In(loc).Format("2006-01-02")
+		if metric == models.MetricStepsCount {
+			sums[day] += value
+			counts[day] = 1
+		} else {
+			sums[day] += value
+			counts[day]++
+		}
+	}
+
+	daily := make(map[string]float64, len(sums))
+	for day, sum := range sums {
+		daily[day] = sum / float64(counts[day])
+	}
+	return daily
+}
+
+// StartOfDay returns midnight at the start of t's day in t's location
+func StartOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// Evaluate computes how often a goal was met each day between from and to (inclusive)
+func Evaluate(goal models.CareGoal, metrics []models.HealthMetrics, from, to time.Time) GoalProgress {
+	loc := from.Location()
+	daily := DailyValues(metrics, goal.Metric, loc)
+
+	progress := GoalProgress{Goal: goal, Days: []DailyResult{}}
+	streak := 0
+	var xs, ys []float64
+
+	start := StartOfDay(from)
+	today := StartOfDay(to.In(loc))
+	if goal.StartDate.After(start) {
+		start = time.Date(goal.StartDate.Year(), goal.StartDate.Month(), goal.StartDate.Day(), 0, 0, 0, 0, loc)
+	}
+	for day := start; !day.After(to); day = day.AddDate(0, 0, 1) {
+		key := day.Format("2006-01-02")
+		value, ok := daily[key]
+		if !ok {
+			// A day without data breaks the streak, except today, which
+			// may simply not have readings yet
+			if !day.Equal(today) {
+				streak = 0
+			}
+			continue
+		}
+
+		met := goal.IsMet(value)
+		progress.DaysWithData++
+		if met {
+			progress.DaysMet++
+			streak++
+			if streak > progress.LongestStreak {
+				progress.LongestStreak = streak
+			}
+		} else {
+			streak = 0
+		}
+
+		v := value
+		progress.LatestValue = &v
+		progress.Days = append(progress.Days, DailyResult{Date: key, Value: value, Met: met})
+		xs = append(xs, day.Sub(start).Hours()/24)
+		ys = append(ys, value)
+	}
+	progress.CurrentStreak = streak
+
+	if progress.DaysWithData > 0 {
+		progress.Adherence = float64(progress.DaysMet) / float64(progress.DaysWithData)
+	}
+
+	progress.Trend = TrendInsufficient
+	if len(xs) >= 3 {
+		slope := linearSlope(xs, ys)
+		progress.SlopePerWeek = slope * 7
+		progress.Trend = trendFor(goal, ys, slope*(xs[len(xs)-1]-xs[0]))
+	}
+
+	return progress
+}
+
+// trendFor labels the change over the period relative to the direction of the goal
+func trendFor(goal models.CareGoal, values []float64, change float64) string {
+	reference := math.Abs(goal.Target)
+	if reference == 0 {
+		reference = math.Abs(mean(values))
+	}
+	// Changes under 2% of the target are noise
+	if reference == 0 || math.Abs(change) < 0.02*reference {
+		return TrendStable
+	}
+
+	switch goal.Comparator {
+	case models.GoalAtLeast:
+		if change > 0 {
+			return TrendImproving
+		}
+	case models.GoalAtMost:
+		if change < 0 {
+			return TrendImproving
+		}
+	case models.GoalBetween:
+		// Moving towards the middle of the band is an improvement
+		center := (goal.Target + goal.TargetMax) / 2
+		latest := values[len(values)-1]
+		earlier := latest - change
+		if math.Abs(latest-center) < math.Abs(earlier-center) {
+			return TrendImproving
+		}
+	}
+	return TrendWorsening
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// linearSlope fits y = a + b*x by least squares and returns b
+func linearSlope(xs, ys []float64) float64 {
+	mx, my := mean(xs), mean(ys)
+	var num, den float64
+	for i := range xs {
+		num += (xs[i] - mx) * (ys[i] - my)
+		den += (xs[i] - mx) * (xs[i] - mx)
+	}
+	if den == 0 {
+		return 0
+	}
+	return num / den
+}
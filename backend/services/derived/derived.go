@@ -0,0 +1,172 @@
+package derived
+
+import (
+	"fmt"
+	"strconv"
+
+	"my-health/models"
+)
+
+// Units of the derived metrics
+var Units = map[string]string{
+	models.MetricBMI:                  "kg/m2",
+	models.MetricMeanArterialPressure: "mmHg",
+	models.MetricPulsePressure:        "mmHg",
+	models.MetricSleepEfficiency:      "%",
+}
+
+// Metrics lists the derived metrics in a stable order
+func Metrics() []string {
+	return []string{
+		models.MetricBMI,
+		models.MetricMeanArterialPressure,
+		models.MetricPulsePressure,
+		models.MetricSleepEfficiency,
+	}
+}
+
+// IsDerived reports whether the metric is computed rather than stored
+func IsDerived(metric string) bool {
+	_, ok := Units[metric]
+	return ok
+}
+
+// BMI is the weight over the square of the height in metres
+func BMI(weightKg, heightCm float64) (float64, bool) {
+	if weightKg <= 0 || heightCm <= 0 {
+		return 0, false
+	}
+	m := heightCm / 100
+	return weightKg / (m * m), true
+}
+
+// MeanArterialPressure estimates the average pressure over a heartbeat as the
+// diastolic pressure plus a third of the pulse pressure
+func MeanArterialPressure(systolic, diastolic float64) float64 {
+	return diastolic + (systolic-diastolic)/3
+}
+
+// PulsePressure is the difference between systolic and diastolic pressure
+func PulsePressure(systolic, diastolic float64) float64 {
+	return systolic - diastolic
+}
+
+// SleepEfficiency is the share of time in bed spent asleep, in percent.
+// Time in bed is the sleep duration plus the minutes awake.
+func SleepEfficiency(sleepHours float64, awakeMinutes float64) (float64, bool) {
+	inBed := sleepHours + awakeMinutes/60
+	if sleepHours <= 0 || inBed <= 0 {
+		return 0, false
+	}
+	return sleepHours / inBed * 100, true
+}
+
+// Category is a named band of values below Below
+type Category struct {
+	Name  string
+	Below float64
+}
+
+// Categories are the standard bands per metric, in increasing order; the last
+// band of each has no upper bound
+var Categories = map[string][]Category{
+	// WHO adult BMI classes
+	models.MetricBMI: {
+		{Name: "underweight", Below: 18.5},
+		{Name: "normal", Below: 25},
+		{Name: "overweight", Below: 30},
+		{Name: "obese_class_1", Below: 35},
+		{Name: "obese_class_2", Below: 40},
+		{Name: "obese_class_3"},
+	},
+	// Below 65 mmHg organs are not perfused reliably
+	models.MetricMeanArterialPressure: {
+		{Name: "low", Below: 65},
+		{Name: "normal", Below: 100},
+		{Name: "high"},
+	},
+	models.MetricPulsePressure: {
+		{Name: "narrow", Below: 25},
+		{Name: "normal", Below: 60},
+		{Name: "wide"},
+	},
+	models.MetricSleepEfficiency: {
+		{Name: "poor", Below: 75},
+		{Name: "fair", Below: 85},
+		{Name: "good"},
+	},
+}
+
+// Classify returns the category of a derived value
+func Classify(metric string, value float64) string {
+	bands := Categories[metric]
+	for i, band := range bands {
+		if i == len(bands)-1 || value < band.Below {
+			return band.Name
+		}
+	}
+	return ""
+}
+
+// Values computes the derived metrics of a reading; metrics whose inputs were
+// not measured are left out. BMI uses the patient's height.
+func Values(h models.HealthMetrics, heightCm float64) map[string]float64 {
+	values := map[string]float64{}
+	if bmi, ok := BMI(h.Weight, heightCm); ok {
+		values[models.MetricBMI] = bmi
+	}
+	if h.SystolicBP > 0 && h.DiastolicBP > 0 {
+		sys, dia := float64(h.SystolicBP), float64(h.DiastolicBP)
+		values[models.MetricMeanArterialPressure] = MeanArterialPressure(sys, dia)
+		values[models.MetricPulsePressure] = PulsePressure(sys, dia)
+	}
+	if efficiency, ok := SleepEfficiency(h.SleepDuration, float64(h.Sleep.AwakeTime)); ok {
+		values[models.MetricSleepEfficiency] = efficiency
+	}
+	return values
+}
+
+// FromObservation computes a derived metric from the observation it is based on
+func FromObservation(o models.Observation, metric string, heightCm float64) (float64, bool) {
+	switch metric {
+	case models.MetricBMI:
+		if o.Metric == models.MetricWeight {
+			return BMI(o.Value, heightCm)
+		}
+	case models.MetricMeanArterialPressure, models.MetricPulsePressure:
+		if o.Metric != models.MetricBloodPressure || o.Value2 == nil {
+			return 0, false
+		}
+		if metric == models.MetricPulsePressure {
+			return PulsePressure(o.Value, *o.Value2), true
+		}
+		return MeanArterialPressure(o.Value, *o.Value2), true
+	case models.MetricSleepEfficiency:
+		if o.Metric == models.MetricSleepDuration {
+			return SleepEfficiency(o.Value, o.Components["awake_time"])
+		}
+	}
+	return 0, false
+}
+
+// Expression returns the observation metric a derived metric is computed from
+// and the SQL computing it from one observations row, matching the functions
+// above. BMI is NULL when the height is unknown.
+func Expression(metric string, heightCm float64) (string, string, error) {
+	switch metric {
+	case models.MetricBMI:
+		if heightCm <= 0 {
+			return models.MetricWeight, "NULL::float8", nil
+		}
+		m := heightCm / 100
+		return models.MetricWeight, "value / " + strconv.FormatFloat(m*m, 'f', -1, 64), nil
+	case models.MetricMeanArterialPressure:
+		return models.MetricBloodPressure, "value2 + (value - value2) / 3", nil
+	case models.MetricPulsePressure:
+		return models.MetricBloodPressure, "value - value2", nil
+	case models.MetricSleepEfficiency:
+		return models.MetricSleepDuration,
+			"value / NULLIF(value + COALESCE((components->>'awake_time')::float8, 0) / 60, 0) * 100", nil
+	}
+	return "", "", fmt.Errorf("%q is not a derived metric", metric)
+}
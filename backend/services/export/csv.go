@@ -0,0 +1,47 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TimeLayout is how local timestamps are written in CSV exports
+const TimeLayout = "2006-01-02 15:04:05"
+
+// WriteCSV writes the selected readings as CSV, one row per reading with a
+// column per selected value. The header names the time zone and units.
+func WriteCSV(w io.Writer, db *gorm.DB, q Query) error {
+	columns := q.Columns()
+	out := csv.NewWriter(w)
+
+	header := []string{"Time (" + q.Location.String() + ")", "Source"}
+	for _, column := range columns {
+		header = append(header, column.Label())
+	}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+
+	record := make([]string, len(header))
+	err := Each(db, q, columns, func(at time.Time, source string, values []*float64) error {
+		record[0] = at.In(q.Location).Format(TimeLayout)
+		record[1] = source
+		for i, value := range values {
+			record[i+2] = ""
+			if value != nil {
+				record[i+2] = strconv.FormatFloat(*value, 'f', -1, 64)
+			}
+		}
+		return out.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+
+	out.Flush()
+	return out.Error()
+}
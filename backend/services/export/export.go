@@ -0,0 +1,282 @@
+package export
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"my-health/models"
+	"my-health/services/observations"
+)
+
+// Column is one exported value: a query metric, or a detail of one such as a
+// sleep stage
+type Column struct {
+	// Metric is the query metric the column belongs to and is selected by
+	Metric string
+	Header string
+	Unit   string
+	// expr reads the value from an observation of the stored metric
+	expr string
+}
+
+// Label is the column header with its unit, e.g. "Heart rate (bpm)"
+func (c Column) Label() string {
+	return fmt.Sprintf("%s (%s)", c.Header, c.Unit)
+}
+
+func (c Column) stored() string {
+	return observations.Stored(c.Metric)
+}
+
+func metricColumn(metric, header string) Column {
+	unit, ok := models.MetricUnits[metric]
+	if !ok {
+		unit = models.ObservationMetrics[metric]
+	}
+	expr := "value"
+	if metric == models.MetricDiastolicBP {
+		expr = "value2"
+	}
+	return Column{Metric: metric, Header: header, Unit: unit, expr: expr}
+}
+
+func componentColumn(metric, component, header, unit string) Column {
+	return Column{Metric: metric, Header: header, Unit: unit,
+		expr: fmt.Sprintf("(components->>'%s')::float8", component)}
+}
+
+// Group is a set of columns exported together, one sheet of an XLSX export
+type Group struct {
+	Name    string
+	Columns []Column
+}
+
+// Groups lists every exported column, grouped and in export order
+var Groups = []Group{
+	{Name: "Vitals", Columns: []Column{
+		metricColumn(models.MetricHeartRate, "Heart rate"),
+		metricColumn(models.MetricSystolicBP, "Systolic pressure"),
+		metricColumn(models.MetricDiastolicBP, "Diastolic pressure"),
+		metricColumn(models.MetricOxygenSaturation, "SpO2"),
+		metricColumn(models.MetricRespirationRate, "Respiration rate"),
+		metricColumn(models.MetricBodyTemperature, "Body temperature"),
+	}},
+	{Name: "Body", Columns: []Column{
+		metricColumn(models.MetricWeight, "Weight"),
+	}},
+	{Name: "Activity", Columns: []Column{
+		metricColumn(models.MetricStepsCount, "Steps"),
+	}},
+	{Name: "Sleep", Columns: []Column{
+		metricColumn(models.MetricSleepDuration, "Sleep duration"),
+		componentColumn(models.MetricSleepDuration, observations.ComponentLight, "Light sleep", "%"),
+		componentColumn(models.MetricSleepDuration, observations.ComponentDeep, "Deep sleep", "%"),
+		componentColumn(models.MetricSleepDuration, observations.ComponentREM, "REM sleep", "%"),
+		componentColumn(models.MetricSleepDuration, observations.ComponentAwakeTime, "Awake", "min"),
+	}},
+	{Name: "Events", Columns: []Column{
+		metricColumn(models.MetricIrregularRhythm, "Irregular rhythm"),
+		metricColumn(models.MetricFallDetected, "Fall detected"),
+	}},
+}
+
+// Query selects the readings of one patient in [From, To) to export
+type Query struct {
+	PatientID uint
+	From      time.Time
+	To        time.Time
+	// Metrics are query metrics such as heart_rate or systolic_bp, or stored
+	// ones such as blood_pressure; empty exports everything
+	Metrics []string
+	// Location is the zone the timestamps are written in
+	Location *time.Location
+}
+
+// Validate checks the query and fills in defaults
+func (q *Query) Validate() error {
+	if !q.To.After(q.From) {
+		return fmt.Errorf("to must be after from")
+	}
+	for _, metric := range q.Metrics {
+		if !knownMetric(metric) {
+			return fmt.Errorf("unknown metric %q", metric)
+		}
+	}
+	if q.Location == nil {
+		q.Location = time.UTC
+	}
+	return nil
+}
+
+func knownMetric(metric string) bool {
+	for _, group := range Groups {
+		for _, column := range group.Columns {
+			if column.Metric == metric || column.stored() == metric {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Groups returns the groups the query selects, holding only selected columns
+func (q Query) Groups() []Group {
+	if len(q.Metrics) == 0 {
+		return Groups
+	}
+	selected := map[string]bool{}
+	for _, metric := range q.Metrics {
+		selected[metric] = true
+	}
+
+	var groups []Group
+	for _, group := range Groups {
+		var columns []Column
+		for _, column := range group.Columns {
+			if selected[column.Metric] || selected[column.stored()] {
+				columns = append(columns, column)
+			}
+		}
+		if len(columns) > 0 {
+			groups = append(groups, Group{Name: group.Name, Columns: columns})
+		}
+	}
+	return groups
+}
+
+// Columns returns the selected columns of all groups
+func (q Query) Columns() []Column {
+	var columns []Column
+	for _, group := range q.Groups() {
+		columns = append(columns, group.Columns...)
+	}
+	return columns
+}
+
+// where selects the valid observations of the query holding the columns
+func (q Query) where(columns []Column) (string, []interface{}) {
+	seen := map[string]bool{}
+	var stored []string
+	for _, column := range columns {
+		if !seen[column.stored()] {
+			seen[column.stored()] = true
+			stored = append(stored, column.stored())
+		}
+	}
+	return "patient_id = ? AND deleted_at IS NULL AND status <> ? AND effective_at >= ? AND effective_at < ? AND metric IN ?",
+		[]interface{}{q.PatientID, models.ObservationEnteredInError, q.From, q.To, stored}
+}
+
+// Each streams the readings holding the columns in time order, calling fn once
+// per reading (same time, source and device) with nil where a column has no
+// value. Rows are read from the database as they are needed.
+func Each(db *gorm.DB, q Query, columns []Column, fn func(at time.Time, source string, values []*float64) error) error {
+	// Column expressions come from the fixed Groups list, so they are safe to
+	// format into the SQL
+	selects := []string{"effective_at", "source"}
+	for _, column := range columns {
+		selects = append(selects, fmt.Sprintf("MAX(%s) FILTER (WHERE metric = '%s')::float8", column.expr, column.stored()))
+	}
+	where, args := q.where(columns)
+
+	rows, err := db.Table("observations").
+		Select(strings.Join(selects, ", ")).
+		Where(where, args...).
+		Group("effective_at, source, device_id").
+		Order("effective_at, source, device_id").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var at time.Time
+	var source string
+	nulls := make([]sql.NullFloat64, len(columns))
+	dest := []interface{}{&at, &source}
+	for i := range nulls {
+		dest = append(dest, &nulls[i])
+	}
+	values := make([]*float64, len(columns))
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, value := range nulls {
+			values[i] = nil
+			if value.Valid {
+				v := value.Float64
+				values[i] = &v
+			}
+		}
+		if err := fn(at, source, values); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Summary describes the values of one column over the exported range
+type Summary struct {
+	Column  Column
+	Count   int
+	Min     *float64
+	Max     *float64
+	Average *float64
+	First   *time.Time
+	Last    *time.Time
+}
+
+// Summarize returns a summary of each column in one query
+func Summarize(db *gorm.DB, q Query, columns []Column) ([]Summary, error) {
+	if len(columns) == 0 {
+		return nil, nil
+	}
+
+	var selects []string
+	for _, column := range columns {
+		filter := fmt.Sprintf("FILTER (WHERE metric = '%s' AND %s IS NOT NULL)", column.stored(), column.expr)
+		selects = append(selects,
+			fmt.Sprintf("COUNT(*) %s", filter),
+			fmt.Sprintf("MIN(%s) %s::float8", column.expr, filter),
+			fmt.Sprintf("MAX(%s) %s::float8", column.expr, filter),
+			fmt.Sprintf("AVG(%s) %s::float8", column.expr, filter),
+			fmt.Sprintf("MIN(effective_at) %s", filter),
+			fmt.Sprintf("MAX(effective_at) %s", filter),
+		)
+	}
+	where, args := q.where(columns)
+
+	summaries := make([]Summary, len(columns))
+	counts := make([]int, len(columns))
+	stats := make([][3]sql.NullFloat64, len(columns))
+	times := make([][2]sql.NullTime, len(columns))
+	var dest []interface{}
+	for i := range columns {
+		dest = append(dest, &counts[i], &stats[i][0], &stats[i][1], &stats[i][2], &times[i][0], &times[i][1])
+	}
+	if err := db.Table("observations").
+		Select(strings.Join(selects, ", ")).
+		Where(where, args...).
+		Row().Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	for i, column := range columns {
+		summaries[i] = Summary{Column: column, Count: counts[i]}
+		if counts[i] == 0 {
+			continue
+		}
+		summaries[i].Min = &stats[i][0].Float64
+		summaries[i].Max = &stats[i][1].Float64
+		summaries[i].Average = &stats[i][2].Float64
+		summaries[i].First = &times[i][0].Time
+		summaries[i].Last = &times[i][1].Time
+	}
+	return summaries, nil
+}
@@ -0,0 +1,253 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxSheetRows is the row limit of an Excel worksheet
+const maxSheetRows = 1048576
+
+// Cell styles defined in stylesXML
+const (
+	styleNone = iota
+	styleDate
+	styleBold
+)
+
+var errSheetFull = errors.New("sheet is full")
+
+const contentTypesXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+%s</Types>`
+
+const rootRelsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+const stylesXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="3">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+</cellXfs>
+</styleSheet>`
+
+const sheetHeaderXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+
+const sheetFooterXML = `</sheetData></worksheet>`
+
+// WriteXLSX writes the selected readings as an Excel workbook: a summary sheet
+// describing the patient, range and each column, then one sheet per metric
+// group with a row per reading. Sheets are written row by row into the zip
+// stream, so the export is never held in memory. A sheet stops at Excel's row
+// limit.
+func WriteXLSX(w io.Writer, db *gorm.DB, q Query, patientName string) error {
+	groups := q.Groups()
+	summaries, err := Summarize(db, q, q.Columns())
+	if err != nil {
+		return err
+	}
+
+	names := []string{"Summary"}
+	for _, group := range groups {
+		names = append(names, group.Name)
+	}
+
+	archive := zip.NewWriter(w)
+	if err := writeWorkbook(archive, names); err != nil {
+		return err
+	}
+
+	summary, err := newSheet(archive, 1, q.Location)
+	if err != nil {
+		return err
+	}
+	summary.row(styleBold, "Patient", patientName)
+	summary.row(styleNone, "From", q.From)
+	summary.row(styleNone, "To", q.To)
+	summary.row(styleNone, "Time zone", q.Location.String())
+	summary.row(styleNone)
+	summary.row(styleBold, "Metric", "Unit", "Readings", "Minimum", "Maximum", "Average", "First reading", "Last reading")
+	for _, s := range summaries {
+		summary.row(styleNone, s.Column.Header, s.Column.Unit, s.Count, s.Min, s.Max, s.Average, s.First, s.Last)
+	}
+	if err := summary.close(); err != nil {
+		return err
+	}
+
+	for i, group := range groups {
+		sheet, err := newSheet(archive, i+2, q.Location)
+		if err != nil {
+			return err
+		}
+		header := []interface{}{"Time", "Source"}
+		for _, column := range group.Columns {
+			header = append(header, column.Label())
+		}
+		sheet.row(styleBold, header...)
+
+		cells := make([]interface{}, len(header))
+		err = Each(db, q, group.Columns, func(at time.Time, source string, values []*float64) error {
+			if sheet.rows >= maxSheetRows {
+				return errSheetFull
+			}
+			cells[0], cells[1] = at, source
+			for i, value := range values {
+				cells[i+2] = value
+			}
+			sheet.row(styleNone, cells...)
+			return sheet.err
+		})
+		if err != nil && !errors.Is(err, errSheetFull) {
+			return err
+		}
+		if err := sheet.close(); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// writeWorkbook writes the package parts that list the sheets
+func writeWorkbook(archive *zip.Writer, names []string) error {
+	var overrides, sheets, rels string
+	for i, name := range names {
+		overrides += fmt.Sprintf(`<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`+"\n", i+1)
+		sheets += fmt.Sprintf(`<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(name), i+1, i+1)
+		rels += fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`+"\n", i+1, i+1)
+	}
+	rels += fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`+"\n", len(names)+1)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", fmt.Sprintf(contentTypesXML, overrides)},
+		{"_rels/.rels", rootRelsXML},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>` + sheets + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+` + rels + `</Relationships>`},
+		{"xl/styles.xml", stylesXML},
+	}
+	for _, part := range parts {
+		f, err := archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sheet writes one worksheet into the zip stream. Write errors are kept in err
+// and returned by close.
+type sheet struct {
+	out  *bufio.Writer
+	loc  *time.Location
+	rows int
+	err  error
+}
+
+func newSheet(archive *zip.Writer, number int, loc *time.Location) (*sheet, error) {
+	f, err := archive.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", number))
+	if err != nil {
+		return nil, err
+	}
+	s := &sheet{out: bufio.NewWriter(f), loc: loc}
+	_, s.err = s.out.WriteString(sheetHeaderXML)
+	return s, nil
+}
+
+// row appends a row of cells. Strings are written as text, numbers as numbers
+// and times as local dates; nil values leave the cell empty.
+func (s *sheet) row(style int, cells ...interface{}) {
+	if s.err != nil {
+		return
+	}
+	s.rows++
+	fmt.Fprintf(s.out, `<row r="%d">`, s.rows)
+	for i, value := range cells {
+		ref := columnName(i) + strconv.Itoa(s.rows)
+		switch v := value.(type) {
+		case string:
+			fmt.Fprintf(s.out, `<c r="%s" s="%d" t="inlineStr"><is><t>%s</t></is></c>`, ref, style, escape(v))
+		case int:
+			fmt.Fprintf(s.out, `<c r="%s" s="%d"><v>%d</v></c>`, ref, style, v)
+		case float64:
+			s.number(ref, style, v)
+		case *float64:
+			if v != nil {
+				s.number(ref, style, *v)
+			}
+		case time.Time:
+			s.number(ref, styleDate, serialDate(v.In(s.loc)))
+		case *time.Time:
+			if v != nil {
+				s.number(ref, styleDate, serialDate(v.In(s.loc)))
+			}
+		}
+	}
+	_, s.err = s.out.WriteString("</row>")
+}
+
+func (s *sheet) number(ref string, style int, v float64) {
+	fmt.Fprintf(s.out, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style, strconv.FormatFloat(v, 'f', -1, 64))
+}
+
+func (s *sheet) close() error {
+	if s.err != nil {
+		return s.err
+	}
+	if _, err := s.out.WriteString(sheetFooterXML); err != nil {
+		return err
+	}
+	return s.out.Flush()
+}
+
+// excelEpoch is day zero of Excel's 1900 date system
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// serialDate converts the wall clock time of t to an Excel date number
+func serialDate(t time.Time) float64 {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	return wall.Sub(excelEpoch).Hours() / 24
+}
+
+// columnName returns the letters of the zero-based column index, e.g. 27 is "AB"
+func columnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+func escape(value string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
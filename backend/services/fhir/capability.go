@@ -0,0 +1,48 @@
+package fhir
+
+import "time"
+
+// searchParam describes a supported search parameter in the CapabilityStatement
+func searchParam(name, kind string) map[string]string {
+	return map[string]string{"name": name, "type": kind}
+}
+
+// CapabilityStatement describes the read-only server: the resources it holds,
+// their interactions and search parameters, and the $everything operation
+func CapabilityStatement(baseURL string) map[string]interface{} {
+	return map[string]interface{}{
+		"resourceType": "CapabilityStatement",
+		"status":       "active",
+		"date":         instant(time.Now()),
+		"kind":         "instance",
+		"implementation": map[string]string{
+			"description": "my-health FHIR API",
+			"url":         baseURL,
+		},
+		"fhirVersion": Version,
+		"format":      []string{"json"},
+		"rest": []map[string]interface{}{{
+			"mode": "server",
+			"resource": []map[string]interface{}{
+				{
+					"type":        "Patient",
+					"interaction": []map[string]string{{"code": "read"}, {"code": "search-type"}},
+					"operation": []map[string]string{{
+						"name":       "everything",
+						"definition": "http://hl7.org/fhir/OperationDefinition/Patient-everything",
+					}},
+				},
+				{
+					"type":        "Observation",
+					"interaction": []map[string]string{{"code": "read"}, {"code": "search-type"}},
+					"searchParam": []map[string]string{
+						searchParam("subject", "reference"),
+						searchParam("patient", "reference"),
+						searchParam("date", "date"),
+						searchParam("code", "token"),
+					},
+				},
+			},
+		}},
+	}
+}
@@ -0,0 +1,323 @@
+package fhir
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"my-health/models"
+)
+
+// dateTimePattern is a FHIR dateTime with seconds, in UTC
+var dateTimePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z$`)
+
+// object marshals v and reads it back as generic JSON, the way a client sees it
+func object(t *testing.T, v interface{}) map[string]interface{} {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	return out
+}
+
+// path walks nested objects and arrays, e.g. path(o, "code", "coding", 0, "system")
+func path(t *testing.T, v interface{}, keys ...interface{}) interface{} {
+	t.Helper()
+	for _, key := range keys {
+		switch k := key.(type) {
+		case string:
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				t.Fatalf("%v: not an object at %q", keys, k)
+			}
+			if v, ok = m[k]; !ok {
+				t.Fatalf("%v: missing %q", keys, k)
+			}
+		case int:
+			list, ok := v.([]interface{})
+			if !ok || k >= len(list) {
+				t.Fatalf("%v: no element %d", keys, k)
+			}
+			v = list[k]
+		}
+	}
+	return v
+}
+
+func expect(t *testing.T, v interface{}, want interface{}, keys ...interface{}) {
+	t.Helper()
+	if got := path(t, v, keys...); !reflect.DeepEqual(got, want) {
+		t.Errorf("%v = %#v, want %#v", keys, got, want)
+	}
+}
+
+var (
+	effective = time.Date(2026, time.May, 4, 9, 30, 0, 0, time.FixedZone("EEST", 3*60*60))
+	stored    = time.Date(2026, time.May, 4, 6, 31, 0, 0, time.UTC)
+)
+
+func patient() models.Patient {
+	return models.Patient{
+		Model:         gorm.Model{ID: 7, UpdatedAt: stored},
+		Name:          "Maria Eleni",
+		Surname:       "Papadopoulou",
+		MedicalRecord: "MR-0042",
+		DateOfBirth:   time.Date(1950, time.February, 3, 0, 0, 0, 0, time.UTC),
+		Gender:        "Female",
+		Address:       "Odos 1, Athens",
+	}
+}
+
+func heartRate() models.Observation {
+	return models.Observation{
+		Model:       gorm.Model{ID: 31, CreatedAt: stored, UpdatedAt: stored},
+		PatientID:   7,
+		Metric:      models.MetricHeartRate,
+		Value:       72,
+		EffectiveAt: effective,
+		Source:      "watch",
+		DeviceID:    "W-1",
+		Status:      models.ObservationFinal,
+	}
+}
+
+func bloodPressure() models.Observation {
+	diastolic := 81.0
+	return models.Observation{
+		Model:       gorm.Model{ID: 32, CreatedAt: stored, UpdatedAt: stored},
+		PatientID:   7,
+		Metric:      models.MetricBloodPressure,
+		Value:       128,
+		Value2:      &diastolic,
+		EffectiveAt: effective,
+		Status:      models.ObservationFinal,
+	}
+}
+
+func TestPatientResource(t *testing.T) {
+	p := object(t, PatientResource(patient()))
+
+	expect(t, p, "Patient", "resourceType")
+	expect(t, p, "7", "id")
+	expect(t, p, true, "active")
+	expect(t, p, "female", "gender")
+	expect(t, p, "1950-02-03", "birthDate")
+	expect(t, p, "2026-05-04T06:31:00Z", "meta", "lastUpdated")
+	expect(t, p, "Papadopoulou", "name", 0, "family")
+	expect(t, p, []interface{}{"Maria", "Eleni"}, "name", 0, "given")
+	expect(t, p, SystemIdentifierType, "identifier", 0, "type", "coding", 0, "system")
+	expect(t, p, "MR", "identifier", 0, "type", "coding", 0, "code")
+	expect(t, p, "MR-0042", "identifier", 0, "value")
+	expect(t, p, "Odos 1, Athens", "address", 0, "text")
+
+	// Empty elements are left out rather than sent as "" or []
+	bare := object(t, PatientResource(models.Patient{Model: gorm.Model{ID: 8}}))
+	for _, key := range []string{"identifier", "name", "gender", "birthDate", "address"} {
+		if _, ok := bare[key]; ok {
+			t.Errorf("empty %s is present: %#v", key, bare[key])
+		}
+	}
+}
+
+func TestObservationResource(t *testing.T) {
+	resource, ok := ObservationResource(heartRate())
+	if !ok {
+		t.Fatal("heart rate has no LOINC code")
+	}
+	o := object(t, resource)
+
+	expect(t, o, "Observation", "resourceType")
+	expect(t, o, "31", "id")
+	expect(t, o, "final", "status")
+	expect(t, o, SystemObservationCategory, "category", 0, "coding", 0, "system")
+	expect(t, o, CategoryVitalSigns, "category", 0, "coding", 0, "code")
+	expect(t, o, SystemLOINC, "code", "coding", 0, "system")
+	expect(t, o, "8867-4", "code", "coding", 0, "code")
+	expect(t, o, "Patient/7", "subject", "reference")
+	expect(t, o, "2026-05-04T06:30:00Z", "effectiveDateTime")
+	expect(t, o, 72.0, "valueQuantity", "value")
+	expect(t, o, SystemUCUM, "valueQuantity", "system")
+	expect(t, o, "/min", "valueQuantity", "code")
+	expect(t, o, "watch W-1", "device", "display")
+	for _, key := range []string{"effectiveDateTime", "issued"} {
+		if value, _ := o[key].(string); !dateTimePattern.MatchString(value) {
+			t.Errorf("%s = %q is not a UTC dateTime", key, value)
+		}
+	}
+	if _, ok := o["component"]; ok {
+		t.Errorf("single value has components: %#v", o["component"])
+	}
+
+	entered := heartRate()
+	entered.Status = models.ObservationEnteredInError
+	resource, _ = ObservationResource(entered)
+	expect(t, object(t, resource), "entered-in-error", "status")
+
+	if _, ok := ObservationResource(models.Observation{Metric: models.MetricFallDetected}); ok {
+		t.Error("fall_detected has no LOINC code but was exported")
+	}
+}
+
+func TestObservationResourceBloodPressure(t *testing.T) {
+	resource, ok := ObservationResource(bloodPressure())
+	if !ok {
+		t.Fatal("blood pressure has no LOINC code")
+	}
+	o := object(t, resource)
+
+	expect(t, o, SystemLOINC, "code", "coding", 0, "system")
+	expect(t, o, "85354-9", "code", "coding", 0, "code")
+	expect(t, o, "Patient/7", "subject", "reference")
+	if _, ok := o["valueQuantity"]; ok {
+		t.Errorf("panel has a value of its own: %#v", o["valueQuantity"])
+	}
+
+	components := []struct {
+		code  string
+		value float64
+	}{{"8480-6", 128}, {"8462-4", 81}}
+	if got := len(path(t, o, "component").([]interface{})); got != len(components) {
+		t.Fatalf("%d components, want %d", got, len(components))
+	}
+	for i, c := range components {
+		expect(t, o, SystemLOINC, "component", i, "code", "coding", 0, "system")
+		expect(t, o, c.code, "component", i, "code", "coding", 0, "code")
+		expect(t, o, c.value, "component", i, "valueQuantity", "value")
+		expect(t, o, SystemUCUM, "component", i, "valueQuantity", "system")
+		expect(t, o, "mm[Hg]", "component", i, "valueQuantity", "code")
+	}
+}
+
+func TestSearchSetBundle(t *testing.T) {
+	const base = "https://example.org/fhir"
+	hr, _ := ObservationResource(heartRate())
+	bp, _ := ObservationResource(bloodPressure())
+	self := base + "/Observation?patient=7&_count=2"
+	next := base + "/Observation?patient=7&_count=2&_offset=2"
+
+	b := object(t, SearchSet(self, next, 5, []BundleEntry{Entry(base, hr, "match"), Entry(base, bp, "match")}))
+
+	expect(t, b, "Bundle", "resourceType")
+	expect(t, b, "searchset", "type")
+	expect(t, b, 5.0, "total")
+	expect(t, b, "self", "link", 0, "relation")
+	expect(t, b, self, "link", 0, "url")
+	expect(t, b, "next", "link", 1, "relation")
+	expect(t, b, next, "link", 1, "url")
+	expect(t, b, base+"/Observation/31", "entry", 0, "fullUrl")
+	expect(t, b, "match", "entry", 0, "search", "mode")
+	expect(t, b, "Observation", "entry", 1, "resource", "resourceType")
+	expect(t, b, "85354-9", "entry", 1, "resource", "code", "coding", 0, "code")
+
+	// The last page links only to itself, and an empty result still has a total
+	last := object(t, SearchSet(self, "", 0, nil))
+	expect(t, last, 0.0, "total")
+	if got := len(path(t, last, "link").([]interface{})); got != 1 {
+		t.Errorf("last page has %d links, want 1", got)
+	}
+	if _, ok := last["entry"]; ok {
+		t.Errorf("empty result has entries: %#v", last["entry"])
+	}
+}
+
+func TestEverythingBundle(t *testing.T) {
+	const base = "https://example.org/fhir"
+	hr, _ := ObservationResource(heartRate())
+	bp, _ := ObservationResource(bloodPressure())
+	self := base + "/Patient/7/$everything"
+
+	// As GetFHIRPatientEverything builds it: the patient, then its observations
+	entries := []BundleEntry{
+		Entry(base, PatientResource(patient()), "match"),
+		Entry(base, hr, "include"),
+		Entry(base, bp, "include"),
+	}
+	b := object(t, SearchSet(self, "", 3, entries))
+
+	expect(t, b, "Bundle", "resourceType")
+	expect(t, b, "searchset", "type")
+	expect(t, b, 3.0, "total")
+	expect(t, b, "self", "link", 0, "relation")
+	expect(t, b, self, "link", 0, "url")
+	expect(t, b, base+"/Patient/7", "entry", 0, "fullUrl")
+	expect(t, b, "Patient", "entry", 0, "resource", "resourceType")
+	expect(t, b, "match", "entry", 0, "search", "mode")
+	for i := 1; i < len(entries); i++ {
+		expect(t, b, "Observation", "entry", i, "resource", "resourceType")
+		expect(t, b, "include", "entry", i, "search", "mode")
+		expect(t, b, "Patient/7", "entry", i, "resource", "subject", "reference")
+	}
+	if updated, _ := path(t, b, "meta", "lastUpdated").(string); !dateTimePattern.MatchString(updated) {
+		t.Errorf("meta.lastUpdated = %q is not a UTC dateTime", updated)
+	}
+}
+
+func TestParseDates(t *testing.T) {
+	day := func(month time.Month, d int) time.Time { return time.Date(2024, month, d, 0, 0, 0, 0, time.UTC) }
+	cases := []struct {
+		values []string
+		want   Period
+	}{
+		{nil, Period{}},
+		{[]string{"2024-03-01"}, Period{Start: day(3, 1), End: day(3, 2)}},
+		{[]string{"eq2024-03-01"}, Period{Start: day(3, 1), End: day(3, 2)}},
+		{[]string{"eq2024-03"}, Period{Start: day(3, 1), End: day(4, 1)}},
+		{[]string{"eq2024"}, Period{Start: day(1, 1), End: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)}},
+		{[]string{"ge2024-03-01"}, Period{Start: day(3, 1)}},
+		{[]string{"gt2024-03-01"}, Period{Start: day(3, 2)}},
+		{[]string{"le2024-03-01"}, Period{End: day(3, 2)}},
+		{[]string{"lt2024-03-01"}, Period{End: day(3, 1)}},
+		{[]string{"ge2024-03-01", "lt2024-04-01"}, Period{Start: day(3, 1), End: day(4, 1)}},
+		{[]string{"ge2024-01-01", "ge2024-03-01", "le2024-06-30", "le2024-04-30"}, Period{Start: day(3, 1), End: day(5, 1)}},
+		{[]string{"ge2024-03-01T10:00:00+02:00"}, Period{Start: time.Date(2024, time.March, 1, 8, 0, 0, 0, time.UTC)}},
+		{[]string{"gt2024-03-01T08:00:00"}, Period{Start: time.Date(2024, time.March, 1, 8, 0, 1, 0, time.UTC)}},
+	}
+	for _, tc := range cases {
+		got, err := ParseDates(tc.values)
+		if err != nil {
+			t.Errorf("%v: %v", tc.values, err)
+			continue
+		}
+		if !got.Start.Equal(tc.want.Start) || !got.End.Equal(tc.want.End) {
+			t.Errorf("%v: got [%v, %v), want [%v, %v)", tc.values, got.Start, got.End, tc.want.Start, tc.want.End)
+		}
+	}
+
+	for _, bad := range []string{"ne2024-03-01", "sa2024-03-01", "2024-13-01", "yesterday", "ge"} {
+		if _, err := ParseDates([]string{bad}); err == nil {
+			t.Errorf("%q was accepted", bad)
+		}
+	}
+}
+
+func TestParseCodes(t *testing.T) {
+	cases := []struct {
+		value string
+		want  []string
+	}{
+		{"8867-4", []string{models.MetricHeartRate}},
+		{"http://loinc.org|29463-7", []string{models.MetricWeight}},
+		{"8867-4, 29463-7", []string{models.MetricHeartRate, models.MetricWeight}},
+		{"59408-5,2708-6", []string{models.MetricOxygenSaturation}},
+		{"8480-6,8462-4,85354-9", []string{models.MetricBloodPressure}},
+		{"0000-0", []string{}},
+		{"http://snomed.info/sct|8867-4", []string{}},
+		{"unknown,8867-4", []string{models.MetricHeartRate}},
+		{"", []string{}},
+	}
+	for _, tc := range cases {
+		got := ParseCodes(tc.value)
+		if got == nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseCodes(%q) = %#v, want %#v", tc.value, got, tc.want)
+		}
+	}
+}
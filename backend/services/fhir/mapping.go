@@ -0,0 +1,202 @@
+package fhir
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"my-health/models"
+)
+
+// Observation categories
+const (
+	CategoryVitalSigns = "vital-signs"
+	CategoryActivity   = "activity"
+)
+
+// Code is how a metric is coded in an Observation. An SpO2 reading carries
+// the generic saturation code too, as the vital signs profile asks.
+type Code struct {
+	Codings  []Coding
+	Category string
+	// Unit is the UCUM code of the value
+	Unit string
+	// UnitDisplay is the human readable unit
+	UnitDisplay string
+}
+
+func loinc(code, display string) Coding {
+	return Coding{System: SystemLOINC, Code: code, Display: display}
+}
+
+// Blood pressure is a panel whose systolic and diastolic values are components
+var (
+	bloodPressurePanel = loinc("85354-9", "Blood pressure panel with all children optional")
+	systolicPressure   = loinc("8480-6", "Systolic blood pressure")
+	diastolicPressure  = loinc("8462-4", "Diastolic blood pressure")
+)
+
+// Codes maps each observation metric that has a LOINC code to it. Event
+// metrics such as fall_detected have none and are not exported.
+var Codes = map[string]Code{
+	models.MetricHeartRate: {
+		Codings:  []Coding{loinc("8867-4", "Heart rate")},
+		Category: CategoryVitalSigns, Unit: "/min", UnitDisplay: "beats/minute",
+	},
+	models.MetricBloodPressure: {
+		Codings:  []Coding{bloodPressurePanel},
+		Category: CategoryVitalSigns, Unit: "mm[Hg]", UnitDisplay: "mmHg",
+	},
+	models.MetricOxygenSaturation: {
+		Codings: []Coding{
+			loinc("59408-5", "Oxygen saturation in Arterial blood by Pulse oximetry"),
+			loinc("2708-6", "Oxygen saturation in Arterial blood"),
+		},
+		Category: CategoryVitalSigns, Unit: "%", UnitDisplay: "%",
+	},
+	models.MetricWeight: {
+		Codings:  []Coding{loinc("29463-7", "Body weight")},
+		Category: CategoryVitalSigns, Unit: "kg", UnitDisplay: "kg",
+	},
+	models.MetricRespirationRate: {
+		Codings:  []Coding{loinc("9279-1", "Respiratory rate")},
+		Category: CategoryVitalSigns, Unit: "/min", UnitDisplay: "breaths/minute",
+	},
+	models.MetricBodyTemperature: {
+		Codings:  []Coding{loinc("8310-5", "Body temperature")},
+		Category: CategoryVitalSigns, Unit: "Cel", UnitDisplay: "C",
+	},
+	models.MetricStepsCount: {
+		Codings:  []Coding{loinc("55423-8", "Number of steps in unspecified time Pedometer")},
+		Category: CategoryActivity, Unit: "{steps}", UnitDisplay: "steps",
+	},
+	models.MetricSleepDuration: {
+		Codings:  []Coding{loinc("93832-4", "Sleep duration")},
+		Category: CategoryActivity, Unit: "h", UnitDisplay: "hours",
+	},
+}
+
+// Metrics lists the metrics that have a LOINC code
+func Metrics() []string {
+	metrics := make([]string, 0, len(Codes))
+	for metric := range Codes {
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+// MetricForCode returns the metric coded by a LOINC code, including the
+// components of the blood pressure panel
+func MetricForCode(code string) (string, bool) {
+	switch code {
+	case systolicPressure.Code, diastolicPressure.Code:
+		return models.MetricBloodPressure, true
+	}
+	for metric, c := range Codes {
+		for _, coding := range c.Codings {
+			if coding.Code == code {
+				return metric, true
+			}
+		}
+	}
+	return "", false
+}
+
+// instant formats a time as a FHIR dateTime in UTC
+func instant(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// PatientReference is the reference to a patient used as an observation's subject
+func PatientReference(id uint) string {
+	return "Patient/" + strconv.FormatUint(uint64(id), 10)
+}
+
+// genders maps the app's genders to the FHIR administrative genders
+var genders = map[string]string{
+	"male":              "male",
+	"female":            "female",
+	"other":             "other",
+	"prefer_not_to_say": "unknown",
+}
+
+// PatientResource maps a patient to a FHIR Patient. The medical record number
+// becomes an MR identifier.
+func PatientResource(p models.Patient) Patient {
+	resource := Patient{
+		ResourceType: "Patient",
+		ID:           strconv.FormatUint(uint64(p.ID), 10),
+		Meta:         &Meta{LastUpdated: instant(p.UpdatedAt)},
+		Active:       true,
+		Gender:       genders[strings.ToLower(p.Gender)],
+	}
+	if p.MedicalRecord != "" {
+		resource.Identifier = []Identifier{{
+			Use: "usual",
+			Type: &CodeableConcept{
+				Coding: []Coding{{System: SystemIdentifierType, Code: "MR", Display: "Medical record number"}},
+			},
+			Value: p.MedicalRecord,
+		}}
+	}
+	if p.Name != "" || p.Surname != "" {
+		name := HumanName{Use: "official", Text: strings.TrimSpace(p.Name + " " + p.Surname), Family: p.Surname}
+		if p.Name != "" {
+			name.Given = strings.Fields(p.Name)
+		}
+		resource.Name = []HumanName{name}
+	}
+	if !p.DateOfBirth.IsZero() {
+		resource.BirthDate = p.DateOfBirth.Format("2006-01-02")
+	}
+	if p.Address != "" {
+		resource.Address = []Address{{Use: "home", Text: p.Address}}
+	}
+	return resource
+}
+
+// ObservationResource maps an observation to a FHIR Observation. It returns
+// false for metrics without a LOINC code.
+func ObservationResource(o models.Observation) (Observation, bool) {
+	code, ok := Codes[o.Metric]
+	if !ok {
+		return Observation{}, false
+	}
+
+	resource := Observation{
+		ResourceType: "Observation",
+		ID:           strconv.FormatUint(uint64(o.ID), 10),
+		Meta:         &Meta{LastUpdated: instant(o.UpdatedAt)},
+		Status:       strings.ReplaceAll(o.Status, "_", "-"),
+		Category: []CodeableConcept{{
+			Coding: []Coding{{System: SystemObservationCategory, Code: code.Category}},
+		}},
+		Code:              CodeableConcept{Coding: code.Codings, Text: code.Codings[0].Display},
+		Subject:           Reference{Reference: PatientReference(o.PatientID)},
+		EffectiveDateTime: instant(o.EffectiveAt),
+		Issued:            instant(o.CreatedAt),
+	}
+	if resource.Status == "" {
+		resource.Status = "final"
+	}
+	if o.DeviceID != "" || o.Source != "" {
+		resource.Device = &Reference{Display: strings.TrimSpace(o.Source + " " + o.DeviceID)}
+	}
+
+	quantity := func(value float64) *Quantity {
+		return &Quantity{Value: value, Unit: code.UnitDisplay, System: SystemUCUM, Code: code.Unit}
+	}
+	if o.Metric == models.MetricBloodPressure {
+		resource.Component = []ObservationComponent{
+			{Code: CodeableConcept{Coding: []Coding{systolicPressure}}, ValueQuantity: quantity(o.Value)},
+		}
+		if o.Value2 != nil {
+			resource.Component = append(resource.Component, ObservationComponent{
+				Code: CodeableConcept{Coding: []Coding{diastolicPressure}}, ValueQuantity: quantity(*o.Value2),
+			})
+		}
+	} else {
+		resource.ValueQuantity = quantity(o.Value)
+	}
+	return resource, true
+}
@@ -0,0 +1,186 @@
+package fhir
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"my-health/models"
+)
+
+// Period is the half-open time range [Start, End); a zero bound is open
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// dateLayouts are the precisions a date search value can have, from year to
+// second. A value covers the whole of its precision, e.g. "2024-03" is March.
+var dateLayouts = []struct {
+	layout string
+	next   func(time.Time) time.Time
+}{
+	{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+	{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	{"2006-01-02T15:04:05", func(t time.Time) time.Time { return t.Add(time.Second) }},
+	{time.RFC3339, func(t time.Time) time.Time { return t.Add(time.Second) }},
+}
+
+// parseDateValue returns the range a date search value covers. Values without
+// a time zone are read as UTC.
+func parseDateValue(value string) (Period, error) {
+	for _, d := range dateLayouts {
+		if t, err := time.Parse(d.layout, value); err == nil {
+			return Period{Start: t, End: d.next(t)}, nil
+		}
+	}
+	return Period{}, fmt.Errorf("%q is not a FHIR date such as 2024-03-01 or 2024-03-01T08:00:00Z", value)
+}
+
+// ParseDates narrows a period by date search parameters such as "ge2024-01-01"
+// and "lt2024-02-01". Supported prefixes are eq (the default), ge, gt, le and lt.
+func ParseDates(values []string) (Period, error) {
+	var period Period
+	narrowStart := func(t time.Time) {
+		if period.Start.IsZero() || t.After(period.Start) {
+			period.Start = t
+		}
+	}
+	narrowEnd := func(t time.Time) {
+		if period.End.IsZero() || t.Before(period.End) {
+			period.End = t
+		}
+	}
+
+	for _, value := range values {
+		prefix := "eq"
+		if len(value) > 2 && value[0] >= 'a' && value[0] <= 'z' {
+			prefix, value = value[:2], value[2:]
+		}
+		covered, err := parseDateValue(value)
+		if err != nil {
+			return Period{}, err
+		}
+		switch prefix {
+		case "eq":
+			narrowStart(covered.Start)
+			narrowEnd(covered.End)
+		case "ge":
+			narrowStart(covered.Start)
+		case "gt":
+			narrowStart(covered.End)
+		case "le":
+			narrowEnd(covered.End)
+		case "lt":
+			narrowEnd(covered.Start)
+		default:
+			return Period{}, fmt.Errorf("date prefix %q is not supported", prefix)
+		}
+	}
+	return period, nil
+}
+
+// ParseCodes returns the metrics matching a token search such as
+// "http://loinc.org|8867-4,29463-7". Codes of other systems and unknown codes
+// match nothing.
+func ParseCodes(value string) []string {
+	metrics := []string{}
+	seen := map[string]bool{}
+	for _, token := range strings.Split(value, ",") {
+		system, code, found := strings.Cut(strings.TrimSpace(token), "|")
+		if !found {
+			system, code = "", system
+		}
+		if system != "" && system != SystemLOINC {
+			continue
+		}
+		if metric, ok := MetricForCode(code); ok && !seen[metric] {
+			seen[metric] = true
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics
+}
+
+// ObservationSearch selects the observations of a search or $everything.
+// Observations entered in error are left out.
+type ObservationSearch struct {
+	PatientIDs []uint
+	// Metrics restricts the search to these metrics; nil means every metric
+	// with a LOINC code
+	Metrics []string
+	Period  Period
+	Count   int
+	Offset  int
+}
+
+// Search returns one page of the matching observations, newest first, and
+// the number of matches
+func Search(db *gorm.DB, s ObservationSearch) ([]models.Observation, int64, error) {
+	metrics := s.Metrics
+	if metrics == nil {
+		metrics = Metrics()
+	}
+	if len(s.PatientIDs) == 0 || len(metrics) == 0 {
+		return nil, 0, nil
+	}
+
+	query := db.Model(&models.Observation{}).
+		Where("patient_id IN ? AND metric IN ? AND status <> ?", s.PatientIDs, metrics, models.ObservationEnteredInError)
+	if !s.Period.Start.IsZero() {
+		query = query.Where("effective_at >= ?", s.Period.Start)
+	}
+	if !s.Period.End.IsZero() {
+		query = query.Where("effective_at < ?", s.Period.End)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	// _count=0 asks for the number of matches only
+	if s.Count == 0 {
+		return nil, total, nil
+	}
+	var list []models.Observation
+	if err := query.Order("effective_at DESC, id DESC").
+		Limit(s.Count).Offset(s.Offset).
+		Find(&list).Error; err != nil {
+		return nil, 0, err
+	}
+	return list, total, nil
+}
+
+// Entry wraps a Patient or Observation for a Bundle. mode is the search mode:
+// "match" for a resource the search asked for, "include" for one added to it.
+func Entry(baseURL string, resource interface{}, mode string) BundleEntry {
+	var fullURL string
+	switch r := resource.(type) {
+	case Patient:
+		fullURL = baseURL + "/Patient/" + r.ID
+	case Observation:
+		fullURL = baseURL + "/Observation/" + r.ID
+	}
+	return BundleEntry{FullURL: fullURL, Resource: resource, Search: &BundleSearch{Mode: mode}}
+}
+
+// SearchSet builds a searchset Bundle of one page of results. total counts the
+// matches of every page; next links the following page, if any.
+func SearchSet(self, next string, total int64, entries []BundleEntry) Bundle {
+	count := int(total)
+	bundle := Bundle{
+		ResourceType: "Bundle",
+		Meta:         &Meta{LastUpdated: instant(time.Now())},
+		Type:         "searchset",
+		Total:        &count,
+		Link:         []BundleLink{{Relation: "self", URL: self}},
+		Entry:        entries,
+	}
+	if next != "" {
+		bundle.Link = append(bundle.Link, BundleLink{Relation: "next", URL: next})
+	}
+	return bundle
+}
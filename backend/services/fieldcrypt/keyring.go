@@ -0,0 +1,256 @@
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrNotConfigured = errors.New("field encryption keys are not loaded")
+	ErrUnknownKey    = errors.New("unknown master key")
+
+	mu     sync.RWMutex
+	active *Keyring
+)
+
+// Keyring holds the master keys used to wrap per-record data keys. Several keys
+// can be loaded at once so data wrapped with a retired key stays readable.
+type Keyring struct {
+	masterKeys  map[string][]byte
+	activeKeyID string
+	blindKey    []byte
+
+	cacheMu sync.Mutex
+	cache   map[string][]byte // wrapped data key -> unwrapped data key
+}
+
+// maxCachedKeys bounds the unwrapped data key cache
+const maxCachedKeys = 10000
+
+// NewKeyring builds a keyring from master keys by ID. All keys must be 32 bytes (AES-256).
+func NewKeyring(masterKeys map[string][]byte, activeKeyID string, blindKey []byte) (*Keyring, error) {
+	if _, ok := masterKeys[activeKeyID]; !ok {
+		return nil, fmt.Errorf("active key %q is not among the master keys", activeKeyID)
+	}
+	for id, key := range masterKeys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("master key %q must be 32 bytes, got %d", id, len(key))
+		}
+		if strings.Contains(id, ":") {
+			return nil, fmt.Errorf("master key id %q must not contain ':'", id)
+		}
+	}
+	if len(blindKey) < 32 {
+		return nil, errors.New("blind index key must be at least 32 bytes")
+	}
+	return &Keyring{
+		masterKeys:  masterKeys,
+		activeKeyID: activeKeyID,
+		blindKey:    blindKey,
+		cache:       make(map[string][]byte),
+	}, nil
+}
+
+// LoadFromEnv reads the keyring from the environment and makes it the active one.
+//
+//	ENCRYPTION_MASTER_KEYS  comma-separated id:base64key pairs, e.g. "2024-06:...,2023-01:..."
+//	ENCRYPTION_ACTIVE_KEY   id of the key used for new data keys
+//	BLIND_INDEX_KEY         base64 key for blind-index hashes
+func LoadFromEnv() error {
+	masterKeys := make(map[string][]byte)
+	for _, entry := range strings.Split(os.Getenv("ENCRYPTION_MASTER_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, found := strings.Cut(entry, ":")
+		if !found {
+			return fmt.Errorf("invalid master key entry %q, expected id:base64key", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("invalid base64 for master key %q: %v", id, err)
+		}
+		masterKeys[id] = key
+	}
+	if len(masterKeys) == 0 {
+		return errors.New("ENCRYPTION_MASTER_KEYS is not set")
+	}
+
+	blindKey, err := base64.StdEncoding.DecodeString(os.Getenv("BLIND_INDEX_KEY"))
+	if err != nil {
+		return fmt.Errorf("invalid base64 for BLIND_INDEX_KEY: %v", err)
+	}
+
+	keyring, err := NewKeyring(masterKeys, os.Getenv("ENCRYPTION_ACTIVE_KEY"), blindKey)
+	if err != nil {
+		return err
+	}
+	SetKeyring(keyring)
+	return nil
+}
+
+// SetKeyring replaces the keyring used by the serializer and the helpers in this package
+func SetKeyring(k *Keyring) {
+	mu.Lock()
+	defer mu.Unlock()
+	active = k
+}
+
+func current() (*Keyring, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if active == nil {
+		return nil, ErrNotConfigured
+	}
+	return active, nil
+}
+
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key, sealed, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], aad)
+}
+
+// NewDataKey generates a fresh data key wrapped with the active master key.
+// The result has the form "<master key id>:<base64 wrapped key>".
+func (k *Keyring) NewDataKey() (string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+	return k.wrap(dataKey)
+}
+
+func (k *Keyring) wrap(dataKey []byte) (string, error) {
+	wrapped, err := seal(k.masterKeys[k.activeKeyID], dataKey, []byte(k.activeKeyID))
+	if err != nil {
+		return "", err
+	}
+	return k.activeKeyID + ":" + base64.StdEncoding.EncodeToString(wrapped), nil
+}
+
+// unwrap returns the plaintext data key for a wrapped one, using the cache when possible
+func (k *Keyring) unwrap(wrappedKey string) ([]byte, error) {
+	k.cacheMu.Lock()
+	if dataKey, ok := k.cache[wrappedKey]; ok {
+		k.cacheMu.Unlock()
+		return dataKey, nil
+	}
+	k.cacheMu.Unlock()
+
+	keyID, encoded, found := strings.Cut(wrappedKey, ":")
+	if !found {
+		return nil, errors.New("malformed data key")
+	}
+	masterKey, ok := k.masterKeys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := open(masterKey, sealed, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping data key: %v", err)
+	}
+
+	k.cacheMu.Lock()
+	if len(k.cache) >= maxCachedKeys {
+		k.cache = make(map[string][]byte)
+	}
+	k.cache[wrappedKey] = dataKey
+	k.cacheMu.Unlock()
+	return dataKey, nil
+}
+
+// Rewrap re-wraps a data key with the active master key. Keys that already use it are returned unchanged.
+func (k *Keyring) Rewrap(wrappedKey string) (string, error) {
+	if strings.HasPrefix(wrappedKey, k.activeKeyID+":") {
+		return wrappedKey, nil
+	}
+	dataKey, err := k.unwrap(wrappedKey)
+	if err != nil {
+		return "", err
+	}
+	return k.wrap(dataKey)
+}
+
+// IsActive reports whether a wrapped data key uses the active master key
+func (k *Keyring) IsActive(wrappedKey string) bool {
+	return strings.HasPrefix(wrappedKey, k.activeKeyID+":")
+}
+
+// BlindIndex returns a keyed hash of the value for exact-match lookups on encrypted columns
+func (k *Keyring) BlindIndex(value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, k.blindKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewDataKey generates a wrapped data key with the active keyring
+func NewDataKey() (string, error) {
+	k, err := current()
+	if err != nil {
+		return "", err
+	}
+	return k.NewDataKey()
+}
+
+// Rewrap re-wraps a data key with the active keyring's current master key
+func Rewrap(wrappedKey string) (string, error) {
+	k, err := current()
+	if err != nil {
+		return "", err
+	}
+	return k.Rewrap(wrappedKey)
+}
+
+// BlindIndex hashes a value with the active keyring's blind-index key
+func BlindIndex(value string) (string, error) {
+	k, err := current()
+	if err != nil {
+		return "", err
+	}
+	return k.BlindIndex(value), nil
+}
@@ -0,0 +1,141 @@
+package fieldcrypt
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm/schema"
+)
+
+// prefix marks encrypted column values; anything else is treated as legacy plaintext
+const prefix = "enc:v1:"
+
+// DataKeyField is the model field holding the record's wrapped data key
+const DataKeyField = "DataKey"
+
+func init() {
+	schema.RegisterSerializer("encrypted", Serializer{})
+}
+
+// Serializer encrypts a field with its record's data key using AES-256-GCM.
+// Use it with `gorm:"serializer:encrypted"`; the model needs a DataKey string
+// field, normally filled in a BeforeSave hook with NewDataKey.
+//
+// Each stored value carries its wrapped data key, so it can be decrypted
+// without the rest of the row:
+//
+//	enc:v1:<master key id>:<base64 wrapped data key>:<base64 nonce+ciphertext>
+//
+// String fields are encrypted as-is; other types are JSON-encoded first. Empty
+// values are stored empty so emptiness checks keep working.
+type Serializer struct{}
+
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	fieldValue := reflect.New(field.FieldType)
+
+	var stored string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("failed to decrypt %s: unsupported value %#v", field.DBName, dbValue)
+	}
+
+	plaintext := []byte(stored)
+	if strings.HasPrefix(stored, prefix) {
+		var err error
+		plaintext, err = decrypt(stored, field.DBName)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %v", field.DBName, err)
+		}
+	}
+
+	if len(plaintext) > 0 {
+		if field.FieldType.Kind() == reflect.String {
+			fieldValue.Elem().SetString(string(plaintext))
+		} else if err := json.Unmarshal(plaintext, fieldValue.Interface()); err != nil {
+			return fmt.Errorf("failed to decode %s: %v", field.DBName, err)
+		}
+	}
+
+	field.ReflectValueOf(ctx, dst).Set(fieldValue.Elem())
+	return nil
+}
+
+func (Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	var plaintext []byte
+	if s, ok := fieldValue.(string); ok {
+		plaintext = []byte(s)
+	} else if fieldValue != nil && !reflect.ValueOf(fieldValue).IsZero() {
+		var err error
+		if plaintext, err = json.Marshal(fieldValue); err != nil {
+			return nil, err
+		}
+	}
+	if len(plaintext) == 0 {
+		return "", nil
+	}
+
+	k, err := current()
+	if err != nil {
+		return nil, err
+	}
+
+	// Reuse the record's data key when the model has one
+	var wrappedKey string
+	if keyField := field.Schema.LookUpField(DataKeyField); keyField != nil && dst.IsValid() {
+		if v, zero := keyField.ValueOf(ctx, dst); !zero {
+			wrappedKey, _ = v.(string)
+		}
+	}
+	if wrappedKey == "" {
+		if wrappedKey, err = k.NewDataKey(); err != nil {
+			return nil, err
+		}
+	}
+
+	return k.encrypt(wrappedKey, plaintext, field.DBName)
+}
+
+func (k *Keyring) encrypt(wrappedKey string, plaintext []byte, column string) (string, error) {
+	dataKey, err := k.unwrap(wrappedKey)
+	if err != nil {
+		return "", err
+	}
+	// Binding the column name stops ciphertext being moved between columns
+	sealed, err := seal(dataKey, plaintext, []byte(column))
+	if err != nil {
+		return "", err
+	}
+	return prefix + wrappedKey + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decrypt(stored, column string) ([]byte, error) {
+	k, err := current()
+	if err != nil {
+		return nil, err
+	}
+
+	// <key id>:<wrapped key>:<ciphertext>
+	parts := strings.SplitN(strings.TrimPrefix(stored, prefix), ":", 3)
+	if len(parts) != 3 {
+		return nil, errors.New("malformed ciphertext")
+	}
+	dataKey, err := k.unwrap(parts[0] + ":" + parts[1])
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	return open(dataKey, sealed, []byte(column))
+}
@@ -0,0 +1,196 @@
+package immunization
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"my-health/models"
+)
+
+// Forecast statuses
+const (
+	StatusOverdue  = "overdue"
+	StatusDue      = "due"
+	StatusUpcoming = "upcoming"
+)
+
+// Rule describes when a vaccine is recommended. A rule applies from MinAgeYears
+// (and up to MaxAgeYears when set) and is either a fixed series of Doses, given
+// IntervalDays apart, or repeats every RepeatMonths after the series is complete.
+// Seasonal vaccines set SeasonStartMonth instead and are due once per season.
+type Rule struct {
+	Vaccine          string `json:"vaccine"`
+	MinAgeYears      int    `json:"min_age_years"`
+	MaxAgeYears      int    `json:"max_age_years"`
+	Doses            int    `json:"doses"`
+	IntervalDays     []int  `json:"interval_days"`
+	RepeatMonths     int    `json:"repeat_months"`
+	SeasonStartMonth int    `json:"season_start_month"`
+	// GraceDays is how long after the due date a dose is still "due" rather than "overdue"
+	GraceDays int `json:"grace_days"`
+}
+
+// DefaultSchedule follows the usual adult recommendations for older patients
+var DefaultSchedule = []Rule{
+	{Vaccine: models.VaccineInfluenza, MinAgeYears: 50, Doses: 1, SeasonStartMonth: 9, GraceDays: 60},
+	{Vaccine: models.VaccineCovid19, MinAgeYears: 65, Doses: 1, RepeatMonths: 12, GraceDays: 30},
+	{Vaccine: models.VaccinePneumococcal, MinAgeYears: 65, Doses: 1, GraceDays: 90},
+	{Vaccine: models.VaccineZoster, MinAgeYears: 50, Doses: 2, IntervalDays: []int{60}, GraceDays: 120},
+	{Vaccine: models.VaccineTetanus, MinAgeYears: 19, Doses: 1, RepeatMonths: 120, GraceDays: 90},
+}
+
+var (
+	scheduleMu sync.RWMutex
+	schedule   = DefaultSchedule
+)
+
+// Schedule returns the rules currently used for forecasting
+func Schedule() []Rule {
+	scheduleMu.RLock()
+	defer scheduleMu.RUnlock()
+	return schedule
+}
+
+// SetSchedule replaces the rules used for forecasting
+func SetSchedule(rules []Rule) {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+	schedule = rules
+}
+
+// LoadSchedule reads a JSON array of rules from a file and checks them
+func LoadSchedule(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid immunization schedule: %w", err)
+	}
+	for i, rule := range rules {
+		if _, ok := models.VaccineCodes[rule.Vaccine]; !ok {
+			return nil, fmt.Errorf("rule %d: unknown vaccine %q", i, rule.Vaccine)
+		}
+		if rule.Doses < 1 {
+			return nil, fmt.Errorf("rule %d: doses must be at least 1", i)
+		}
+		if len(rule.IntervalDays) < rule.Doses-1 {
+			return nil, fmt.Errorf("rule %d: interval_days needs %d entries", i, rule.Doses-1)
+		}
+		if rule.SeasonStartMonth < 0 || rule.SeasonStartMonth > 12 {
+			return nil, fmt.Errorf("rule %d: season_start_month must be 0 (no season) or 1-12", i)
+		}
+	}
+	return rules, nil
+}
+
+// Forecast is a vaccine dose the patient should receive
+type Forecast struct {
+	Vaccine     string     `json:"vaccine"`
+	VaccineName string     `json:"vaccine_name"`
+	DoseNumber  int        `json:"dose_number"`
+	DueDate     time.Time  `json:"due_date"`
+	Status      string     `json:"status"`
+	LastDose    *time.Time `json:"last_dose,omitempty"`
+}
+
+// ForecastPatient lists the overdue, due and upcoming (within horizon) doses for a patient,
+// ordered by due date
+func ForecastPatient(rules []Rule, dateOfBirth time.Time, records []models.Immunization, now time.Time, horizon time.Duration) []Forecast {
+	byVaccine := map[string][]time.Time{}
+	for _, record := range records {
+		byVaccine[record.VaccineCode] = append(byVaccine[record.VaccineCode], record.AdministeredOn)
+	}
+	for _, doses := range byVaccine {
+		sort.Slice(doses, func(i, j int) bool { return doses[i].Before(doses[j]) })
+	}
+
+	forecasts := []Forecast{}
+	for _, rule := range rules {
+		if rule.MaxAgeYears > 0 && now.After(dateOfBirth.AddDate(rule.MaxAgeYears+1, 0, 0)) {
+			continue
+		}
+
+		doses := byVaccine[rule.Vaccine]
+		dueDate, doseNumber, ok := nextDose(rule, dateOfBirth.AddDate(rule.MinAgeYears, 0, 0), doses, now)
+		if !ok {
+			continue
+		}
+
+		status := ""
+		switch {
+		case now.After(dueDate.AddDate(0, 0, rule.GraceDays)):
+			status = StatusOverdue
+		case !now.Before(dueDate):
+			status = StatusDue
+		case dueDate.Sub(now) <= horizon:
+			status = StatusUpcoming
+		default:
+			continue
+		}
+
+		forecast := Forecast{
+			Vaccine:     rule.Vaccine,
+			VaccineName: models.VaccineCodes[rule.Vaccine],
+			DoseNumber:  doseNumber,
+			DueDate:     dueDate,
+			Status:      status,
+		}
+		if len(doses) > 0 {
+			last := doses[len(doses)-1]
+			forecast.LastDose = &last
+		}
+		forecasts = append(forecasts, forecast)
+	}
+
+	sort.SliceStable(forecasts, func(i, j int) bool { return forecasts[i].DueDate.Before(forecasts[j].DueDate) })
+	return forecasts
+}
+
+// nextDose works out when the next dose of a rule is due, or false if none is needed
+func nextDose(rule Rule, eligibleFrom time.Time, doses []time.Time, now time.Time) (time.Time, int, bool) {
+	if rule.SeasonStartMonth > 0 {
+		season := time.Date(now.Year(), time.Month(rule.SeasonStartMonth), 1, 0, 0, 0, 0, now.Location())
+		if season.After(now) {
+			season = season.AddDate(-1, 0, 0)
+		}
+		if len(doses) > 0 && !doses[len(doses)-1].Before(season) {
+			season = season.AddDate(1, 0, 0)
+		}
+		return latest(season, eligibleFrom), 1, true
+	}
+
+	// Doses given too close together only count once towards the series
+	given := 0
+	var last time.Time
+	for _, dose := range doses {
+		if given > 0 && given < rule.Doses && dose.Before(last.AddDate(0, 0, rule.IntervalDays[given-1]/2)) {
+			continue
+		}
+		given++
+		last = dose
+	}
+
+	switch {
+	case given == 0:
+		return eligibleFrom, 1, true
+	case given < rule.Doses:
+		return latest(last.AddDate(0, 0, rule.IntervalDays[given-1]), eligibleFrom), given + 1, true
+	case rule.RepeatMonths > 0:
+		return latest(last.AddDate(0, rule.RepeatMonths, 0), eligibleFrom), given + 1, true
+	}
+	return time.Time{}, 0, false
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,445 @@
+package imports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"my-health/models"
+	"my-health/services/alerts"
+	"my-health/services/baseline"
+	"my-health/services/blobstore"
+	"my-health/services/news2"
+	"my-health/services/observations"
+	"my-health/services/pipeline"
+	"my-health/services/timeseries"
+)
+
+var (
+	pollInterval = 5 * time.Second
+	chunkSize    = 200
+	// staleAfter returns a running import to the queue when it has made no
+	// progress, e.g. because its server stopped; it resumes where it left off
+	staleAfter = 10 * time.Minute
+
+	workerOnce sync.Once
+)
+
+// MaxRowErrors bounds the rejected lines kept on a batch or returned by a dry run
+const MaxRowErrors = 500
+
+// ErrNotUndoable is returned when undoing an import that is running or already undone
+var ErrNotUndoable = errors.New("import is running or already undone")
+
+// Report is the outcome of a dry run
+type Report struct {
+	TotalRows  int                     `json:"total_rows"`
+	Valid      int                     `json:"valid"`
+	Duplicates int                     `json:"duplicates"`
+	Rejected   int                     `json:"rejected"`
+	RowErrors  []models.ImportRowError `json:"row_errors"`
+	// Truncated is set when more lines were rejected than RowErrors holds
+	Truncated bool `json:"truncated"`
+}
+
+// dupKey identifies a stored value: a reading duplicates an existing one when
+// it has a value of the same metric at the same instant
+type dupKey struct {
+	at     int64
+	metric string
+}
+
+// seenReadings holds the values already stored or accepted from the file
+type seenReadings map[dupKey]bool
+
+// load adds the patient's stored values at the instants of the rows
+func (s seenReadings) load(db *gorm.DB, patientID uint, rows []Row) error {
+	var instants []time.Time
+	for _, row := range rows {
+		if !row.Errors.Any() {
+			instants = append(instants, row.Reading.Date)
+		}
+	}
+	if len(instants) == 0 {
+		return nil
+	}
+
+	var stored []models.Observation
+	if err := db.Select("effective_at, metric").
+		Where("patient_id = ? AND status <> ? AND effective_at IN ?", patientID, models.ObservationEnteredInError, instants).
+		Find(&stored).Error; err != nil {
+		return err
+	}
+	for _, o := range stored {
+		s[dupKey{o.EffectiveAt.UnixNano(), o.Metric}] = true
+	}
+	return nil
+}
+
+// duplicate reports whether any observation of the reading is already stored
+func (s seenReadings) duplicate(list []models.Observation) bool {
+	for _, o := range list {
+		if s[dupKey{o.EffectiveAt.UnixNano(), o.Metric}] {
+			return true
+		}
+	}
+	return false
+}
+
+func (s seenReadings) add(list []models.Observation) {
+	for _, o := range list {
+		s[dupKey{o.EffectiveAt.UnixNano(), o.Metric}] = true
+	}
+}
+
+func addRowError(list []models.ImportRowError, row Row) ([]models.ImportRowError, bool) {
+	if len(list) >= MaxRowErrors {
+		return list, false
+	}
+	return append(list, models.ImportRowError{Line: row.Line, Errors: row.Errors}), true
+}
+
+// readChunk reads up to chunkSize rows; it returns io.EOF with the last rows
+func readChunk(r *Reader) ([]Row, error) {
+	var rows []Row
+	for len(rows) < chunkSize {
+		row, err := r.Next()
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// DryRun validates every line and checks for duplicates against the stored
+// readings and earlier lines, without storing anything
+func DryRun(db *gorm.DB, r *Reader) (Report, error) {
+	report := Report{RowErrors: []models.ImportRowError{}}
+	seen := seenReadings{}
+	for {
+		rows, err := readChunk(r)
+		if err != nil && err != io.EOF {
+			return report, err
+		}
+		if loadErr := seen.load(db, r.patientID, rows); loadErr != nil {
+			return report, loadErr
+		}
+
+		for _, row := range rows {
+			report.TotalRows++
+			if row.Errors.Any() {
+				report.Rejected++
+				var kept bool
+				if report.RowErrors, kept = addRowError(report.RowErrors, row); !kept {
+					report.Truncated = true
+				}
+				continue
+			}
+			list := observations.Split(row.Reading)
+			if seen.duplicate(list) {
+				report.Duplicates++
+				continue
+			}
+			seen.add(list)
+			report.Valid++
+		}
+		if err == io.EOF {
+			return report, nil
+		}
+	}
+}
+
+// Count returns the number of lines after the header
+func Count(r *Reader) (int, error) {
+	count := 0
+	for {
+		if _, err := r.csv.Read(); err != nil {
+			if err == io.EOF {
+				return count, nil
+			}
+			return count, err
+		}
+		count++
+	}
+}
+
+// StartWorker starts the background worker that runs queued imports
+func StartWorker(db *gorm.DB, blobs blobstore.BlobStore) {
+	workerOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(pollInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				for {
+					ran, err := RunNext(context.Background(), db, blobs, time.Now())
+					if err != nil {
+						log.Printf("Error running import: %v", err)
+					}
+					if !ran {
+						break
+					}
+				}
+			}
+		}()
+	})
+}
+
+// RunNext claims the oldest queued import and runs it to the end, reporting
+// whether there was one. Claiming with SKIP LOCKED lets several servers share
+// the queue.
+func RunNext(ctx context.Context, db *gorm.DB, blobs blobstore.BlobStore, now time.Time) (bool, error) {
+	if err := db.Model(&models.ImportBatch{}).
+		Where("status = ? AND updated_at < ?", models.ImportRunning, now.Add(-staleAfter)).
+		Update("status", models.ImportQueued).Error; err != nil {
+		return false, err
+	}
+
+	var ids []uint
+	if err := db.Raw(`UPDATE import_batches SET status = ?, started_at = COALESCE(started_at, ?), updated_at = ?
+		WHERE id IN (
+			SELECT id FROM import_batches
+			WHERE status = ? AND deleted_at IS NULL
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id`,
+		models.ImportRunning, now, now, models.ImportQueued).
+		Scan(&ids).Error; err != nil {
+		return false, err
+	}
+	if len(ids) == 0 {
+		return false, nil
+	}
+
+	var batch models.ImportBatch
+	if err := db.First(&batch, ids[0]).Error; err != nil {
+		return true, err
+	}
+
+	runErr := run(ctx, db, blobs, &batch)
+	updates := map[string]interface{}{"status": models.ImportCompleted, "finished_at": time.Now()}
+	if runErr != nil {
+		updates["status"] = models.ImportFailed
+		updates["error"] = runErr.Error()
+	}
+	if err := db.Model(&batch).Updates(updates).Error; err != nil {
+		return true, err
+	}
+	if err := blobs.Delete(ctx, batch.StorageKey); err != nil && !errors.Is(err, blobstore.ErrNotFound) {
+		log.Printf("Error deleting import file %s: %v", batch.StorageKey, err)
+	}
+	if runErr != nil {
+		return true, fmt.Errorf("import %d: %w", batch.ID, runErr)
+	}
+	return true, nil
+}
+
+// run stores the lines of the import file in chunks, skipping the lines an
+// earlier attempt already processed. Each chunk is stored together with the
+// batch's progress, so the counts always match the stored readings.
+func run(ctx context.Context, db *gorm.DB, blobs blobstore.BlobStore, batch *models.ImportBatch) error {
+	file, err := blobs.Get(ctx, batch.StorageKey)
+	if err != nil {
+		return fmt.Errorf("reading import file: %w", err)
+	}
+	defer file.Close()
+
+	now := time.Now()
+	reader, err := NewReader(file, batch.Mapping, batch.PatientID, now, timeseries.RetentionCutoff(now))
+	if err != nil {
+		return err
+	}
+	for skipped := 0; skipped < batch.ProcessedRows; skipped++ {
+		if _, err := reader.csv.Read(); err != nil {
+			return fmt.Errorf("skipping processed lines: %w", err)
+		}
+	}
+
+	for {
+		rows, err := readChunk(reader)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		stored, storeErr := storeChunk(db, batch, rows)
+		if storeErr != nil {
+			return storeErr
+		}
+		if err := pipeline.Process(db, stored); err != nil {
+			log.Printf("Error processing imported readings: %v", err)
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// storeChunk stores the valid, new readings of the rows and the batch's
+// progress in one transaction, and returns the stored observations
+func storeChunk(db *gorm.DB, batch *models.ImportBatch, rows []Row) ([]models.Observation, error) {
+	var stored []models.Observation
+	err := db.Transaction(func(tx *gorm.DB) error {
+		seen := seenReadings{}
+		if err := seen.load(tx, batch.PatientID, rows); err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			if row.Errors.Any() {
+				batch.Rejected++
+				batch.RowErrors, _ = addRowError(batch.RowErrors, row)
+				continue
+			}
+			list := observations.Split(row.Reading)
+			if seen.duplicate(list) {
+				batch.Duplicates++
+				continue
+			}
+			seen.add(list)
+			for i := range list {
+				list[i].ImportBatchID = &batch.ID
+			}
+			stored = append(stored, list...)
+			batch.Created++
+		}
+		batch.ProcessedRows += len(rows)
+
+		if len(stored) > 0 {
+			if err := tx.CreateInBatches(&stored, 100).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(batch).Select("processed_rows", "created", "duplicates", "rejected", "row_errors").
+			Updates(batch).Error
+	})
+	return stored, err
+}
+
+// metricSpan is when the readings of one metric in an import were taken
+type metricSpan struct {
+	Metric string
+	First  time.Time
+	Last   time.Time
+}
+
+// recompute rebuilds what was derived from the readings of an undone import:
+// the patient's baselines of the imported metrics and, if the readings could
+// have counted towards it, the NEWS2 score
+func recompute(tx *gorm.DB, batch *models.ImportBatch, spans []metricSpan, now time.Time) error {
+	var news2From, news2To time.Time
+	for _, span := range spans {
+		for _, metric := range baseline.Metrics {
+			if observations.Stored(metric) != span.Metric {
+				continue
+			}
+			if _, err := baseline.Refresh(tx, batch.PatientID, metric, now); err != nil {
+				return err
+			}
+		}
+		if news2.Uses(span.Metric) {
+			if news2From.IsZero() || span.First.Before(news2From) {
+				news2From = span.First
+			}
+			if span.Last.After(news2To) {
+				news2To = span.Last
+			}
+		}
+	}
+	if news2From.IsZero() {
+		return nil
+	}
+	// Scores computed before the import started could not see its readings
+	if batch.StartedAt != nil && batch.StartedAt.After(news2From) {
+		news2From = *batch.StartedAt
+	}
+	return news2.Recompute(tx, batch.PatientID, news2From, news2To, now)
+}
+
+// Undo removes the observations an import created and marks it undone; a
+// queued import is cancelled. Alerts raised by the removed readings are
+// resolved and their deviation flags deleted, and the rollups, baselines and
+// NEWS2 score they fed are rebuilt.
+func Undo(ctx context.Context, db *gorm.DB, blobs blobstore.BlobStore, batch *models.ImportBatch, userID uint, now time.Time) (int64, error) {
+	var removed int64
+	var queued bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(batch, batch.ID).Error; err != nil {
+			return err
+		}
+		if batch.Status == models.ImportRunning || batch.Status == models.ImportUndone {
+			return ErrNotUndoable
+		}
+		queued = batch.Status == models.ImportQueued
+
+		var hours []models.Observation
+		if err := tx.Model(&models.Observation{}).
+			Select("DISTINCT patient_id, date_trunc('hour', effective_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS effective_at").
+			Where("import_batch_id = ?", batch.ID).
+			Find(&hours).Error; err != nil {
+			return err
+		}
+		var spans []metricSpan
+		if err := tx.Model(&models.Observation{}).
+			Select("metric, MIN(effective_at) AS first, MAX(effective_at) AS last").
+			Where("import_batch_id = ?", batch.ID).
+			Group("metric").
+			Scan(&spans).Error; err != nil {
+			return err
+		}
+		imported := tx.Model(&models.Observation{}).Select("id").Where("import_batch_id = ?", batch.ID)
+		if err := tx.Where("observation_id IN (?)", imported).Delete(&models.DeviationFlag{}).Error; err != nil {
+			return err
+		}
+		var raised []models.Alert
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("observation_id IN (?) AND status NOT IN ?", imported, []string{models.AlertResolved, models.AlertFalsePositive}).
+			Find(&raised).Error; err != nil {
+			return err
+		}
+		for i := range raised {
+			if err := alerts.Transition(tx, &raised[i], alerts.Change{
+				To:      models.AlertResolved,
+				ActorID: userID,
+				Comment: fmt.Sprintf("Reading removed by undoing import %d", batch.ID),
+			}, now); err != nil {
+				return err
+			}
+		}
+
+		result := tx.Where("import_batch_id = ?", batch.ID).Delete(&models.Observation{})
+		if result.Error != nil {
+			return result.Error
+		}
+		removed = result.RowsAffected
+		if err := timeseries.MarkDirty(tx, hours); err != nil {
+			return err
+		}
+		if err := recompute(tx, batch, spans, now); err != nil {
+			return err
+		}
+
+		batch.Status = models.ImportUndone
+		batch.UndoneAt = &now
+		batch.UndoneByID = &userID
+		return tx.Model(batch).Select("status", "undone_at", "undone_by_id").Updates(batch).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if queued {
+		if err := blobs.Delete(ctx, batch.StorageKey); err != nil && !errors.Is(err, blobstore.ErrNotFound) {
+			log.Printf("Error deleting import file %s: %v", batch.StorageKey, err)
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,164 @@
+package imports
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"my-health/models"
+	"my-health/validation"
+)
+
+// Import fields a CSV column can be mapped to. A reading's time comes from a
+// timestamp column, or from a date column and an optional time column;
+// blood_pressure holds "120/80" and is an alternative to the separate values.
+const (
+	FieldTimestamp     = "timestamp"
+	FieldDate          = "date"
+	FieldTime          = "time"
+	FieldBloodPressure = models.MetricBloodPressure
+	FieldSource        = "source"
+	FieldDeviceID      = "device_id"
+)
+
+// Fields lists every import field in a stable order
+var Fields = []string{
+	FieldTimestamp,
+	FieldDate,
+	FieldTime,
+	models.MetricWeight,
+	models.MetricHeartRate,
+	models.MetricSystolicBP,
+	models.MetricDiastolicBP,
+	FieldBloodPressure,
+	models.MetricOxygenSaturation,
+	models.MetricStepsCount,
+	models.MetricSleepDuration,
+	models.MetricRespirationRate,
+	models.MetricBodyTemperature,
+	FieldSource,
+	FieldDeviceID,
+}
+
+// aliases are normalised header names suggested for each field, as found in
+// home monitor and spreadsheet exports
+var aliases = map[string][]string{
+	FieldTimestamp:                {"timestamp", "datetime", "date time", "measured at", "measured"},
+	FieldDate:                     {"date", "day", "measurement date"},
+	FieldTime:                     {"time", "hour", "measurement time"},
+	models.MetricWeight:           {"weight", "body weight"},
+	models.MetricHeartRate:        {"heart rate", "pulse", "hr", "bpm"},
+	models.MetricSystolicBP:       {"systolic", "sys"},
+	models.MetricDiastolicBP:      {"diastolic", "dia"},
+	FieldBloodPressure:            {"blood pressure", "bp"},
+	models.MetricOxygenSaturation: {"spo2", "oxygen saturation", "oxygen", "o2"},
+	models.MetricStepsCount:       {"steps", "step count", "steps count"},
+	models.MetricSleepDuration:    {"sleep", "sleep duration", "sleep hours", "hours slept"},
+	models.MetricRespirationRate:  {"respiration rate", "respiratory rate", "breaths", "rr"},
+	models.MetricBodyTemperature:  {"temperature", "body temperature", "temp"},
+	FieldSource:                   {"source", "app"},
+	FieldDeviceID:                 {"device", "device id", "serial", "serial number"},
+}
+
+// normalizeHeader lowercases a header and drops punctuation, so "Pulse (bpm)"
+// becomes "pulse bpm"
+func normalizeHeader(header string) string {
+	header = strings.ToLower(strings.TrimSpace(header))
+	return strings.Join(strings.FieldsFunc(header, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '%')
+	}), " ")
+}
+
+// Suggest proposes a column for each field whose alias matches a header,
+// ignoring a trailing unit such as "(bpm)". The weight and temperature units
+// are guessed from the header too.
+func Suggest(sample Sample) models.ImportMapping {
+	mapping := models.ImportMapping{Columns: map[string]string{}, Delimiter: sample.Delimiter}
+	taken := map[string]bool{}
+	for _, field := range Fields {
+		for _, header := range sample.Headers {
+			if taken[header] {
+				continue
+			}
+			normalized := normalizeHeader(header)
+			for _, alias := range aliases[field] {
+				if normalized == alias || strings.HasPrefix(normalized, alias+" ") {
+					mapping.Columns[field] = header
+					taken[header] = true
+					break
+				}
+			}
+			if mapping.Columns[field] != "" {
+				break
+			}
+		}
+	}
+
+	if header, ok := mapping.Columns[models.MetricWeight]; ok && strings.Contains(normalizeHeader(header), "lb") {
+		mapping.WeightUnit = "lb"
+	}
+	if header, ok := mapping.Columns[models.MetricBodyTemperature]; ok && strings.HasSuffix(normalizeHeader(header), " f") {
+		mapping.TemperatureUnit = "F"
+	}
+	return mapping
+}
+
+// ValidateMapping checks the mapping against the headers of the file
+func ValidateMapping(m models.ImportMapping, headers []string) validation.Errors {
+	errs := validation.Errors{}
+
+	present := map[string]bool{}
+	for _, header := range headers {
+		present[header] = true
+	}
+	known := map[string]bool{}
+	for _, field := range Fields {
+		known[field] = true
+	}
+
+	columns := make([]string, 0, len(m.Columns))
+	for field := range m.Columns {
+		columns = append(columns, field)
+	}
+	sort.Strings(columns)
+	measured := false
+	for _, field := range columns {
+		header := m.Columns[field]
+		switch {
+		case !known[field]:
+			errs.Add("columns."+field, "is not an import field")
+		case !present[header]:
+			errs.Add("columns."+field, fmt.Sprintf("column %q is not in the file", header))
+		}
+		if _, ok := models.MetricUnits[field]; ok || field == FieldBloodPressure {
+			measured = true
+		}
+	}
+
+	_, hasTimestamp := m.Columns[FieldTimestamp]
+	_, hasDate := m.Columns[FieldDate]
+	if !hasTimestamp && !hasDate {
+		errs.Add("columns", "must map timestamp, or date and optionally time")
+	}
+	if !measured {
+		errs.Add("columns", "must map at least one metric")
+	}
+
+	if m.Timezone != "" {
+		if _, err := time.LoadLocation(m.Timezone); err != nil {
+			errs.Add("timezone", "must be an IANA time zone such as Europe/Athens")
+		}
+	}
+	if m.WeightUnit != "" && m.WeightUnit != "kg" && m.WeightUnit != "lb" {
+		errs.Add("weightUnit", "must be kg or lb")
+	}
+	if m.TemperatureUnit != "" && m.TemperatureUnit != "C" && m.TemperatureUnit != "F" {
+		errs.Add("temperatureUnit", "must be C or F")
+	}
+	if m.Delimiter != "" && m.Delimiter != "," && m.Delimiter != ";" && m.Delimiter != "\t" {
+		errs.Add("delimiter", `must be ",", ";" or a tab`)
+	}
+	errs.MaxLength("source", m.Source, validation.MaxRelationshipLength)
+	return errs
+}
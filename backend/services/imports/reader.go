@@ -0,0 +1,313 @@
+package imports
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-health/models"
+	"my-health/validation"
+)
+
+// maxFutureSkew tolerates device clocks slightly ahead of the server
+const maxFutureSkew = 5 * time.Minute
+
+// timeLayouts are tried in order when the mapping has no TimeFormat
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Row is one line of an import file turned into a reading. Errors are keyed
+// by import field.
+type Row struct {
+	Line    int
+	Reading models.HealthMetrics
+	Errors  validation.Errors
+}
+
+func newCSVReader(r io.Reader, delimiter string) *csv.Reader {
+	reader := csv.NewReader(r)
+	if delimiter != "" {
+		reader.Comma = []rune(delimiter)[0]
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = true
+	return reader
+}
+
+// readHeaders reads the header line, dropping a byte order mark
+func readHeaders(reader *csv.Reader) ([]string, error) {
+	record, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	headers := make([]string, len(record))
+	for i, header := range record {
+		headers[i] = strings.TrimSpace(header)
+	}
+	if len(headers) > 0 {
+		headers[0] = strings.TrimPrefix(headers[0], "\ufeff")
+	}
+	return headers, nil
+}
+
+// detectDelimiter picks whichever of ",", ";" and tab occurs most often in
+// the first line
+func detectDelimiter(line string) string {
+	best, count := ",", strings.Count(line, ",")
+	for _, delimiter := range []string{";", "\t"} {
+		if n := strings.Count(line, delimiter); n > count {
+			best, count = delimiter, n
+		}
+	}
+	return best
+}
+
+// Sample is the start of an import file, for choosing a mapping
+type Sample struct {
+	Delimiter string     `json:"delimiter"`
+	Headers   []string   `json:"headers"`
+	Rows      [][]string `json:"rows"`
+}
+
+// Preview reads the headers and up to limit lines of the file. Without a
+// delimiter it is detected from the header line.
+func Preview(r io.Reader, delimiter string, limit int) (Sample, error) {
+	buffered := bufio.NewReader(r)
+	if delimiter == "" {
+		head, _ := buffered.Peek(4096)
+		line, _, _ := strings.Cut(string(head), "\n")
+		delimiter = detectDelimiter(line)
+	}
+
+	reader := newCSVReader(buffered, delimiter)
+	reader.ReuseRecord = false
+	headers, err := readHeaders(reader)
+	if err != nil {
+		return Sample{}, err
+	}
+	sample := Sample{Delimiter: delimiter, Headers: headers, Rows: [][]string{}}
+	for len(sample.Rows) < limit {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Sample{}, err
+		}
+		sample.Rows = append(sample.Rows, record)
+	}
+	return sample, nil
+}
+
+// Reader turns the lines of a CSV file into readings using a mapping
+type Reader struct {
+	csv       *csv.Reader
+	mapping   models.ImportMapping
+	columns   map[string]int
+	loc       *time.Location
+	patientID uint
+	now       time.Time
+	// cutoff rejects readings older than the metric retention policy keeps
+	cutoff time.Time
+}
+
+// NewReader reads the header line and checks the mapping against it. Mapping
+// problems are returned as validation.Errors.
+func NewReader(r io.Reader, m models.ImportMapping, patientID uint, now, cutoff time.Time) (*Reader, error) {
+	reader := newCSVReader(r, m.Delimiter)
+	headers, err := readHeaders(reader)
+	if err != nil {
+		return nil, err
+	}
+	if errs := ValidateMapping(m, headers); errs.Any() {
+		return nil, errs
+	}
+
+	index := make(map[string]int, len(headers))
+	for i, header := range headers {
+		if _, ok := index[header]; !ok {
+			index[header] = i
+		}
+	}
+	columns := make(map[string]int, len(m.Columns))
+	for field, header := range m.Columns {
+		columns[field] = index[header]
+	}
+
+	loc := time.UTC
+	if m.Timezone != "" {
+		loc, _ = time.LoadLocation(m.Timezone)
+	}
+	return &Reader{csv: reader, mapping: m, columns: columns, loc: loc, patientID: patientID, now: now, cutoff: cutoff}, nil
+}
+
+// Next returns the next line as a reading, or io.EOF after the last one. A
+// line that cannot be parsed as CSV ends the file with an error; invalid values
+// are reported in the row's Errors.
+func (r *Reader) Next() (Row, error) {
+	record, err := r.csv.Read()
+	if err != nil {
+		return Row{}, err
+	}
+	line, _ := r.csv.FieldPos(0)
+	row := Row{Line: line, Errors: validation.Errors{}}
+
+	value := func(field string) string {
+		i, ok := r.columns[field]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	parse := func(field string, counted bool) float64 {
+		text := value(field)
+		if text == "" {
+			return 0
+		}
+		n, err := parseNumber(text, counted)
+		if err != nil {
+			row.Errors.Add(field, fmt.Sprintf("%q is not a number", text))
+		}
+		return n
+	}
+	number := func(field string) float64 {
+		return parse(field, false)
+	}
+	integer := func(field string) int {
+		return int(math.Round(parse(field, true)))
+	}
+
+	h := models.HealthMetrics{
+		PatientID:        r.patientID,
+		Weight:           number(models.MetricWeight),
+		HeartRate:        integer(models.MetricHeartRate),
+		SystolicBP:       integer(models.MetricSystolicBP),
+		DiastolicBP:      integer(models.MetricDiastolicBP),
+		OxygenSaturation: number(models.MetricOxygenSaturation),
+		StepsCount:       integer(models.MetricStepsCount),
+		SleepDuration:    number(models.MetricSleepDuration),
+		RespirationRate:  integer(models.MetricRespirationRate),
+		BodyTemperature:  number(models.MetricBodyTemperature),
+		Source:           value(FieldSource),
+		DeviceID:         value(FieldDeviceID),
+	}
+	if h.Source == "" {
+		h.Source = r.mapping.Source
+	}
+	if r.mapping.WeightUnit == "lb" {
+		h.Weight = math.Round(h.Weight*0.45359237*100) / 100
+	}
+	if r.mapping.TemperatureUnit == "F" && h.BodyTemperature != 0 {
+		h.BodyTemperature = math.Round((h.BodyTemperature-32)*5/9*10) / 10
+	}
+	if pressure := value(FieldBloodPressure); pressure != "" && h.SystolicBP == 0 {
+		var systolic, diastolic int
+		if n, _ := fmt.Sscanf(pressure, "%d/%d", &systolic, &diastolic); n != 2 {
+			row.Errors.Add(FieldBloodPressure, fmt.Sprintf("%q is not systolic/diastolic, e.g. 120/80", pressure))
+		}
+		h.SystolicBP, h.DiastolicBP = systolic, diastolic
+	}
+	if h.SystolicBP != 0 {
+		h.BloodPressure = fmt.Sprintf("%d/%d", h.SystolicBP, h.DiastolicBP)
+	}
+
+	h.Date = r.timestamp(value, row.Errors)
+	r.validate(h, row.Errors)
+	row.Reading = h
+	return row, nil
+}
+
+// timestamp reads the reading's time from the timestamp column, or from the
+// date and time columns
+func (r *Reader) timestamp(value func(string) string, errs validation.Errors) time.Time {
+	field, text := FieldTimestamp, value(FieldTimestamp)
+	if _, ok := r.columns[FieldTimestamp]; !ok {
+		field, text = FieldDate, strings.TrimSpace(value(FieldDate)+" "+value(FieldTime))
+	}
+	if text == "" {
+		errs.Add(field, "is required")
+		return time.Time{}
+	}
+
+	layouts := timeLayouts
+	if r.mapping.TimeFormat != "" {
+		layouts = []string{r.mapping.TimeFormat}
+	}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, text, r.loc); err == nil {
+			return t
+		}
+	}
+	if r.mapping.TimeFormat != "" {
+		errs.Add(field, fmt.Sprintf("%q does not match the time format %q", text, r.mapping.TimeFormat))
+	} else {
+		errs.Add(field, fmt.Sprintf("%q is not an ISO 8601 time; set a time format", text))
+	}
+	return time.Time{}
+}
+
+// validate applies the same ranges as readings sent by devices, without their
+// age limit: an import is expected to hold years of history
+func (r *Reader) validate(h models.HealthMetrics, errs validation.Errors) {
+	if !h.Date.IsZero() {
+		if h.Date.After(r.now.Add(maxFutureSkew)) {
+			errs.Add(r.timeField(), "cannot be in the future")
+		} else if h.Date.Before(r.cutoff) {
+			errs.Add(r.timeField(), fmt.Sprintf("is before %s, older readings are not kept", r.cutoff.Format("2006-01-02")))
+		}
+	}
+
+	errs.MaxLength(FieldSource, h.Source, validation.MaxRelationshipLength)
+	errs.MaxLength(FieldDeviceID, h.DeviceID, validation.MaxNameLength)
+	errs.Weight(models.MetricWeight, h.Weight)
+	errs.HeartRate(models.MetricHeartRate, h.HeartRate)
+	errs.OxygenSaturation(models.MetricOxygenSaturation, h.OxygenSaturation)
+	errs.StepsCount(models.MetricStepsCount, h.StepsCount)
+	errs.SleepDuration(models.MetricSleepDuration, h.SleepDuration)
+	errs.RespirationRate(models.MetricRespirationRate, h.RespirationRate)
+	errs.BodyTemperature(models.MetricBodyTemperature, h.BodyTemperature)
+	if h.SystolicBP != 0 || h.DiastolicBP != 0 {
+		if !validation.MeasuredBloodPressure(h.SystolicBP, h.DiastolicBP) {
+			errs.Add(models.MetricSystolicBP, "must be between 50/20 and 300/200 mmHg with systolic above diastolic")
+		}
+	}
+
+	measured := h.Weight != 0 || h.HeartRate != 0 || h.SystolicBP != 0 || h.OxygenSaturation != 0 ||
+		h.StepsCount != 0 || h.SleepDuration != 0 || h.RespirationRate != 0 || h.BodyTemperature != 0
+	if !measured && !errs.Any() {
+		errs.Add("reading", "has no measured values")
+	}
+}
+
+func (r *Reader) timeField() string {
+	if _, ok := r.columns[FieldTimestamp]; ok {
+		return FieldTimestamp
+	}
+	return FieldDate
+}
+
+// parseNumber accepts a decimal comma as used in many European exports. In
+// whole counts such as steps a comma can only group thousands.
+func parseNumber(text string, counted bool) (float64, error) {
+	if counted {
+		text = strings.ReplaceAll(text, ",", "")
+	} else if !strings.Contains(text, ".") {
+		text = strings.Replace(text, ",", ".", 1)
+	}
+	return strconv.ParseFloat(text, 64)
+}
@@ -0,0 +1,118 @@
+package labs
+
+import (
+	"strings"
+	"time"
+
+	"my-health/models"
+)
+
+// Analyte is a lab test the app knows the unit and panel of
+type Analyte struct {
+	Code  string `json:"code"`
+	Name  string `json:"name"`
+	Panel string `json:"panel"`
+	Unit  string `json:"unit"`
+}
+
+var Analytes = map[string]Analyte{
+	"hba1c":             {Code: "hba1c", Name: "Hemoglobin A1c", Panel: "diabetes", Unit: "%"},
+	"glucose_fasting":   {Code: "glucose_fasting", Name: "Fasting glucose", Panel: "metabolic", Unit: "mg/dL"},
+	"creatinine":        {Code: "creatinine", Name: "Creatinine", Panel: "metabolic", Unit: "mg/dL"},
+	"egfr":              {Code: "egfr", Name: "eGFR", Panel: "metabolic", Unit: "mL/min/1.73m2"},
+	"bun":               {Code: "bun", Name: "Blood urea nitrogen", Panel: "metabolic", Unit: "mg/dL"},
+	"sodium":            {Code: "sodium", Name: "Sodium", Panel: "metabolic", Unit: "mmol/L"},
+	"potassium":         {Code: "potassium", Name: "Potassium", Panel: "metabolic", Unit: "mmol/L"},
+	"total_cholesterol": {Code: "total_cholesterol", Name: "Total cholesterol", Panel: "lipid", Unit: "mg/dL"},
+	"ldl":               {Code: "ldl", Name: "LDL cholesterol", Panel: "lipid", Unit: "mg/dL"},
+	"hdl":               {Code: "hdl", Name: "HDL cholesterol", Panel: "lipid", Unit: "mg/dL"},
+	"triglycerides":     {Code: "triglycerides", Name: "Triglycerides", Panel: "lipid", Unit: "mg/dL"},
+	"hemoglobin":        {Code: "hemoglobin", Name: "Hemoglobin", Panel: "cbc", Unit: "g/dL"},
+	"wbc":               {Code: "wbc", Name: "White blood cells", Panel: "cbc", Unit: "10^3/uL"},
+	"platelets":         {Code: "platelets", Name: "Platelets", Panel: "cbc", Unit: "10^3/uL"},
+	"tsh":               {Code: "tsh", Name: "Thyroid stimulating hormone", Panel: "thyroid", Unit: "mIU/L"},
+}
+
+// ReferenceRange applies to patients of the given sex ("" for any) whose age is
+// in [MinAge, MaxAge]; MaxAge 0 means no upper bound. Low or High may be nil
+// for one-sided ranges.
+type ReferenceRange struct {
+	TestCode string
+	Sex      string
+	MinAge   int
+	MaxAge   int
+	Low      *float64
+	High     *float64
+}
+
+func bound(v float64) *float64 {
+	return &v
+}
+
+// ReferenceRanges are checked in order, so more specific ranges come first
+var ReferenceRanges = []ReferenceRange{
+	{TestCode: "hba1c", Low: bound(4.0), High: bound(5.6)},
+	{TestCode: "glucose_fasting", Low: bound(70), High: bound(99)},
+	{TestCode: "creatinine", Sex: "male", Low: bound(0.74), High: bound(1.35)},
+	{TestCode: "creatinine", Sex: "female", Low: bound(0.59), High: bound(1.04)},
+	{TestCode: "creatinine", Low: bound(0.59), High: bound(1.35)},
+	{TestCode: "egfr", Low: bound(60)},
+	{TestCode: "bun", MinAge: 60, Low: bound(8), High: bound(23)},
+	{TestCode: "bun", Low: bound(6), High: bound(20)},
+	{TestCode: "sodium", Low: bound(135), High: bound(145)},
+	{TestCode: "potassium", Low: bound(3.5), High: bound(5.1)},
+	{TestCode: "total_cholesterol", High: bound(200)},
+	{TestCode: "ldl", High: bound(100)},
+	{TestCode: "hdl", Sex: "male", Low: bound(40)},
+	{TestCode: "hdl", Low: bound(50)},
+	{TestCode: "triglycerides", High: bound(150)},
+	{TestCode: "hemoglobin", Sex: "male", Low: bound(13.5), High: bound(17.5)},
+	{TestCode: "hemoglobin", Low: bound(12.0), High: bound(15.5)},
+	{TestCode: "wbc", Low: bound(4.5), High: bound(11.0)},
+	{TestCode: "platelets", Low: bound(150), High: bound(450)},
+	// TSH drifts upwards with age, so older patients get a wider range
+	{TestCode: "tsh", MinAge: 70, Low: bound(0.4), High: bound(6.0)},
+	{TestCode: "tsh", Low: bound(0.4), High: bound(4.0)},
+}
+
+// AgeAt returns the age in whole years on the given date
+func AgeAt(dateOfBirth, on time.Time) int {
+	age := on.Year() - dateOfBirth.Year()
+	if on.Month() < dateOfBirth.Month() || (on.Month() == dateOfBirth.Month() && on.Day() < dateOfBirth.Day()) {
+		age--
+	}
+	return age
+}
+
+// RangeFor finds the reference range for a test given the patient's sex and
+// age. The sex is compared ignoring case and surrounding space, as older
+// patient records hold values such as "Male".
+func RangeFor(testCode, sex string, age int) (ReferenceRange, bool) {
+	sex = strings.TrimSpace(sex)
+	for _, r := range ReferenceRanges {
+		if r.TestCode != testCode {
+			continue
+		}
+		if r.Sex != "" && !strings.EqualFold(r.Sex, sex) {
+			continue
+		}
+		if age < r.MinAge || (r.MaxAge > 0 && age > r.MaxAge) {
+			continue
+		}
+		return r, true
+	}
+	return ReferenceRange{}, false
+}
+
+// Flag compares a value with a reference range; values without a range are not flagged
+func Flag(value float64, low, high *float64) string {
+	switch {
+	case low == nil && high == nil:
+		return ""
+	case low != nil && value < *low:
+		return models.LabFlagLow
+	case high != nil && value > *high:
+		return models.LabFlagHigh
+	}
+	return models.LabFlagNormal
+}
@@ -2,14 +2,20 @@ package mockhealth
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"sync"
 	"time"
 
 	"my-health/initializers"
 	"my-health/models"
+	"my-health/services/observations"
+	"my-health/services/pipeline"
 )
 
+// Source marks observations generated by the mock data worker
+const Source = models.SourceMock
+
 var (
 	updateInterval = 1 * time.Hour // Update metrics every hour
 	workers        = make(map[uint]chan bool)
@@ -119,6 +125,9 @@ func GenerateMockDataForPatient(patientID uint, date time.Time) (*models.HealthM
 		diastolicBP = diastolicBP + rand.Intn(21) - 10
 	}
 
+	respirationRate := 12 + rand.Intn(9)         // 12-20 breaths/min
+	bodyTemperature := 36.2 + rand.Float64()*0.9 // 36.2-37.1 °C
+
 	metrics := &models.HealthMetrics{
 		PatientID:        patientID,
 		Date:             date,
@@ -132,6 +141,8 @@ func GenerateMockDataForPatient(patientID uint, date time.Time) (*models.HealthM
 		SleepDuration:    sleepDuration,
 		IrregularRhythm:  irregularRhythm,
 		FallDetected:     fallDetected,
+		RespirationRate:  respirationRate,
+		BodyTemperature:  math.Round(bodyTemperature*10) / 10,
 		BloodPressure:    fmt.Sprintf("%d/%d", systolicBP, diastolicBP),
 	}
 
@@ -141,7 +152,7 @@ func GenerateMockDataForPatient(patientID uint, date time.Time) (*models.HealthM
 // GenerateHistoricalData generates the last 30 days of data for a new patient
 func GenerateHistoricalData(patientID uint) error {
 	now := time.Now()
-	var metrics []*models.HealthMetrics
+	var readings []models.Observation
 
 	// Generate all metrics first
 	for i := 30; i >= 0; i-- {
@@ -150,16 +161,22 @@ func GenerateHistoricalData(patientID uint) error {
 		if err != nil {
 			return fmt.Errorf("error generating mock data: %v", err)
 		}
-		metrics = append(metrics, metric)
+		metric.Source = Source
+		readings = append(readings, observations.Split(*metric)...)
 	}
 
-	// Batch insert all metrics
-	batchSize := 10
-	result := initializers.DB.CreateInBatches(metrics, batchSize)
+	// Batch insert all observations
+	batchSize := 100
+	result := initializers.DB.CreateInBatches(readings, batchSize)
 	if result.Error != nil {
 		return fmt.Errorf("error batch inserting metrics: %v", result.Error)
 	}
 
+	// Only the most recent day is new enough to alert on
+	if err := pipeline.Process(initializers.DB, readings); err != nil {
+		return fmt.Errorf("error processing readings: %v", err)
+	}
+
 	return nil
 }
 
@@ -213,8 +230,8 @@ func EnsureTodayDataExists(patientID uint) error {
 	var count int64
 
 	// Check if data exists for today
-	if err := initializers.DB.Model(&models.HealthMetrics{}).
-		Where("patient_id = ? AND date >= ?", patientID, today).
+	if err := initializers.DB.Model(&models.Observation{}).
+		Where("patient_id = ? AND effective_at >= ?", patientID, today).
 		Count(&count).Error; err != nil {
 		return err
 	}
@@ -226,9 +243,14 @@ func EnsureTodayDataExists(patientID uint) error {
 			return fmt.Errorf("error generating mock data: %v", err)
 		}
 
-		if err := initializers.DB.Create(metric).Error; err != nil {
+		metric.Source = Source
+		stored, err := observations.Record(initializers.DB, *metric)
+		if err != nil {
 			return fmt.Errorf("error saving today's metrics: %v", err)
 		}
+		if err := pipeline.Process(initializers.DB, stored); err != nil {
+			return fmt.Errorf("error processing today's metrics: %v", err)
+		}
 	}
 
 	return nil
@@ -0,0 +1,141 @@
+package news2
+
+import (
+	"time"
+
+	"my-health/models"
+)
+
+// Risk bands
+const (
+	BandLow       = "low"
+	BandLowMedium = "low_medium"
+	BandMedium    = "medium"
+	BandHigh      = "high"
+)
+
+// Responses describe the clinical response each band calls for
+var Responses = map[string]string{
+	BandLow:       "Continue routine monitoring",
+	BandLowMedium: "Urgent review by a clinician; one parameter is in the extreme range",
+	BandMedium:    "Urgent review by a clinician",
+	BandHigh:      "Emergency assessment; call emergency services",
+}
+
+// Parameter names that are not stored metrics
+const (
+	ParameterConsciousness = "consciousness"
+	ParameterAirOrOxygen   = "air_or_oxygen"
+)
+
+// band is one scoring range: values up to and including Max score Score
+type band struct {
+	Max   float64
+	Score int
+}
+
+// scales hold the NEWS2 ranges per metric, in increasing order; the last range
+// has no upper bound. SpO2 uses scale 1.
+var scales = map[string][]band{
+	models.MetricRespirationRate:  {{8, 3}, {11, 1}, {20, 0}, {24, 2}, {0, 3}},
+	models.MetricOxygenSaturation: {{91, 3}, {93, 2}, {95, 1}, {0, 0}},
+	models.MetricSystolicBP:       {{90, 3}, {100, 2}, {110, 1}, {219, 0}, {0, 3}},
+	models.MetricHeartRate:        {{40, 3}, {50, 1}, {90, 0}, {110, 1}, {130, 2}, {0, 3}},
+	models.MetricBodyTemperature:  {{35.0, 3}, {36.0, 1}, {38.0, 0}, {39.0, 1}, {0, 2}},
+}
+
+// Parameters are the measured NEWS2 parameters in chart order
+var Parameters = []string{
+	models.MetricRespirationRate,
+	models.MetricOxygenSaturation,
+	models.MetricSystolicBP,
+	models.MetricHeartRate,
+	models.MetricBodyTemperature,
+}
+
+// ParameterScore scores one measured value
+func ParameterScore(metric string, value float64) int {
+	ranges := scales[metric]
+	for i, r := range ranges {
+		if i == len(ranges)-1 || value <= r.Max {
+			return r.Score
+		}
+	}
+	return 0
+}
+
+// Reading is the latest value of one parameter
+type Reading struct {
+	Value      float64
+	MeasuredAt time.Time
+}
+
+// Parameter is one line of the score
+type Parameter struct {
+	Name       string     `json:"name"`
+	Value      *float64   `json:"value"`
+	Unit       string     `json:"unit,omitempty"`
+	MeasuredAt *time.Time `json:"measured_at,omitempty"`
+	Score      int        `json:"score"`
+	// Assumed is set for parameters that are not captured and are scored as
+	// normal: the patient is alert and breathing room air
+	Assumed bool `json:"assumed,omitempty"`
+}
+
+// Result is a NEWS2 score with its breakdown
+type Result struct {
+	Total      int         `json:"total"`
+	Band       string      `json:"band"`
+	Response   string      `json:"response"`
+	Parameters []Parameter `json:"parameters"`
+	// Missing lists the measured parameters without a recent reading; the total
+	// then understates the risk
+	Missing  []string `json:"missing"`
+	Complete bool     `json:"complete"`
+	// ComputedAt is set by Current to the time the score was taken at
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+// Score computes NEWS2 from the latest reading of each parameter. Parameters
+// without a reading score nothing and are listed as missing.
+func Score(readings map[string]Reading) Result {
+	result := Result{Parameters: []Parameter{}, Missing: []string{}}
+	extreme := false
+
+	for _, metric := range Parameters {
+		param := Parameter{Name: metric, Unit: models.MetricUnits[metric]}
+		if reading, ok := readings[metric]; ok {
+			value, at := reading.Value, reading.MeasuredAt
+			param.Value, param.MeasuredAt = &value, &at
+			param.Score = ParameterScore(metric, value)
+			result.Total += param.Score
+			extreme = extreme || param.Score == 3
+		} else {
+			result.Missing = append(result.Missing, metric)
+		}
+		result.Parameters = append(result.Parameters, param)
+	}
+	result.Parameters = append(result.Parameters,
+		Parameter{Name: ParameterAirOrOxygen, Assumed: true},
+		Parameter{Name: ParameterConsciousness, Assumed: true},
+	)
+
+	result.Complete = len(result.Missing) == 0
+	result.Band = Band(result.Total, extreme)
+	result.Response = Responses[result.Band]
+	return result
+}
+
+// Band returns the risk band of a total; a single parameter scoring 3 raises a
+// low total to low-medium
+func Band(total int, extreme bool) string {
+	switch {
+	case total >= 7:
+		return BandHigh
+	case total >= 5:
+		return BandMedium
+	case extreme:
+		return BandLowMedium
+	}
+	return BandLow
+}
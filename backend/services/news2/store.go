@@ -0,0 +1,151 @@
+package news2
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"my-health/models"
+	"my-health/services/observations"
+)
+
+// MaxAge is how old a reading may be and still count towards the score
+var MaxAge = 24 * time.Hour
+
+// Current scores the patient's latest readings of each parameter from the
+// MaxAge before now
+func Current(db *gorm.DB, patientID uint, now time.Time) (Result, error) {
+	var list []models.Observation
+	if err := db.Select("DISTINCT ON (metric) *").
+		Where("patient_id = ? AND status <> ?", patientID, models.ObservationEnteredInError).
+		Where("metric IN ? AND effective_at > ? AND effective_at <= ?", storedParameters(), now.Add(-MaxAge), now).
+		Order("metric, effective_at DESC, id DESC").
+		Find(&list).Error; err != nil {
+		return Result{}, err
+	}
+
+	readings := map[string]Reading{}
+	for _, o := range list {
+		for _, metric := range Parameters {
+			if v, ok := observations.Value(o, metric); ok {
+				readings[metric] = Reading{Value: v, MeasuredAt: o.EffectiveAt}
+			}
+		}
+	}
+	result := Score(readings)
+	result.ComputedAt = now
+	return result, nil
+}
+
+func storedParameters() []string {
+	names := make([]string, 0, len(Parameters))
+	for _, metric := range Parameters {
+		names = append(names, observations.Stored(metric))
+	}
+	return names
+}
+
+// Uses reports whether observations of a metric can count towards the score
+func Uses(metric string) bool {
+	for _, stored := range storedParameters() {
+		if stored == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// Recompute is for readings taken in [from, to] that were removed: it deletes
+// the patient's scores computed from then until MaxAge after, which may have
+// counted them, and records the current score instead
+func Recompute(db *gorm.DB, patientID uint, from, to, now time.Time) error {
+	if err := db.Where("patient_id = ? AND computed_at >= ? AND computed_at <= ?", patientID, from, to.Add(MaxAge)).
+		Delete(&models.NewsScore{}).Error; err != nil {
+		return err
+	}
+	result, err := Current(db, patientID, now)
+	if err != nil {
+		return err
+	}
+	if len(result.Missing) == len(Parameters) {
+		return nil
+	}
+	return db.Create(record(patientID, result, now)).Error
+}
+
+// Update records the patient's current score in their history when newly
+// stored observations include a NEWS2 parameter
+func Update(db *gorm.DB, list []models.Observation) error {
+	patients := map[uint]bool{}
+	var order []uint
+	for _, o := range list {
+		if o.Status == models.ObservationEnteredInError || patients[o.PatientID] {
+			continue
+		}
+		for _, metric := range Parameters {
+			if _, ok := observations.Value(o, metric); ok {
+				patients[o.PatientID] = true
+				order = append(order, o.PatientID)
+				break
+			}
+		}
+	}
+
+	now := time.Now()
+	for _, patientID := range order {
+		result, err := Current(db, patientID, now)
+		if err != nil {
+			return err
+		}
+		if len(result.Missing) == len(Parameters) {
+			continue
+		}
+		if err := db.Create(record(patientID, result, now)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record converts a result to a history row
+func record(patientID uint, result Result, now time.Time) *models.NewsScore {
+	score := &models.NewsScore{
+		PatientID:  patientID,
+		Total:      result.Total,
+		Band:       result.Band,
+		Scores:     map[string]int{},
+		Values:     map[string]float64{},
+		Missing:    result.Missing,
+		ComputedAt: now,
+	}
+	for _, param := range result.Parameters {
+		if param.Value == nil {
+			continue
+		}
+		score.Scores[param.Name] = param.Score
+		score.Values[param.Name] = *param.Value
+		if param.MeasuredAt.After(score.LatestReadingAt) {
+			score.LatestReadingAt = *param.MeasuredAt
+		}
+	}
+	return score
+}
+
+// Latest returns the most recent stored score of each patient
+func Latest(db *gorm.DB, patientIDs []uint) (map[uint]models.NewsScore, error) {
+	scores := map[uint]models.NewsScore{}
+	if len(patientIDs) == 0 {
+		return scores, nil
+	}
+	var list []models.NewsScore
+	if err := db.Select("DISTINCT ON (patient_id) *").
+		Where("patient_id IN ?", patientIDs).
+		Order("patient_id, computed_at DESC, id DESC").
+		Find(&list).Error; err != nil {
+		return nil, err
+	}
+	for _, score := range list {
+		scores[score.PatientID] = score
+	}
+	return scores, nil
+}
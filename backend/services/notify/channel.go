@@ -0,0 +1,43 @@
+package notify
+
+import (
+	"context"
+	"errors"
+)
+
+// Message is a rendered notification ready to be delivered
+type Message struct {
+	NotificationID uint
+	UserID         uint
+	Event          string
+	To             string
+	Subject        string
+	Body           string
+	Payload        map[string]interface{}
+	Urgent         bool
+}
+
+// Channel delivers messages over one medium. Errors are retried with backoff
+// unless wrapped with Permanent.
+type Channel interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error that retrying cannot fix, e.g. a rejected address,
+// so the notification goes straight to the dead-letter state
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether the error was marked with Permanent
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
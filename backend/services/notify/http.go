@@ -0,0 +1,210 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var defaultHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// ErrPrivateAddress is returned for a webhook host that is, or resolves to, a
+// loopback, private or link-local address
+var ErrPrivateAddress = errors.New("webhook host is not a public address")
+
+// cgnat is the carrier-grade NAT range, private in practice though not in net.IP.IsPrivate
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// PublicIP reports whether ip can be reached on the public internet. Webhooks
+// may only be sent to such addresses, so a user cannot make the server post
+// patient data to itself or its internal network.
+func PublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || cgnat.Contains(ip))
+}
+
+// publicAddresses resolves host and fails with ErrPrivateAddress if any of its
+// addresses is not public
+func publicAddresses(ctx context.Context, host string) ([]net.IP, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		if !PublicIP(addr.IP) {
+			return nil, ErrPrivateAddress
+		}
+		ips = append(ips, addr.IP)
+	}
+	return ips, nil
+}
+
+// dialPublic connects to one of the host's addresses after checking them all.
+// Dialing the checked address rather than the name means a DNS answer that
+// changes between the check and the connection cannot reach a private address.
+func dialPublic(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := publicAddresses(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	for _, ip := range ips {
+		var conn net.Conn
+		if conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port)); err == nil {
+			return conn, nil
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("no addresses for %s", host)
+	}
+	return nil, err
+}
+
+// webhookClient only connects to public addresses, also when following
+// redirects, and ignores proxy settings that would bypass the check
+var webhookClient = &http.Client{
+	Timeout: 15 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         dialPublic,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+// ValidateWebhookURL checks a webhook URL when it is saved: it must be https
+// and its host must resolve to public addresses only
+func ValidateWebhookURL(ctx context.Context, raw string) error {
+	target, err := url.Parse(raw)
+	if err != nil || target.Scheme != "https" || target.Hostname() == "" {
+		return errors.New("must be an https URL")
+	}
+	if _, err := publicAddresses(ctx, target.Hostname()); err != nil {
+		if errors.Is(err, ErrPrivateAddress) {
+			return errors.New("must point to a public address, not a loopback, private or link-local one")
+		}
+		return fmt.Errorf("host cannot be resolved: %w", err)
+	}
+	return nil
+}
+
+// postJSON sends a JSON body and classifies the response: 4xx other than 408
+// and 429 are permanent failures, everything else non-2xx is retried
+func postJSON(ctx context.Context, client *http.Client, target string, body []byte, headers map[string]string) error {
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("%s returned %s: %s", req.URL.Host, resp.Status, bytes.TrimSpace(detail))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
+
+// SMSChannel sends text messages through a generic HTTP gateway, which receives
+// {"to": "+30...", "from": "...", "message": "..."} as JSON
+type SMSChannel struct {
+	URL    string
+	Token  string
+	From   string
+	Client *http.Client
+}
+
+func (s SMSChannel) Send(ctx context.Context, msg Message) error {
+	if msg.To == "" {
+		return Permanent(errors.New("no phone number"))
+	}
+
+	text := msg.Subject
+	if msg.Body != "" {
+		text += "\n" + msg.Body
+	}
+	body, err := json.Marshal(map[string]string{"to": msg.To, "from": s.From, "message": text})
+	if err != nil {
+		return Permanent(err)
+	}
+
+	headers := map[string]string{}
+	if s.Token != "" {
+		headers["Authorization"] = "Bearer " + s.Token
+	}
+	return postJSON(ctx, s.Client, s.URL, body, headers)
+}
+
+// WebhookChannel posts notifications as JSON to an https URL chosen by the
+// user. The body is signed with HMAC-SHA256 of Secret in the
+// X-MyHealth-Signature header so receivers can check it came from us. Without
+// a Client only public addresses are dialled.
+type WebhookChannel struct {
+	Secret string
+	Client *http.Client
+}
+
+func (w WebhookChannel) Send(ctx context.Context, msg Message) error {
+	target, err := url.Parse(msg.To)
+	if err != nil || target.Scheme != "https" || target.Host == "" {
+		return Permanent(errors.New("invalid webhook URL, https is required"))
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"id":      msg.NotificationID,
+		"event":   msg.Event,
+		"subject": msg.Subject,
+		"body":    msg.Body,
+		"urgent":  msg.Urgent,
+		"data":    msg.Payload,
+		"sent_at": time.Now().UTC(),
+	})
+	if err != nil {
+		return Permanent(err)
+	}
+
+	headers := map[string]string{"X-MyHealth-Event": msg.Event}
+	if w.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.Secret))
+		mac.Write(body)
+		headers["X-MyHealth-Signature"] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	client := w.Client
+	if client == nil {
+		client = webhookClient
+	}
+	err = postJSON(ctx, client, target.String(), body, headers)
+	if errors.Is(err, ErrPrivateAddress) {
+		return Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,200 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// statusServer answers every request with the given status and keeps the last request
+type statusServer struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func (s *statusServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.header = r.Header.Clone()
+	s.body, _ = io.ReadAll(r.Body)
+	w.WriteHeader(s.status)
+}
+
+func TestSendClassifiesResponses(t *testing.T) {
+	cases := []struct {
+		status    int
+		wantErr   bool
+		permanent bool
+	}{
+		{http.StatusOK, false, false},
+		{http.StatusAccepted, false, false},
+		{http.StatusBadRequest, true, true},
+		{http.StatusNotFound, true, true},
+		{http.StatusRequestTimeout, true, false},
+		{http.StatusTooManyRequests, true, false},
+		{http.StatusInternalServerError, true, false},
+		{http.StatusServiceUnavailable, true, false},
+	}
+
+	for _, tc := range cases {
+		handler := &statusServer{status: tc.status}
+		sms := httptest.NewServer(handler)
+		webhook := httptest.NewTLSServer(handler)
+
+		channels := map[string]func() error{
+			"sms": func() error {
+				return SMSChannel{URL: sms.URL, Client: sms.Client()}.
+					Send(context.Background(), Message{To: "+306900000000", Subject: "Reminder"})
+			},
+			"webhook": func() error {
+				return WebhookChannel{Client: webhook.Client()}.
+					Send(context.Background(), Message{To: webhook.URL, Event: "reminder.due", Subject: "Reminder"})
+			},
+		}
+		for name, send := range channels {
+			err := send()
+			if (err != nil) != tc.wantErr {
+				t.Errorf("%s %d: err = %v, want error %v", name, tc.status, err, tc.wantErr)
+			}
+			if IsPermanent(err) != tc.permanent {
+				t.Errorf("%s %d: permanent = %v, want %v", name, tc.status, IsPermanent(err), tc.permanent)
+			}
+		}
+
+		sms.Close()
+		webhook.Close()
+	}
+}
+
+func TestSMSChannelRequest(t *testing.T) {
+	handler := &statusServer{status: http.StatusOK}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	sms := SMSChannel{URL: server.URL, Token: "gateway-token", From: "MyHealth", Client: server.Client()}
+	if err := sms.Send(context.Background(), Message{To: "+306900000000", Subject: "Reminder", Body: "Take your medication"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if got := handler.header.Get("Authorization"); got != "Bearer gateway-token" {
+		t.Errorf("Authorization = %q", got)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(handler.body, &body); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	want := map[string]string{"to": "+306900000000", "from": "MyHealth", "message": "Reminder\nTake your medication"}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("body[%q] = %q, want %q", key, body[key], value)
+		}
+	}
+
+	if err := (SMSChannel{URL: server.URL}).Send(context.Background(), Message{}); !IsPermanent(err) {
+		t.Errorf("missing phone number: err = %v, want permanent", err)
+	}
+}
+
+func TestWebhookChannelSignature(t *testing.T) {
+	handler := &statusServer{status: http.StatusNoContent}
+	server := httptest.NewTLSServer(handler)
+	defer server.Close()
+
+	webhook := WebhookChannel{Secret: "shared-secret", Client: server.Client()}
+	if err := webhook.Send(context.Background(), Message{To: server.URL, Event: "alert.raised", Subject: "High heart rate"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte("shared-secret"))
+	mac.Write(handler.body)
+	if got, want := handler.header.Get("X-MyHealth-Signature"), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("X-MyHealth-Signature = %q, want %q", got, want)
+	}
+	if got := handler.header.Get("X-MyHealth-Event"); got != "alert.raised" {
+		t.Errorf("X-MyHealth-Event = %q", got)
+	}
+
+	unsigned := WebhookChannel{Client: server.Client()}
+	if err := unsigned.Send(context.Background(), Message{To: server.URL, Event: "alert.raised"}); err != nil {
+		t.Fatalf("Send without secret: %v", err)
+	}
+	if got := handler.header.Get("X-MyHealth-Signature"); got != "" {
+		t.Errorf("X-MyHealth-Signature without secret = %q, want none", got)
+	}
+}
+
+func TestWebhookChannelRejectsUnsafeTargets(t *testing.T) {
+	server := httptest.NewTLSServer(&statusServer{status: http.StatusOK})
+	defer server.Close()
+
+	for _, to := range []string{"", "http://example.com/hook", "ftp://example.com/hook", "https://"} {
+		err := WebhookChannel{}.Send(context.Background(), Message{To: to})
+		if !IsPermanent(err) {
+			t.Errorf("%q: err = %v, want permanent", to, err)
+		}
+	}
+
+	// Without a client of its own the channel refuses to dial the loopback test server
+	err := WebhookChannel{}.Send(context.Background(), Message{To: server.URL})
+	if !IsPermanent(err) || !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("loopback target: err = %v, want permanent ErrPrivateAddress", err)
+	}
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	cases := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://93.184.216.34/hook", true},
+		{"https://[2606:4700:4700::1111]/hook", true},
+		{"http://93.184.216.34/hook", false},
+		{"https:///hook", false},
+		{"not a url", false},
+		{"https://127.0.0.1/hook", false},
+		{"https://[::1]/hook", false},
+		{"https://localhost:8443/hook", false},
+		{"https://10.1.2.3/hook", false},
+		{"https://172.16.0.1/hook", false},
+		{"https://192.168.1.10/hook", false},
+		{"https://169.254.169.254/latest/meta-data", false},
+		{"https://[fe80::1]/hook", false},
+		{"https://[fd00::1]/hook", false},
+		{"https://100.64.0.1/hook", false},
+		{"https://0.0.0.0/hook", false},
+	}
+
+	for _, tc := range cases {
+		err := ValidateWebhookURL(context.Background(), tc.url)
+		if (err == nil) != tc.valid {
+			t.Errorf("%q: err = %v, want valid %v", tc.url, err, tc.valid)
+		}
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	cases := map[string]bool{
+		"8.8.8.8":         true,
+		"2001:4860::8888": true,
+		"127.0.0.1":       false,
+		"10.0.0.1":        false,
+		"192.168.0.1":     false,
+		"169.254.1.1":     false,
+		"100.100.0.1":     false,
+		"224.0.0.1":       false,
+		"::":              false,
+		"::ffff:10.0.0.1": false,
+	}
+	for ip, want := range cases {
+		if got := PublicIP(net.ParseIP(ip)); got != want {
+			t.Errorf("PublicIP(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package notify
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"my-health/models"
+)
+
+// InAppChannel delivers notifications to the user's inbox in the app. A retried
+// notification is only added to the inbox once.
+type InAppChannel struct {
+	DB *gorm.DB
+}
+
+func (i InAppChannel) Send(ctx context.Context, msg Message) error {
+	return i.DB.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&models.InboxMessage{
+		UserID:         msg.UserID,
+		NotificationID: msg.NotificationID,
+		Event:          msg.Event,
+		Subject:        msg.Subject,
+		Body:           msg.Body,
+	}).Error
+}
@@ -0,0 +1,342 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"my-health/models"
+)
+
+var (
+	pollInterval = 15 * time.Second
+	// sendTimeout bounds a single delivery attempt
+	sendTimeout = 30 * time.Second
+	// staleAfter is when a notification stuck in sending, e.g. because the
+	// server stopped mid-delivery, is picked up again
+	staleAfter = 10 * time.Minute
+	batchSize  = 50
+
+	// MaxAttempts is how often delivery is tried before a notification is dead
+	MaxAttempts = 8
+	baseBackoff = 30 * time.Second
+	maxBackoff  = time.Hour
+
+	workerOnce sync.Once
+)
+
+// Backoff is the wait before the next attempt after the given number of failed attempts
+func Backoff(attempts int) time.Duration {
+	wait := baseBackoff
+	for i := 1; i < attempts && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	return wait
+}
+
+// parseClock parses an "HH:MM" time of day into minutes after midnight
+func parseClock(value string) (int, bool) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// ValidClock reports whether value is an "HH:MM" time of day
+func ValidClock(value string) bool {
+	_, ok := parseClock(value)
+	return ok
+}
+
+// QuietUntil returns when the preference's quiet hours end if now falls inside
+// them, or now otherwise. Quiet hours may span midnight, e.g. 22:00-07:00.
+func QuietUntil(pref models.NotificationPreference, now time.Time) time.Time {
+	start, okStart := parseClock(pref.QuietHoursStart)
+	end, okEnd := parseClock(pref.QuietHoursEnd)
+	if !okStart || !okEnd || start == end {
+		return now
+	}
+	loc := time.UTC
+	if pref.Timezone != "" {
+		if l, err := time.LoadLocation(pref.Timezone); err == nil {
+			loc = l
+		}
+	}
+
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	quiet := minute >= start && minute < end
+	if start > end {
+		quiet = minute >= start || minute < end
+	}
+	if !quiet {
+		return now
+	}
+
+	until := time.Date(local.Year(), local.Month(), local.Day(), end/60, end%60, 0, 0, loc)
+	if !until.After(local) {
+		until = until.AddDate(0, 0, 1)
+	}
+	return until
+}
+
+// Notify renders the event's templates and queues a notification for every
+// channel each user has enabled. Users who have not set any preferences get the
+// in-app inbox. Urgent notifications ignore quiet hours.
+func Notify(db *gorm.DB, userIDs []uint, event string, data map[string]interface{}, urgent bool) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	subject, body, err := Render(event, data)
+	if err != nil {
+		return err
+	}
+
+	var prefs []models.NotificationPreference
+	if err := db.Where("user_id IN ?", userIDs).Find(&prefs).Error; err != nil {
+		return err
+	}
+	byUser := map[uint][]models.NotificationPreference{}
+	for _, pref := range prefs {
+		byUser[pref.UserID] = append(byUser[pref.UserID], pref)
+	}
+
+	now := time.Now()
+	var queued []models.Notification
+	seen := map[uint]bool{}
+	for _, userID := range userIDs {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		userPrefs, ok := byUser[userID]
+		if !ok {
+			userPrefs = []models.NotificationPreference{{UserID: userID, Channel: models.ChannelInApp, Enabled: true}}
+		}
+		for _, pref := range userPrefs {
+			if !pref.Enabled || (pref.Channel != models.ChannelInApp && pref.Address == "") {
+				continue
+			}
+			next := now
+			if !urgent {
+				next = QuietUntil(pref, now)
+			}
+			queued = append(queued, models.Notification{
+				UserID:        userID,
+				Channel:       pref.Channel,
+				Event:         event,
+				Address:       pref.Address,
+				Subject:       subject,
+				Body:          body,
+				Payload:       data,
+				Urgent:        urgent,
+				Status:        models.NotificationPending,
+				NextAttemptAt: next,
+			})
+		}
+	}
+	if len(queued) == 0 {
+		return nil
+	}
+	return db.Create(&queued).Error
+}
+
+// Send queues one notification on the given channel right away, regardless of
+// the recipient's preferences and quiet hours. UserID is 0 for recipients
+// without an account, such as emergency contacts.
+func Send(db *gorm.DB, userID uint, channel, address, event string, data map[string]interface{}, urgent bool) (models.Notification, error) {
+	notification := models.Notification{
+		UserID:        userID,
+		Channel:       channel,
+		Event:         event,
+		Address:       address,
+		Payload:       data,
+		Urgent:        urgent,
+		Status:        models.NotificationPending,
+		NextAttemptAt: time.Now(),
+	}
+	var err error
+	if notification.Subject, notification.Body, err = Render(event, data); err != nil {
+		return notification, err
+	}
+	err = db.Create(&notification).Error
+	return notification, err
+}
+
+// CaregiverIDs returns the patient's own user and the admins of their households
+func CaregiverIDs(db *gorm.DB, patientID uint) ([]uint, error) {
+	var ids []uint
+	err := db.Raw(`SELECT user_id FROM patients WHERE id = ? AND deleted_at IS NULL
+		UNION
+		SELECT households.admin_id FROM households
+		JOIN household_patients ON household_patients.household_id = households.id
+		WHERE household_patients.patient_id = ? AND households.deleted_at IS NULL`,
+		patientID, patientID).Scan(&ids).Error
+	return ids, err
+}
+
+// ChannelsFromEnv configures the delivery channels. The in-app inbox and
+// webhooks are always available; email needs SMTP_HOST and SMS needs
+// SMS_GATEWAY_URL.
+func ChannelsFromEnv(db *gorm.DB) map[string]Channel {
+	channels := map[string]Channel{
+		models.ChannelInApp:   InAppChannel{DB: db},
+		models.ChannelWebhook: WebhookChannel{Secret: os.Getenv("WEBHOOK_SECRET")},
+	}
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		from := os.Getenv("SMTP_FROM")
+		if from == "" {
+			from = "my-health@localhost"
+		}
+		channels[models.ChannelEmail] = SMTPChannel{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	}
+
+	if url := os.Getenv("SMS_GATEWAY_URL"); url != "" {
+		channels[models.ChannelSMS] = SMSChannel{
+			URL:   url,
+			Token: os.Getenv("SMS_GATEWAY_TOKEN"),
+			From:  os.Getenv("SMS_FROM"),
+		}
+	}
+	return channels
+}
+
+// StartWorker starts the background worker that delivers queued notifications
+func StartWorker(db *gorm.DB, channels map[string]Channel) {
+	workerOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(pollInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				for {
+					sent, err := DeliverDue(context.Background(), db, channels, time.Now())
+					if err != nil {
+						log.Printf("Error delivering notifications: %v", err)
+					}
+					if err != nil || sent < batchSize {
+						break
+					}
+				}
+			}
+		}()
+	})
+}
+
+// DeliverDue claims a batch of due notifications and tries to deliver them. It
+// returns how many were claimed. Claiming with SKIP LOCKED lets several servers
+// share the queue without sending a notification twice.
+func DeliverDue(ctx context.Context, db *gorm.DB, channels map[string]Channel, now time.Time) (int, error) {
+	if err := db.Model(&models.Notification{}).
+		Where("status = ? AND updated_at < ?", models.NotificationSending, now.Add(-staleAfter)).
+		Update("status", models.NotificationPending).Error; err != nil {
+		return 0, err
+	}
+
+	var ids []uint
+	if err := db.Raw(`UPDATE notifications SET status = ?, attempts = attempts + 1, updated_at = ?
+		WHERE id IN (
+			SELECT id FROM notifications
+			WHERE status = ? AND next_attempt_at <= ? AND deleted_at IS NULL
+			ORDER BY urgent DESC, next_attempt_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id`,
+		models.NotificationSending, now, models.NotificationPending, now, batchSize).
+		Scan(&ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	var notifications []models.Notification
+	if err := db.Where("id IN ?", ids).Order("urgent DESC, next_attempt_at").Find(&notifications).Error; err != nil {
+		return 0, err
+	}
+	for _, n := range notifications {
+		deliver(ctx, db, channels, n)
+	}
+	return len(ids), nil
+}
+
+// deliver sends one claimed notification and records the outcome
+func deliver(ctx context.Context, db *gorm.DB, channels map[string]Channel, n models.Notification) {
+	var err error
+	channel, ok := channels[n.Channel]
+	if ok {
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err = channel.Send(sendCtx, Message{
+			NotificationID: n.ID,
+			UserID:         n.UserID,
+			Event:          n.Event,
+			To:             n.Address,
+			Subject:        n.Subject,
+			Body:           n.Body,
+			Payload:        n.Payload,
+			Urgent:         n.Urgent,
+		})
+		cancel()
+	} else {
+		err = Permanent(fmt.Errorf("channel %s is not configured", n.Channel))
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{}
+	switch {
+	case err == nil:
+		updates["status"] = models.NotificationSent
+		updates["sent_at"] = now
+		updates["last_error"] = ""
+	case IsPermanent(err) || n.Attempts >= MaxAttempts:
+		updates["status"] = models.NotificationDead
+		updates["last_error"] = truncate(err.Error(), 500)
+		log.Printf("Notification %d (%s to user %d) failed permanently: %v", n.ID, n.Channel, n.UserID, err)
+	default:
+		updates["status"] = models.NotificationPending
+		updates["next_attempt_at"] = now.Add(Backoff(n.Attempts))
+		updates["last_error"] = truncate(err.Error(), 500)
+	}
+	if err := db.Model(&models.Notification{}).Where("id = ?", n.ID).Updates(updates).Error; err != nil {
+		log.Printf("Error updating notification %d: %v", n.ID, err)
+	}
+}
+
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	return strings.ToValidUTF8(value[:max], "")
+}
+
+// Retry puts a dead notification back in the queue for immediate delivery
+func Retry(db *gorm.DB, n *models.Notification) error {
+	return db.Model(n).Updates(map[string]interface{}{
+		"status":          models.NotificationPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+	}).Error
+}
@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"my-health/models"
+)
+
+func TestBackoff(t *testing.T) {
+	cases := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{50, time.Hour},
+	}
+	for _, tc := range cases {
+		if got := Backoff(tc.attempts); got != tc.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tc.attempts, got, tc.want)
+		}
+	}
+}
+
+func TestQuietUntil(t *testing.T) {
+	athens, err := time.LoadLocation("Europe/Athens")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	at := func(day, hour, minute int, loc *time.Location) time.Time {
+		return time.Date(2026, time.January, day, hour, minute, 0, 0, loc)
+	}
+	overnight := models.NotificationPreference{QuietHoursStart: "22:00", QuietHoursEnd: "07:00"}
+	daytime := models.NotificationPreference{QuietHoursStart: "13:00", QuietHoursEnd: "15:30"}
+
+	cases := []struct {
+		name string
+		pref models.NotificationPreference
+		now  time.Time
+		want time.Time
+	}{
+		{"no quiet hours", models.NotificationPreference{}, at(1, 23, 0, time.UTC), at(1, 23, 0, time.UTC)},
+		{"start equals end", models.NotificationPreference{QuietHoursStart: "22:00", QuietHoursEnd: "22:00"}, at(1, 22, 30, time.UTC), at(1, 22, 30, time.UTC)},
+		{"invalid clock", models.NotificationPreference{QuietHoursStart: "25:00", QuietHoursEnd: "07:00"}, at(1, 23, 0, time.UTC), at(1, 23, 0, time.UTC)},
+		{"before overnight span", overnight, at(1, 21, 59, time.UTC), at(1, 21, 59, time.UTC)},
+		{"overnight span starts", overnight, at(1, 22, 0, time.UTC), at(2, 7, 0, time.UTC)},
+		{"overnight span before midnight", overnight, at(1, 23, 45, time.UTC), at(2, 7, 0, time.UTC)},
+		{"overnight span after midnight", overnight, at(2, 3, 15, time.UTC), at(2, 7, 0, time.UTC)},
+		{"overnight span ends", overnight, at(2, 7, 0, time.UTC), at(2, 7, 0, time.UTC)},
+		{"same-day span", daytime, at(1, 14, 0, time.UTC), at(1, 15, 30, time.UTC)},
+		{"outside same-day span", daytime, at(1, 16, 0, time.UTC), at(1, 16, 0, time.UTC)},
+		{"across midnight in the user's zone", models.NotificationPreference{QuietHoursStart: "22:00", QuietHoursEnd: "07:00", Timezone: "Europe/Athens"},
+			at(1, 21, 30, time.UTC), at(2, 7, 0, athens)},
+		{"outside quiet hours in the user's zone", models.NotificationPreference{QuietHoursStart: "22:00", QuietHoursEnd: "07:00", Timezone: "Europe/Athens"},
+			at(1, 19, 30, time.UTC), at(1, 19, 30, time.UTC)},
+	}
+
+	for _, tc := range cases {
+		if got := QuietUntil(tc.pref, tc.now); !got.Equal(tc.want) {
+			t.Errorf("%s: QuietUntil(%v) = %v, want %v", tc.name, tc.now, got, tc.want)
+		}
+	}
+}
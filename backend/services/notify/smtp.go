@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// SMTPChannel sends email through an SMTP server. Authentication is only used
+// when Username is set, so local stand-ins such as MailHog work without it.
+// STARTTLS is used when the server offers it; TLSConfig overrides the default
+// of verifying the certificate against Host.
+type SMTPChannel struct {
+	Host      string
+	Port      string
+	Username  string
+	Password  string
+	From      string
+	Timeout   time.Duration
+	TLSConfig *tls.Config
+}
+
+func (s SMTPChannel) Send(ctx context.Context, msg Message) error {
+	if msg.To == "" || strings.ContainsAny(msg.To, "\r\n") {
+		return Permanent(errors.New("invalid email address"))
+	}
+
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.Host, s.Port))
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		config := &tls.Config{ServerName: s.Host}
+		if s.TLSConfig != nil {
+			config = s.TLSConfig.Clone()
+			if config.ServerName == "" {
+				config.ServerName = s.Host
+			}
+		}
+		if err := client.StartTLS(config); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(s.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		// 5xx replies mean the server will never accept this recipient
+		var protoErr *textproto.Error
+		if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+			return Permanent(err)
+		}
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	headers := []string{
+		"From: " + s.From,
+		"To: " + msg.To,
+		"Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"Content-Transfer-Encoding: 8bit",
+	}
+	body := strings.ReplaceAll(msg.Body, "\n", "\r\n")
+	if _, err := fmt.Fprintf(w, "%s\r\n\r\n%s\r\n", strings.Join(headers, "\r\n"), body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,173 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubSMTP is a minimal SMTP server that answers RCPT TO with rcptReply and
+// accepts everything else. It offers STARTTLS only when tls is set, and never AUTH.
+type stubSMTP struct {
+	rcptReply string
+	tls       *tls.Config
+
+	mu        sync.Mutex
+	delivered int
+	secure    bool // whether the last message came over TLS
+}
+
+// smtpStub starts a stub without STARTTLS
+func smtpStub(t *testing.T, rcptReply string) (host, port string) {
+	return (&stubSMTP{rcptReply: rcptReply}).start(t)
+}
+
+func (s *stubSMTP) start(t *testing.T) (host, port string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	host, port, _ = net.SplitHostPort(listener.Addr().String())
+	return host, port
+}
+
+func (s *stubSMTP) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	text := textproto.NewConn(conn)
+	secure := false
+	text.PrintfLine("220 stub ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO", "HELO":
+			if s.tls != nil && !secure {
+				text.PrintfLine("250-stub")
+				text.PrintfLine("250 STARTTLS")
+			} else {
+				text.PrintfLine("250 stub")
+			}
+		case "STARTTLS":
+			if s.tls == nil || secure {
+				text.PrintfLine("502 not supported")
+				continue
+			}
+			text.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, text, secure = tlsConn, textproto.NewConn(tlsConn), true
+		case "RCPT":
+			text.PrintfLine("%s", s.rcptReply)
+		case "DATA":
+			text.PrintfLine("354 end with <CRLF>.<CRLF>")
+			if _, err := text.ReadDotBytes(); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.delivered++
+			s.secure = secure
+			s.mu.Unlock()
+			text.PrintfLine("250 queued")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("250 ok")
+		}
+	}
+}
+
+func TestSMTPChannelRecipientReplies(t *testing.T) {
+	cases := []struct {
+		rcptReply string
+		wantErr   bool
+		permanent bool
+	}{
+		{"250 2.1.5 ok", false, false},
+		{"450 4.2.1 mailbox busy", true, false},
+		{"550 5.1.1 no such user", true, true},
+		{"553 5.1.3 bad address", true, true},
+	}
+
+	for _, tc := range cases {
+		host, port := smtpStub(t, tc.rcptReply)
+		channel := SMTPChannel{Host: host, Port: port, From: "noreply@myhealth.test", Timeout: 5 * time.Second}
+		err := channel.Send(context.Background(), Message{To: "patient@example.com", Subject: "Reminder", Body: "Line one\nLine two"})
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%q: err = %v, want error %v", tc.rcptReply, err, tc.wantErr)
+		}
+		if IsPermanent(err) != tc.permanent {
+			t.Errorf("%q: permanent = %v, want %v", tc.rcptReply, IsPermanent(err), tc.permanent)
+		}
+	}
+}
+
+func TestSMTPChannelRejectsHeaderInjection(t *testing.T) {
+	channel := SMTPChannel{Host: "127.0.0.1", Port: "1", From: "noreply@myhealth.test"}
+	for _, to := range []string{"", "patient@example.com\r\nBcc: other@example.com"} {
+		if err := channel.Send(context.Background(), Message{To: to}); !IsPermanent(err) {
+			t.Errorf("%q: err = %v, want permanent", to, err)
+		}
+	}
+}
+
+func TestSMTPChannelStartTLS(t *testing.T) {
+	// Borrow the test certificate of httptest, valid for 127.0.0.1
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	certificates := server.TLS.Certificates
+	roots := server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	server.Close()
+
+	stub := &stubSMTP{rcptReply: "250 ok", tls: &tls.Config{Certificates: certificates}}
+	host, port := stub.start(t)
+	msg := Message{To: "patient@example.com", Subject: "Reminder"}
+
+	channel := SMTPChannel{Host: host, Port: port, From: "noreply@myhealth.test", Timeout: 5 * time.Second,
+		TLSConfig: &tls.Config{RootCAs: roots}}
+	if err := channel.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	stub.mu.Lock()
+	delivered, secure := stub.delivered, stub.secure
+	stub.mu.Unlock()
+	if delivered != 1 || !secure {
+		t.Errorf("delivered %d messages, over TLS %v; want 1 over TLS", delivered, secure)
+	}
+
+	// Without a TLS config the certificate is still verified against Host,
+	// so the handshake gets as far as rejecting the unknown test authority
+	channel.TLSConfig = nil
+	err := channel.Send(context.Background(), msg)
+	var unknown x509.UnknownAuthorityError
+	if !errors.As(err, &unknown) {
+		t.Errorf("default TLS config: err = %v, want an unknown authority error", err)
+	}
+}
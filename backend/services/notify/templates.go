@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Notification events
+const (
+	EventAlertRaised         = "alert.raised"
+	EventAppointmentReminder = "appointment.reminder"
+	EventAlertEscalated      = "alert.escalated"
+	EventAlertAssigned       = "alert.assigned"
+)
+
+type messageTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+var funcs = template.FuncMap{"upper": strings.ToUpper}
+
+var templates = map[string]messageTemplate{}
+
+// RegisterTemplate adds or replaces the subject and body templates of an event.
+// Templates use text/template and receive the data passed to Notify.
+func RegisterTemplate(event, subject, body string) {
+	templates[event] = messageTemplate{
+		subject: template.Must(template.New(event + ".subject").Funcs(funcs).Parse(subject)),
+		body:    template.Must(template.New(event + ".body").Funcs(funcs).Parse(body)),
+	}
+}
+
+func init() {
+	RegisterTemplate(EventAlertRaised,
+		`{{upper .Severity}}: {{.PatientName}} - {{.Message}}`,
+		`{{.Message}}
+
+Patient: {{.PatientName}}
+Seen at: {{.SeenAt}}
+Open the app to acknowledge this alert.`)
+
+	RegisterTemplate(EventAlertEscalated,
+		`Unacknowledged {{.Severity}} alert for {{.PatientName}}`,
+		`{{.Message}}
+
+No one has acknowledged this alert for {{.PatientName}} since {{.SeenAt}}. Please check on them.`)
+
+	RegisterTemplate(EventAlertAssigned,
+		`Alert assigned to you: {{.PatientName}} - {{.Message}}`,
+		`You have been asked to follow up on this {{.Severity}} alert for {{.PatientName}}:
+
+{{.Message}}`)
+
+	RegisterTemplate(EventAppointmentReminder,
+		`Reminder: {{.Type}} appointment for {{.PatientName}}`,
+		`{{.PatientName}} has a {{.Type}} appointment on {{.StartTime}}{{if .Provider}} with {{.Provider}}{{end}}{{if .Location}} at {{.Location}}{{end}}.`)
+}
+
+// Render fills in the event's templates
+func Render(event string, data map[string]interface{}) (string, string, error) {
+	tmpl, ok := templates[event]
+	if !ok {
+		return "", "", fmt.Errorf("no template for event %q", event)
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, data); err != nil {
+		return "", "", err
+	}
+	if err := tmpl.body.Execute(&body, data); err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(subject.String()), strings.TrimSpace(body.String()), nil
+}
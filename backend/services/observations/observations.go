@@ -0,0 +1,267 @@
+package observations
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"my-health/models"
+)
+
+// Sleep stage component names
+const (
+	ComponentLight     = "light"
+	ComponentDeep      = "deep"
+	ComponentREM       = "rem"
+	ComponentAwakeTime = "awake_time"
+)
+
+// Split breaks a wide HealthMetrics reading into one observation per measured
+// metric. Zero values were not measured and are skipped; blood pressure is taken
+// from SystolicBP/DiastolicBP, falling back to the "120/80" BloodPressure string.
+func Split(h models.HealthMetrics) []models.Observation {
+	effectiveAt := h.Date
+	if effectiveAt.IsZero() {
+		effectiveAt = time.Now()
+	}
+
+	var result []models.Observation
+	add := func(metric string, value float64) *models.Observation {
+		result = append(result, models.Observation{
+			PatientID:       h.PatientID,
+			Metric:          metric,
+			Value:           value,
+			Unit:            models.ObservationMetrics[metric],
+			EffectiveAt:     effectiveAt,
+			Source:          h.Source,
+			DeviceID:        h.DeviceID,
+			Status:          models.ObservationFinal,
+			LegacyMetricsID: h.ID,
+		})
+		return &result[len(result)-1]
+	}
+
+	if h.HeartRate != 0 {
+		add(models.MetricHeartRate, float64(h.HeartRate))
+	}
+	systolic, diastolic := h.SystolicBP, h.DiastolicBP
+	if systolic == 0 && h.BloodPressure != "" {
+		fmt.Sscanf(h.BloodPressure, "%d/%d", &systolic, &diastolic)
+	}
+	if systolic != 0 {
+		d := float64(diastolic)
+		add(models.MetricBloodPressure, float64(systolic)).Value2 = &d
+	}
+	if h.OxygenSaturation != 0 {
+		add(models.MetricOxygenSaturation, h.OxygenSaturation)
+	}
+	if h.Weight != 0 {
+		add(models.MetricWeight, h.Weight)
+	}
+	if h.StepsCount != 0 {
+		add(models.MetricStepsCount, float64(h.StepsCount))
+	}
+	if h.SleepDuration != 0 {
+		add(models.MetricSleepDuration, h.SleepDuration).Components = map[string]float64{
+			ComponentLight:     h.Sleep.Light,
+			ComponentDeep:      h.Sleep.Deep,
+			ComponentREM:       h.Sleep.REM,
+			ComponentAwakeTime: float64(h.Sleep.AwakeTime),
+		}
+	}
+	if h.RespirationRate != 0 {
+		add(models.MetricRespirationRate, float64(h.RespirationRate))
+	}
+	if h.BodyTemperature != 0 {
+		add(models.MetricBodyTemperature, h.BodyTemperature)
+	}
+	if h.IrregularRhythm {
+		add(models.MetricIrregularRhythm, 1)
+	}
+	if h.FallDetected {
+		add(models.MetricFallDetected, 1)
+	}
+	return result
+}
+
+// merge copies one observation onto a projected HealthMetrics row
+func merge(h *models.HealthMetrics, o models.Observation) {
+	switch o.Metric {
+	case models.MetricHeartRate:
+		h.HeartRate = int(o.Value)
+	case models.MetricBloodPressure:
+		h.SystolicBP = int(o.Value)
+		if o.Value2 != nil {
+			h.DiastolicBP = int(*o.Value2)
+		}
+		h.BloodPressure = fmt.Sprintf("%d/%d", h.SystolicBP, h.DiastolicBP)
+	case models.MetricOxygenSaturation:
+		h.OxygenSaturation = o.Value
+	case models.MetricWeight:
+		h.Weight = o.Value
+	case models.MetricStepsCount:
+		h.StepsCount = int(o.Value)
+	case models.MetricSleepDuration:
+		h.SleepDuration = o.Value
+		h.Sleep = models.SleepStages{
+			Light:     o.Components[ComponentLight],
+			Deep:      o.Components[ComponentDeep],
+			REM:       o.Components[ComponentREM],
+			AwakeTime: int(o.Components[ComponentAwakeTime]),
+		}
+	case models.MetricRespirationRate:
+		h.RespirationRate = int(o.Value)
+	case models.MetricBodyTemperature:
+		h.BodyTemperature = o.Value
+	case models.MetricIrregularRhythm:
+		h.IrregularRhythm = o.Value != 0
+	case models.MetricFallDetected:
+		h.FallDetected = o.Value != 0
+	}
+}
+
+// Value reads a query metric from an observation; systolic and diastolic
+// pressure are the two values of a blood_pressure observation
+func Value(o models.Observation, metric string) (float64, bool) {
+	switch metric {
+	case models.MetricSystolicBP:
+		return o.Value, o.Metric == models.MetricBloodPressure
+	case models.MetricDiastolicBP:
+		if o.Metric != models.MetricBloodPressure || o.Value2 == nil {
+			return 0, false
+		}
+		return *o.Value2, true
+	}
+	return o.Value, o.Metric == metric
+}
+
+// Stored returns the observation metric that holds a query metric
+func Stored(metric string) string {
+	if metric == models.MetricSystolicBP || metric == models.MetricDiastolicBP {
+		return models.MetricBloodPressure
+	}
+	return metric
+}
+
+// SameAsLatest reports whether the observation repeats the value in the latest
+// reading of its metric
+func SameAsLatest(o models.Observation, latest models.HealthMetrics) bool {
+	if o.Metric == models.MetricBloodPressure {
+		return o.Value2 != nil && latest.SystolicBP == int(o.Value) && latest.DiastolicBP == int(*o.Value2)
+	}
+	value, ok := latest.Value(o.Metric)
+	return ok && value == o.Value
+}
+
+// Project rebuilds the legacy wide HealthMetrics rows from observations, one row
+// per reading (same time, source and device), ordered by time. Each row takes the
+// ID of its first observation.
+func Project(list []models.Observation) []models.HealthMetrics {
+	type readingKey struct {
+		at       int64
+		source   string
+		deviceID string
+	}
+
+	index := map[readingKey]int{}
+	var rows []models.HealthMetrics
+	for _, o := range list {
+		key := readingKey{o.EffectiveAt.UnixNano(), o.Source, o.DeviceID}
+		i, ok := index[key]
+		if !ok {
+			i = len(rows)
+			index[key] = i
+			rows = append(rows, models.HealthMetrics{
+				Model:     gorm.Model{ID: o.ID, CreatedAt: o.CreatedAt, UpdatedAt: o.UpdatedAt},
+				PatientID: o.PatientID,
+				Date:      o.EffectiveAt,
+				Source:    o.Source,
+				DeviceID:  o.DeviceID,
+			})
+		}
+		if o.ID < rows[i].ID {
+			rows[i].ID = o.ID
+		}
+		merge(&rows[i], o)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Date.Before(rows[j].Date) })
+	return rows
+}
+
+// Record stores a reading as observations and returns them. Observations a
+// device already sent, with the same patient, device, instant and metric, are
+// skipped by the unique index on those columns; only the stored ones are
+// returned. Each observation is inserted on its own, as a multi-row insert
+// that skips conflicts returns fewer ids than rows and cannot tell which rows
+// they belong to.
+func Record(db *gorm.DB, reading models.HealthMetrics) ([]models.Observation, error) {
+	list := Split(reading)
+	if len(list) == 0 {
+		return list, nil
+	}
+	stored := make([]models.Observation, 0, len(list))
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i := range list {
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&list[i])
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 1 {
+				stored = append(stored, list[i])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// valid leaves out observations marked as entered in error
+func valid(db *gorm.DB) *gorm.DB {
+	return db.Where("status <> ?", models.ObservationEnteredInError)
+}
+
+// Load returns a patient's readings in [from, to) in the legacy HealthMetrics shape
+func Load(db *gorm.DB, patientID uint, from, to time.Time) ([]models.HealthMetrics, error) {
+	var list []models.Observation
+	if err := valid(db).
+		Where("patient_id = ? AND effective_at >= ? AND effective_at < ?", patientID, from, to).
+		Order("effective_at ASC, id ASC").
+		Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return Project(list), nil
+}
+
+// Latest combines the most recent observation of every metric into one row,
+// dated at the newest of them. It returns gorm.ErrRecordNotFound if the patient
+// has no observations.
+func Latest(db *gorm.DB, patientID uint) (models.HealthMetrics, error) {
+	var list []models.Observation
+	if err := valid(db).
+		Select("DISTINCT ON (metric) *").
+		Where("patient_id = ?", patientID).
+		Order("metric, effective_at DESC, id DESC").
+		Find(&list).Error; err != nil {
+		return models.HealthMetrics{}, err
+	}
+	if len(list) == 0 {
+		return models.HealthMetrics{}, gorm.ErrRecordNotFound
+	}
+
+	latest := models.HealthMetrics{PatientID: patientID}
+	for _, o := range list {
+		if o.EffectiveAt.After(latest.Date) {
+			latest.ID = o.ID
+			latest.Date = o.EffectiveAt
+		}
+		merge(&latest, o)
+	}
+	return latest, nil
+}
@@ -0,0 +1,38 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"my-health/models"
+	"my-health/services/alerts"
+	"my-health/services/baseline"
+	"my-health/services/news2"
+	"my-health/services/timeseries"
+)
+
+// Process runs everything that follows newly stored observations: the alert
+// rules, the personal baselines, the NEWS2 score and the metric rollups. Every step runs even if
+// an earlier one fails; their errors are returned together.
+func Process(db *gorm.DB, list []models.Observation) error {
+	if len(list) == 0 {
+		return nil
+	}
+
+	var errs []error
+	if _, err := alerts.Check(db, list); err != nil {
+		errs = append(errs, fmt.Errorf("checking alerts: %w", err))
+	}
+	if _, err := baseline.Observe(db, list); err != nil {
+		errs = append(errs, fmt.Errorf("comparing with baselines: %w", err))
+	}
+	if err := news2.Update(db, list); err != nil {
+		errs = append(errs, fmt.Errorf("updating NEWS2 score: %w", err))
+	}
+	if err := timeseries.MarkDirty(db, list); err != nil {
+		errs = append(errs, fmt.Errorf("marking rollups: %w", err))
+	}
+	return errors.Join(errs...)
+}
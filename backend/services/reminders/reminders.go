@@ -0,0 +1,192 @@
+package reminders
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"my-health/initializers"
+	"my-health/models"
+	"my-health/services/notify"
+)
+
+var (
+	checkInterval = 1 * time.Minute
+	// lookahead bounds how far ahead appointments are considered for reminders
+	lookahead = 7 * 24 * time.Hour
+	// DefaultOffsets are used for appointments without their own reminder settings
+	DefaultOffsets = []int{24 * 60, 2 * 60} // one day and two hours before
+
+	workerOnce sync.Once
+)
+
+// Reminder is a single reminder about an upcoming appointment
+type Reminder struct {
+	Appointment   models.Appointment
+	Patient       models.Patient
+	Recipients    []models.User
+	OffsetMinutes int
+}
+
+// Notifier delivers appointment reminders to their recipients
+type Notifier interface {
+	SendAppointmentReminder(ctx context.Context, reminder Reminder) error
+}
+
+// LogNotifier writes reminders to the server log
+type LogNotifier struct{}
+
+func (LogNotifier) SendAppointmentReminder(ctx context.Context, reminder Reminder) error {
+	for _, recipient := range reminder.Recipients {
+		log.Printf("Reminder for %s: %s appointment for %s %s with %s at %s (%s)",
+			recipient.Username,
+			reminder.Appointment.Type,
+			reminder.Patient.Name, reminder.Patient.Surname,
+			reminder.Appointment.Provider,
+			reminder.Appointment.StartTime.Format("2006-01-02 15:04"),
+			reminder.Appointment.Location,
+		)
+	}
+	return nil
+}
+
+// QueueNotifier queues reminders with the notification service, which delivers
+// them over each recipient's preferred channels
+type QueueNotifier struct{}
+
+func (QueueNotifier) SendAppointmentReminder(ctx context.Context, reminder Reminder) error {
+	ids := make([]uint, 0, len(reminder.Recipients))
+	for _, recipient := range reminder.Recipients {
+		ids = append(ids, recipient.ID)
+	}
+	return notify.Notify(initializers.DB.WithContext(ctx), ids, notify.EventAppointmentReminder, map[string]interface{}{
+		"AppointmentID": reminder.Appointment.ID,
+		"PatientID":     reminder.Patient.ID,
+		"PatientName":   reminder.Patient.Name + " " + reminder.Patient.Surname,
+		"Type":          reminder.Appointment.Type,
+		"Provider":      reminder.Appointment.Provider,
+		"Location":      reminder.Appointment.Location,
+		"StartTime":     reminder.Appointment.StartTime.Format("2006-01-02 15:04"),
+	}, false)
+}
+
+// StartReminderWorker starts the background worker that sends due reminders
+func StartReminderWorker(notifier Notifier) {
+	workerOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(checkInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				if err := SendDueReminders(context.Background(), notifier, time.Now()); err != nil {
+					log.Printf("Error sending appointment reminders: %v", err)
+				}
+			}
+		}()
+	})
+}
+
+// SendDueReminders sends every reminder that is due at the given time and has not been sent yet
+func SendDueReminders(ctx context.Context, notifier Notifier, now time.Time) error {
+	var appointments []models.Appointment
+	if err := initializers.DB.
+		Where("status IN ? AND start_time > ? AND start_time <= ?",
+			[]string{models.AppointmentScheduled, models.AppointmentConfirmed}, now, now.Add(lookahead)).
+		Find(&appointments).Error; err != nil {
+		return err
+	}
+
+	for _, appointment := range appointments {
+		offsets := appointment.ReminderMinutes
+		if len(offsets) == 0 {
+			offsets = DefaultOffsets
+		}
+
+		// Only the closest due reminder is sent; earlier ones that were
+		// missed (e.g. the appointment was booked late) are skipped
+		var due []int
+		for _, offset := range offsets {
+			if !now.Before(appointment.StartTime.Add(-time.Duration(offset) * time.Minute)) {
+				due = append(due, offset)
+			}
+		}
+		if len(due) == 0 {
+			continue
+		}
+		sort.Ints(due)
+
+		// Recording the reminder first makes sure it goes out only once,
+		// even if several workers race on the same appointment. The skipped
+		// offsets are recorded in the same transaction, so a failure leaves
+		// nothing behind and the next tick tries again.
+		recorded := false
+		err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&models.AppointmentReminder{
+					AppointmentID: appointment.ID,
+					OffsetMinutes: due[0],
+					SentAt:        now,
+				})
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			for _, offset := range due[1:] {
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+					Create(&models.AppointmentReminder{AppointmentID: appointment.ID, OffsetMinutes: offset, SentAt: now}).Error; err != nil {
+					return err
+				}
+			}
+			recorded = true
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error recording reminder for appointment %d: %v", appointment.ID, err)
+			continue
+		}
+		if !recorded {
+			continue
+		}
+
+		var patient models.Patient
+		if err := initializers.DB.First(&patient, appointment.PatientID).Error; err != nil {
+			log.Printf("Error fetching patient %d for reminder: %v", appointment.PatientID, err)
+			continue
+		}
+		recipients, err := patientRecipients(patient)
+		if err != nil {
+			log.Printf("Error fetching reminder recipients for patient %d: %v", patient.ID, err)
+			continue
+		}
+
+		if err := notifier.SendAppointmentReminder(ctx, Reminder{
+			Appointment:   appointment,
+			Patient:       patient,
+			Recipients:    recipients,
+			OffsetMinutes: due[0],
+		}); err != nil {
+			log.Printf("Error delivering reminder for appointment %d: %v", appointment.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// patientRecipients returns the patient's own user and the admins of their households
+func patientRecipients(patient models.Patient) ([]models.User, error) {
+	var users []models.User
+	if err := initializers.DB.
+		Where("id = ?", patient.UserID).
+		Or("id IN (?)", initializers.DB.Table("households").
+			Select("households.admin_id").
+			Joins("JOIN household_patients ON household_patients.household_id = households.id").
+			Where("household_patients.patient_id = ? AND households.deleted_at IS NULL", patient.ID)).
+		Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
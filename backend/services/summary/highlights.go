@@ -0,0 +1,178 @@
+package summary
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"my-health/models"
+	"my-health/services/alerts"
+)
+
+// Highlight kinds
+const (
+	HighlightFall            = "fall"
+	HighlightIrregularRhythm = "irregular_rhythm"
+	HighlightBreach          = "breach"
+	HighlightChange          = "change"
+	HighlightCoverage        = "coverage"
+	HighlightNoData          = "no_data"
+)
+
+// Highlight is one plain-language line of the summary
+type Highlight struct {
+	Kind     string `json:"kind"`
+	Severity string `json:"severity"`
+	Metric   string `json:"metric,omitempty"`
+	Text     string `json:"text"`
+}
+
+// changeRule says when a change in a metric's mean is worth mentioning, and
+// which direction is a concern
+type changeRule struct {
+	label string
+	// minChange is the smallest absolute change mentioned; minPercent, if set,
+	// is used instead for metrics whose scale varies a lot between people
+	minChange  float64
+	minPercent float64
+	// concern is +1 when a rise is a concern, -1 for a fall, 0 for neither;
+	// a concerning change of warnAt or more is a warning
+	concern int
+	warnAt  float64
+}
+
+var changeRules = map[string]changeRule{
+	models.MetricHeartRate:        {label: "heart rate", minChange: 5, concern: 1, warnAt: 15},
+	models.MetricSystolicBP:       {label: "systolic pressure", minChange: 8, concern: 1, warnAt: 15},
+	models.MetricDiastolicBP:      {label: "diastolic pressure", minChange: 5, concern: 1, warnAt: 10},
+	models.MetricOxygenSaturation: {label: "SpO2", minChange: 1.5, concern: -1, warnAt: 3},
+	models.MetricWeight:           {label: "weight", minChange: 1, concern: 1, warnAt: 2},
+	models.MetricStepsCount:       {label: "steps", minPercent: 20, concern: -1, warnAt: math.Inf(1)},
+	models.MetricSleepDuration:    {label: "sleep", minChange: 0.5},
+	models.MetricSleepEfficiency:  {label: "sleep efficiency", minChange: 5, concern: -1, warnAt: 10},
+}
+
+// coverageMetrics are the vitals expected on at least half of the days
+var coverageMetrics = map[string]string{
+	models.MetricHeartRate:  "Heart rate",
+	models.MetricSystolicBP: "Blood pressure",
+}
+
+var severityOrder = map[string]int{models.AlertCritical: 0, models.AlertWarning: 1, models.AlertInfo: 2}
+
+func number(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return "1 " + word
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+// Highlights turns a summary into plain-language lines, most serious first
+func Highlights(s Summary, rules []alerts.Rule) []Highlight {
+	this, last := "this "+s.Window.Period, "last "+s.Window.Period
+	highlights := []Highlight{}
+	add := func(kind, severity, metric, text string) {
+		highlights = append(highlights, Highlight{Kind: kind, Severity: severity, Metric: metric, Text: text})
+	}
+
+	if s.DaysWithData == 0 {
+		add(HighlightNoData, models.AlertWarning, "", "No readings were recorded "+this)
+		return highlights
+	}
+
+	if s.Events.Falls > 0 {
+		add(HighlightFall, models.AlertCritical, models.MetricFallDetected,
+			fmt.Sprintf("%s detected %s (%d %s)", plural(s.Events.Falls, "fall"), this, s.Events.PreviousFalls, last))
+	}
+	if s.Events.IrregularRhythm > 0 {
+		add(HighlightIrregularRhythm, models.AlertWarning, models.MetricIrregularRhythm,
+			fmt.Sprintf("Irregular heart rhythm was detected %s %s (%d %s)",
+				plural(s.Events.IrregularRhythm, "time"), this, s.Events.PreviousIrregularRhythm, last))
+	}
+
+	ruleByKey := map[string]alerts.Rule{}
+	for _, rule := range rules {
+		ruleByKey[rule.Key] = rule
+	}
+	for _, breach := range s.Breaches {
+		rule := ruleByKey[breach.RuleKey]
+		label := changeRules[breach.Metric].label
+		direction := "above"
+		if rule.Condition == alerts.ConditionBelow {
+			direction = "below"
+		}
+		unit := models.MetricUnits[breach.Metric]
+		text := fmt.Sprintf("%s was %s the alert level", capitalize(label), direction)
+		if rule.Warning != nil {
+			text += fmt.Sprintf(" of %s %s", number(*rule.Warning), unit)
+		}
+		text += " in " + plural(breach.Warning+breach.Critical, "reading")
+		severity := models.AlertWarning
+		if breach.Critical > 0 {
+			severity = models.AlertCritical
+			text += fmt.Sprintf(", %d of them critical", breach.Critical)
+		}
+		add(HighlightBreach, severity, breach.Metric, text)
+	}
+
+	for _, m := range s.Metrics {
+		rule, ok := changeRules[m.Metric]
+		if !ok || m.Change == nil {
+			continue
+		}
+		change := *m.Change
+		notable := math.Abs(change) >= rule.minChange
+		if rule.minPercent > 0 {
+			notable = m.ChangePercent != nil && math.Abs(*m.ChangePercent) >= rule.minPercent
+		}
+		if !notable || change == 0 {
+			continue
+		}
+
+		verb := "rose"
+		if change < 0 {
+			verb = "fell"
+		}
+		severity := models.AlertInfo
+		if rule.concern != 0 && (change > 0) == (rule.concern > 0) && math.Abs(change) >= rule.warnAt {
+			severity = models.AlertWarning
+		}
+		add(HighlightChange, severity, m.Metric,
+			fmt.Sprintf("Average %s %s from %s to %s %s compared with %s",
+				rule.label, verb, number(*m.PreviousMean), number(*m.Mean), m.Unit, last))
+	}
+
+	for _, m := range s.Metrics {
+		label, ok := coverageMetrics[m.Metric]
+		if !ok {
+			continue
+		}
+		switch {
+		case m.DaysWithData == 0 && m.PreviousMean != nil:
+			add(HighlightCoverage, models.AlertInfo, m.Metric, fmt.Sprintf("%s was not measured %s", label, this))
+		case m.DaysWithData > 0 && m.DaysWithData*2 < s.Window.Days:
+			add(HighlightCoverage, models.AlertInfo, m.Metric,
+				fmt.Sprintf("%s was only measured on %d of %d days", label, m.DaysWithData, s.Window.Days))
+		}
+	}
+
+	sort.SliceStable(highlights, func(i, j int) bool {
+		return severityOrder[highlights[i].Severity] < severityOrder[highlights[j].Severity]
+	})
+	return highlights
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	if s[0] >= 'a' && s[0] <= 'z' {
+		return string(s[0]-'a'+'A') + s[1:]
+	}
+	return s
+}
@@ -0,0 +1,268 @@
+package summary
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"my-health/models"
+	"my-health/services/alerts"
+	"my-health/services/derived"
+	"my-health/services/observations"
+	"my-health/services/timeseries"
+)
+
+// Periods
+const (
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+)
+
+// Window is a report period, [From, To), with the period before it
+type Window struct {
+	Period       string    `json:"period"`
+	From         time.Time `json:"from"`
+	To           time.Time `json:"to"`
+	PreviousFrom time.Time `json:"previous_from"`
+	Days         int       `json:"days"`
+}
+
+// NewWindow returns the week or month ending with the day of end, in loc
+func NewWindow(period string, end time.Time, loc *time.Location) (Window, error) {
+	local := end.In(loc)
+	to := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+	var from, previous time.Time
+	switch period {
+	case PeriodWeek:
+		from = to.AddDate(0, 0, -7)
+		previous = from.AddDate(0, 0, -7)
+	case PeriodMonth:
+		from = to.AddDate(0, -1, 0)
+		previous = from.AddDate(0, -1, 0)
+	default:
+		return Window{}, fmt.Errorf("unknown period %q, expected week or month", period)
+	}
+	days := int(math.Round(to.Sub(from).Hours() / 24))
+	return Window{Period: period, From: from, To: to, PreviousFrom: previous, Days: days}, nil
+}
+
+// MetricSummary holds one metric's statistics for the period. Values are nil
+// when the metric was not measured; for dailyTotals metrics they are of the
+// daily totals, e.g. steps per day.
+type MetricSummary struct {
+	Metric        string   `json:"metric"`
+	Unit          string   `json:"unit"`
+	Mean          *float64 `json:"mean"`
+	Min           *float64 `json:"min"`
+	Max           *float64 `json:"max"`
+	Category      string   `json:"category,omitempty"`
+	Readings      int      `json:"readings"`
+	DaysWithData  int      `json:"days_with_data"`
+	PreviousMean  *float64 `json:"previous_mean"`
+	Change        *float64 `json:"change"`
+	ChangePercent *float64 `json:"change_percent"`
+}
+
+// Breach counts the readings that crossed one alert rule's thresholds
+type Breach struct {
+	RuleKey  string `json:"rule_key"`
+	Metric   string `json:"metric"`
+	Warning  int    `json:"warning"`
+	Critical int    `json:"critical"`
+}
+
+// Events counts event observations in the period and the one before
+type Events struct {
+	Falls                   int `json:"falls"`
+	PreviousFalls           int `json:"previous_falls"`
+	IrregularRhythm         int `json:"irregular_rhythm"`
+	PreviousIrregularRhythm int `json:"previous_irregular_rhythm"`
+}
+
+// Summary is the report for one patient and period
+type Summary struct {
+	Window       Window          `json:"window"`
+	Metrics      []MetricSummary `json:"metrics"`
+	Breaches     []Breach        `json:"breaches"`
+	Events       Events          `json:"events"`
+	DaysWithData int             `json:"days_with_data"`
+	Highlights   []Highlight     `json:"highlights"`
+}
+
+// ForPatient loads the patient's readings and rules and builds the summary
+func ForPatient(db *gorm.DB, patientID uint, window Window, loc *time.Location) (Summary, error) {
+	var list []models.Observation
+	if err := db.Where("patient_id = ? AND status <> ?", patientID, models.ObservationEnteredInError).
+		Where("effective_at >= ? AND effective_at < ?", window.PreviousFrom, window.To).
+		Order("effective_at, id").
+		Find(&list).Error; err != nil {
+		return Summary{}, err
+	}
+	rules, err := alerts.RulesForPatient(db, patientID)
+	if err != nil {
+		return Summary{}, err
+	}
+	var patient models.Patient
+	if err := db.Select("id", "height").First(&patient, patientID).Error; err != nil {
+		return Summary{}, err
+	}
+	return Build(window, list, rules, patient.Height, loc), nil
+}
+
+// dailyTotals are the metrics that add up over a day, such as steps, which
+// devices report per sync. Their statistics are of the daily totals.
+var dailyTotals = map[string]bool{
+	models.MetricStepsCount: true,
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func round(v float64) *float64 {
+	r := math.Round(v*10) / 10
+	return &r
+}
+
+// Build computes the summary from the observations of the period and the one
+// before it, including the derived metrics. It only depends on its input.
+func Build(window Window, list []models.Observation, rules []alerts.Rule, heightCm float64, loc *time.Location) Summary {
+	var current, previous []models.Observation
+	for _, o := range list {
+		if o.EffectiveAt.Before(window.From) {
+			previous = append(previous, o)
+		} else {
+			current = append(current, o)
+		}
+	}
+
+	summary := Summary{Window: window, Metrics: []MetricSummary{}, Breaches: []Breach{}}
+	day := func(t time.Time) string { return t.In(loc).Format("2006-01-02") }
+
+	allDays := map[string]bool{}
+	for _, o := range current {
+		allDays[day(o.EffectiveAt)] = true
+	}
+	summary.DaysWithData = len(allDays)
+
+	value := func(o models.Observation, metric string) (float64, bool) {
+		if derived.IsDerived(metric) {
+			return derived.FromObservation(o, metric, heightCm)
+		}
+		return observations.Value(o, metric)
+	}
+
+	// collect returns the values a metric's statistics are taken over, with
+	// the number of readings and of days they came from
+	collect := func(list []models.Observation, metric string) ([]float64, int, int) {
+		var values []float64
+		totals := map[string]float64{}
+		var order []string
+		for _, o := range list {
+			v, ok := value(o, metric)
+			if !ok {
+				continue
+			}
+			d := day(o.EffectiveAt)
+			if _, seen := totals[d]; !seen {
+				order = append(order, d)
+			}
+			totals[d] += v
+			values = append(values, v)
+		}
+		readings := len(values)
+		if dailyTotals[metric] {
+			values = values[:0]
+			for _, d := range order {
+				values = append(values, totals[d])
+			}
+		}
+		return values, readings, len(totals)
+	}
+
+	for _, metric := range append(timeseries.MetricNames(), derived.Metrics()...) {
+		m := MetricSummary{Metric: metric, Unit: models.MetricUnits[metric]}
+		if derived.IsDerived(metric) {
+			m.Unit = derived.Units[metric]
+		}
+		values, readings, days := collect(current, metric)
+		m.Readings, m.DaysWithData = readings, days
+		if len(values) > 0 {
+			min, max := values[0], values[0]
+			for _, v := range values {
+				min, max = math.Min(min, v), math.Max(max, v)
+			}
+			m.Mean, m.Min, m.Max = round(mean(values)), round(min), round(max)
+			if derived.IsDerived(metric) {
+				m.Category = derived.Classify(metric, *m.Mean)
+			}
+		}
+
+		if values, _, _ := collect(previous, metric); len(values) > 0 {
+			m.PreviousMean = round(mean(values))
+		}
+		if m.Mean != nil && m.PreviousMean != nil {
+			m.Change = round(*m.Mean - *m.PreviousMean)
+			if *m.PreviousMean != 0 {
+				m.ChangePercent = round(*m.Change / *m.PreviousMean * 100)
+			}
+		}
+		summary.Metrics = append(summary.Metrics, m)
+	}
+
+	for _, rule := range rules {
+		if !rule.Enabled || (rule.Condition != alerts.ConditionAbove && rule.Condition != alerts.ConditionBelow) {
+			continue
+		}
+		breach := Breach{RuleKey: rule.Key, Metric: rule.Metric}
+		for _, o := range current {
+			v, ok := observations.Value(o, rule.Metric)
+			if !ok {
+				continue
+			}
+			switch severity, _, breached := rule.Breach(v); {
+			case !breached:
+			case severity == models.AlertCritical:
+				breach.Critical++
+			default:
+				breach.Warning++
+			}
+		}
+		if breach.Warning+breach.Critical > 0 {
+			summary.Breaches = append(summary.Breaches, breach)
+		}
+	}
+	sort.SliceStable(summary.Breaches, func(i, j int) bool {
+		a, b := summary.Breaches[i], summary.Breaches[j]
+		if a.Critical != b.Critical {
+			return a.Critical > b.Critical
+		}
+		return a.Warning+a.Critical > b.Warning+b.Critical
+	})
+
+	count := func(list []models.Observation, metric string) int {
+		n := 0
+		for _, o := range list {
+			if o.Metric == metric && o.Value != 0 {
+				n++
+			}
+		}
+		return n
+	}
+	summary.Events = Events{
+		Falls:                   count(current, models.MetricFallDetected),
+		PreviousFalls:           count(previous, models.MetricFallDetected),
+		IrregularRhythm:         count(current, models.MetricIrregularRhythm),
+		PreviousIrregularRhythm: count(previous, models.MetricIrregularRhythm),
+	}
+
+	summary.Highlights = Highlights(summary, rules)
+	return summary
+}
@@ -0,0 +1,407 @@
+package timeseries
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"my-health/models"
+	"my-health/services/derived"
+)
+
+// Bucket sizes; BucketRaw returns the individual readings and BucketAuto
+// picks a size from the length of the range
+const (
+	BucketRaw   = ""
+	BucketAuto  = "auto"
+	BucketHour  = "hour"
+	BucketDay   = "day"
+	BucketWeek  = "week"
+	BucketMonth = "month"
+)
+
+var bucketDurations = map[string]time.Duration{
+	BucketHour:  time.Hour,
+	BucketDay:   24 * time.Hour,
+	BucketWeek:  7 * 24 * time.Hour,
+	BucketMonth: 30 * 24 * time.Hour,
+}
+
+// Aggregations maps each aggregation function to its SQL; %[1]s is the value
+// column and %[2]s the condition selecting the metric's observations
+var Aggregations = map[string]string{
+	"avg":  "AVG(%[1]s) FILTER (WHERE %[2]s)",
+	"min":  "MIN(%[1]s) FILTER (WHERE %[2]s)",
+	"max":  "MAX(%[1]s) FILTER (WHERE %[2]s)",
+	"last": "(array_agg(%[1]s ORDER BY effective_at DESC) FILTER (WHERE %[2]s))[1]",
+	"p50":  "percentile_cont(0.5) WITHIN GROUP (ORDER BY %[1]s) FILTER (WHERE %[2]s)",
+	"p95":  "percentile_cont(0.95) WITHIN GROUP (ORDER BY %[1]s) FILTER (WHERE %[2]s)",
+}
+
+// rollupAggregations maps the aggregations that can be combined from rollups to
+// their SQL over metric_rollups; %[1]s is the condition selecting the metric
+var rollupAggregations = map[string]string{
+	"avg":  "SUM(sum) FILTER (WHERE %[1]s) / NULLIF(SUM(count) FILTER (WHERE %[1]s), 0)",
+	"min":  "MIN(min) FILTER (WHERE %[1]s)",
+	"max":  "MAX(max) FILTER (WHERE %[1]s)",
+	"last": "(array_agg(last ORDER BY last_at DESC) FILTER (WHERE %[1]s))[1]",
+}
+
+// column returns the observation metric and value expression a query metric
+// reads; systolic and diastolic pressure are the two values of blood_pressure,
+// and derived metrics are computed from the stored ones
+func column(metric string, q Query) (string, string) {
+	if derived.IsDerived(metric) {
+		name, expr, _ := derived.Expression(metric, q.HeightCm)
+		return name, expr
+	}
+	switch metric {
+	case models.MetricSystolicBP:
+		return models.MetricBloodPressure, "value"
+	case models.MetricDiastolicBP:
+		return models.MetricBloodPressure, "value2"
+	}
+	return metric, "value"
+}
+
+// RawValue is the series key used for individual readings
+const RawValue = "value"
+
+// MaxPoints bounds the length of the returned arrays
+const MaxPoints = 5000
+
+// Query selects metrics of one patient in [From, To), optionally bucketed and aggregated
+type Query struct {
+	PatientID    uint
+	From         time.Time
+	To           time.Time
+	Metrics      []string
+	Bucket       string
+	Aggregations []string
+	// Location decides where day, week and month buckets start
+	Location *time.Location
+	// HeightCm is the patient's height, needed for BMI
+	HeightCm float64
+}
+
+// Result holds the data as columns: Series[metric][aggregation][i] is the value
+// for Time[i], or nil where the metric was not measured in that bucket
+type Result struct {
+	Time   []time.Time                      `json:"time"`
+	Series map[string]map[string][]*float64 `json:"series"`
+	Units  map[string]string                `json:"units"`
+	// Categories classifies the values of derived metrics, e.g. the BMI class,
+	// with "" where the value is missing
+	Categories map[string]map[string][]string `json:"categories,omitempty"`
+	// Truncated is set when raw readings were cut off at MaxPoints
+	Truncated bool `json:"truncated"`
+}
+
+// Validate checks the query and fills in defaults
+func (q *Query) Validate() error {
+	if !q.To.After(q.From) {
+		return errors.New("to must be after from")
+	}
+	if len(q.Metrics) == 0 {
+		q.Metrics = MetricNames()
+	}
+	q.Metrics = unique(q.Metrics)
+	for _, metric := range q.Metrics {
+		if _, ok := models.MetricUnits[metric]; !ok && !derived.IsDerived(metric) {
+			return fmt.Errorf("unknown metric %q", metric)
+		}
+	}
+
+	if q.Bucket == BucketAuto {
+		q.Bucket = autoBucket(q.To.Sub(q.From))
+	}
+	if q.Bucket == BucketRaw {
+		q.Aggregations = []string{RawValue}
+		return nil
+	}
+	size, ok := bucketDurations[q.Bucket]
+	if !ok {
+		return fmt.Errorf("unknown bucket %q, expected hour, day, week, month or auto", q.Bucket)
+	}
+	if points := q.To.Sub(q.From) / size; points > MaxPoints {
+		return fmt.Errorf("range has %d %s buckets, at most %d are allowed; use a larger bucket", points, q.Bucket, MaxPoints)
+	}
+
+	if len(q.Aggregations) == 0 {
+		q.Aggregations = []string{"avg"}
+	}
+	q.Aggregations = unique(q.Aggregations)
+	for _, agg := range q.Aggregations {
+		if _, ok := Aggregations[agg]; !ok {
+			return fmt.Errorf("unknown aggregation %q, expected avg, min, max, last, p50 or p95", agg)
+		}
+	}
+	if q.Location == nil {
+		q.Location = time.UTC
+	}
+	return nil
+}
+
+// autoBucket picks the bucket for a range: the readings themselves for a couple
+// of days, then hours, days and months as the range grows
+func autoBucket(length time.Duration) string {
+	switch {
+	case length <= 2*24*time.Hour:
+		return BucketRaw
+	case length <= 31*24*time.Hour:
+		return BucketHour
+	case length <= 2*365*24*time.Hour:
+		return BucketDay
+	}
+	return BucketMonth
+}
+
+func unique(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// MetricNames lists the stored metrics queried by default, in a stable order;
+// the derived metrics in derived.Metrics can be asked for by name
+func MetricNames() []string {
+	return []string{
+		models.MetricHeartRate,
+		models.MetricSystolicBP,
+		models.MetricDiastolicBP,
+		models.MetricOxygenSaturation,
+		models.MetricWeight,
+		models.MetricStepsCount,
+		models.MetricSleepDuration,
+		models.MetricRespirationRate,
+		models.MetricBodyTemperature,
+	}
+}
+
+// Run executes a validated query. Bucketed queries are answered from the
+// rollups when they can be, see resolution, and from the observations otherwise.
+func Run(db *gorm.DB, q Query) (Result, error) {
+	var sqlText string
+	var args []interface{}
+	if res := resolution(q); res != "" {
+		if err := FlushPatient(db, q.PatientID); err != nil {
+			return Result{}, err
+		}
+		sqlText, args = rollupSQL(q, res)
+	} else {
+		sqlText, args = observationSQL(q)
+	}
+
+	rows, err := db.Raw(sqlText, args...).Rows()
+	if err != nil {
+		return Result{}, err
+	}
+	defer rows.Close()
+
+	result := Result{
+		Time:   []time.Time{},
+		Series: make(map[string]map[string][]*float64, len(q.Metrics)),
+		Units:  make(map[string]string, len(q.Metrics)),
+	}
+	for _, metric := range q.Metrics {
+		result.Units[metric] = models.MetricUnits[metric]
+		if derived.IsDerived(metric) {
+			result.Units[metric] = derived.Units[metric]
+		}
+		result.Series[metric] = make(map[string][]*float64, len(q.Aggregations))
+		for _, agg := range q.Aggregations {
+			result.Series[metric][agg] = []*float64{}
+		}
+	}
+
+	var timestamp time.Time
+	values := make([]sql.NullFloat64, len(q.Metrics)*len(q.Aggregations))
+	dest := make([]interface{}, 0, len(values)+1)
+	dest = append(dest, &timestamp)
+	for i := range values {
+		dest = append(dest, &values[i])
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return Result{}, err
+		}
+		result.Time = append(result.Time, timestamp)
+
+		i := 0
+		for _, metric := range q.Metrics {
+			for _, agg := range q.Aggregations {
+				var value *float64
+				if values[i].Valid {
+					v := values[i].Float64
+					value = &v
+				}
+				result.Series[metric][agg] = append(result.Series[metric][agg], value)
+				i++
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Result{}, err
+	}
+
+	result.Truncated = q.Bucket == BucketRaw && len(result.Time) == MaxPoints
+	classify(&result, q)
+	return result, nil
+}
+
+// observationSQL builds the query reading the observations themselves
+func observationSQL(q Query) (string, []interface{}) {
+	// Metric and aggregation names are checked against fixed lists in Validate,
+	// so they are safe to format into the SQL
+	aggregations := q.Aggregations
+	if q.Bucket == BucketRaw {
+		// Each raw reading is one group, holding at most one value per metric
+		aggregations = []string{"max"}
+	}
+
+	var columns, observed []string
+	for _, metric := range q.Metrics {
+		name, value := column(metric, q)
+		condition := fmt.Sprintf("metric = '%s'", name)
+		observed = append(observed, "'"+name+"'")
+		for _, agg := range aggregations {
+			columns = append(columns, fmt.Sprintf(Aggregations[agg], value, condition)+"::float8")
+		}
+	}
+
+	where := fmt.Sprintf(`WHERE patient_id = ? AND deleted_at IS NULL AND status <> '%s'
+		AND effective_at >= ? AND effective_at < ? AND metric IN (%s)`,
+		models.ObservationEnteredInError, strings.Join(observed, ", "))
+	if q.Bucket == BucketRaw {
+		sqlText := fmt.Sprintf(`SELECT effective_at, %s FROM observations %s
+			GROUP BY effective_at, source, device_id ORDER BY effective_at LIMIT %d`,
+			strings.Join(columns, ", "), where, MaxPoints)
+		return sqlText, []interface{}{q.PatientID, q.From, q.To}
+	}
+	tz := q.Location.String()
+	sqlText := fmt.Sprintf(`SELECT date_trunc('%s', effective_at AT TIME ZONE ?) AT TIME ZONE ?, %s
+		FROM observations %s GROUP BY 1 ORDER BY 1`,
+		q.Bucket, strings.Join(columns, ", "), where)
+	return sqlText, []interface{}{tz, tz, q.PatientID, q.From, q.To}
+}
+
+// resolution returns the rollup resolution that can answer the query, or ""
+// when the observations have to be read: raw readings, percentiles and derived
+// metrics need the individual values, and zones whose offset is not whole
+// hours don't line up with the hourly rollups. Day and month rollups are UTC,
+// so buckets in other zones are combined from hours.
+func resolution(q Query) string {
+	if q.Bucket == BucketRaw {
+		return ""
+	}
+	for _, agg := range q.Aggregations {
+		if _, ok := rollupAggregations[agg]; !ok {
+			return ""
+		}
+	}
+	for _, metric := range q.Metrics {
+		if derived.IsDerived(metric) {
+			return ""
+		}
+	}
+	for _, t := range []time.Time{q.From, q.To} {
+		if _, offset := t.In(q.Location).Zone(); offset%3600 != 0 {
+			return ""
+		}
+	}
+
+	utc := q.Location == time.UTC || q.Location.String() == "UTC"
+	res := models.RollupHour
+	switch {
+	case q.Bucket == BucketMonth && utc:
+		res = models.RollupMonth
+	case (q.Bucket == BucketDay || q.Bucket == BucketWeek) && utc:
+		res = models.RollupDay
+	}
+
+	// A rollup cannot be split, so From has to fall on a rollup boundary for
+	// the rollups to hold the same readings as the observations; otherwise a
+	// finer resolution, or the observations, answer the query
+	for !startsRollup(q.From, res) {
+		switch res {
+		case models.RollupMonth:
+			res = models.RollupDay
+		case models.RollupDay:
+			res = models.RollupHour
+		default:
+			return ""
+		}
+	}
+	return res
+}
+
+// startsRollup reports whether t is the start of a rollup of the resolution.
+// Rollups are UTC hours, days and months.
+func startsRollup(t time.Time, res string) bool {
+	u := t.UTC()
+	hour := u.Minute() == 0 && u.Second() == 0 && u.Nanosecond() == 0
+	switch res {
+	case models.RollupMonth:
+		return hour && u.Hour() == 0 && u.Day() == 1
+	case models.RollupDay:
+		return hour && u.Hour() == 0
+	}
+	return hour
+}
+
+// rollupSQL builds the query combining rollups of the given resolution into
+// the query's buckets. resolution makes sure From starts a rollup; a range
+// that ends inside one takes in all of it.
+func rollupSQL(q Query, res string) (string, []interface{}) {
+	var columns, names []string
+	for _, metric := range q.Metrics {
+		condition := fmt.Sprintf("metric = '%s'", metric)
+		names = append(names, "'"+metric+"'")
+		for _, agg := range q.Aggregations {
+			columns = append(columns, fmt.Sprintf(rollupAggregations[agg], condition)+"::float8")
+		}
+	}
+
+	tz := q.Location.String()
+	sqlText := fmt.Sprintf(`SELECT date_trunc('%s', bucket_start AT TIME ZONE ?) AT TIME ZONE ?, %s
+		FROM metric_rollups
+		WHERE patient_id = ? AND resolution = ? AND metric IN (%s)
+			AND bucket_start >= ? AND bucket_start < ?
+		GROUP BY 1 ORDER BY 1`,
+		q.Bucket, strings.Join(columns, ", "), strings.Join(names, ", "))
+	return sqlText, []interface{}{tz, tz, q.PatientID, res, q.From, q.To}
+}
+
+// classify fills in the categories of the derived metrics in the result
+func classify(result *Result, q Query) {
+	for _, metric := range q.Metrics {
+		if !derived.IsDerived(metric) {
+			continue
+		}
+		if result.Categories == nil {
+			result.Categories = map[string]map[string][]string{}
+		}
+		result.Categories[metric] = make(map[string][]string, len(q.Aggregations))
+		for _, agg := range q.Aggregations {
+			values := result.Series[metric][agg]
+			categories := make([]string, len(values))
+			for i, v := range values {
+				if v != nil {
+					categories[i] = derived.Classify(metric, *v)
+				}
+			}
+			result.Categories[metric][agg] = categories
+		}
+	}
+}
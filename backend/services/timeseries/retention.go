@@ -0,0 +1,127 @@
+package timeseries
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"my-health/models"
+)
+
+// pruneBatch bounds the observations removed per transaction
+var pruneBatch = 5000
+
+// Retention decides how long raw observations are kept. Older readings are
+// moved to observation_archives, or deleted when Archive is off; their
+// rollups are always kept.
+type Retention struct {
+	// Months of raw readings to keep; 0 keeps them forever
+	Months  int
+	Archive bool
+}
+
+// RetentionFromEnv reads the policy from METRIC_RETENTION_MONTHS and
+// METRIC_RETENTION_MODE ("archive", the default, or "delete")
+func RetentionFromEnv() Retention {
+	policy := Retention{Archive: true}
+	if value := os.Getenv("METRIC_RETENTION_MONTHS"); value != "" {
+		months, err := strconv.Atoi(value)
+		if err != nil || months < 0 {
+			log.Printf("Ignoring invalid METRIC_RETENTION_MONTHS %q", value)
+		} else {
+			policy.Months = months
+		}
+	}
+	switch mode := os.Getenv("METRIC_RETENTION_MODE"); mode {
+	case "", "archive":
+	case "delete":
+		policy.Archive = false
+	default:
+		log.Printf("Ignoring invalid METRIC_RETENTION_MODE %q, archiving", mode)
+	}
+	return policy
+}
+
+// Enabled reports whether raw readings expire
+func (r Retention) Enabled() bool {
+	return r.Months > 0
+}
+
+// Cutoff returns the start of the oldest UTC month whose raw readings are
+// kept, or the zero time if they are kept forever. Cutting at a month start
+// keeps every rollup bucket either wholly raw or wholly pruned.
+func (r Retention) Cutoff(now time.Time) time.Time {
+	if !r.Enabled() {
+		return time.Time{}
+	}
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -r.Months, 0)
+}
+
+// RetentionCutoff returns the cutoff of the policy the rollup worker runs
+// with; readings before it are not rolled up and should not be stored
+func RetentionCutoff(now time.Time) time.Time {
+	retentionMu.RLock()
+	defer retentionMu.RUnlock()
+	return retention.Cutoff(now)
+}
+
+// Prune removes the observations older than the retention cutoff and returns
+// how many it removed. Rollups are brought up to date first so no reading is
+// lost from them. Observations a care note points at are kept.
+func Prune(db *gorm.DB, r Retention, now time.Time) (int64, error) {
+	cutoff := r.Cutoff(now)
+	if cutoff.IsZero() {
+		return 0, nil
+	}
+
+	if err := Flush(db); err != nil {
+		return 0, err
+	}
+	var pending int64
+	if err := db.Model(&models.RollupDirty{}).Where("hour < ?", cutoff).Count(&pending).Error; err != nil {
+		return 0, err
+	}
+	if pending > 0 {
+		return 0, fmt.Errorf("%d hours before %s are waiting for rollups", pending, cutoff.Format("2006-01-02"))
+	}
+
+	var removed int64
+	for {
+		var ids []uint
+		if err := db.Unscoped().Model(&models.Observation{}).
+			Where("effective_at < ?", cutoff).
+			Where("NOT EXISTS (SELECT 1 FROM care_notes cn WHERE cn.observation_id = observations.id)").
+			Order("id").
+			Limit(pruneBatch).
+			Pluck("id", &ids).Error; err != nil {
+			return removed, err
+		}
+		if len(ids) == 0 {
+			return removed, nil
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if r.Archive {
+				if err := tx.Exec(`INSERT INTO observation_archives
+					(id, created_at, updated_at, deleted_at, patient_id, metric, value, value2, unit, components,
+						effective_at, source, device_id, status, legacy_metrics_id, import_batch_id, archived_at)
+					SELECT id, created_at, updated_at, deleted_at, patient_id, metric, value, value2, unit, components,
+						effective_at, source, device_id, status, legacy_metrics_id, import_batch_id, ?
+					FROM observations WHERE id IN ?
+					ON CONFLICT (id) DO NOTHING`, now, ids).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Unscoped().Where("id IN ?", ids).Delete(&models.Observation{}).Error
+		})
+		if err != nil {
+			return removed, err
+		}
+		removed += int64(len(ids))
+	}
+}
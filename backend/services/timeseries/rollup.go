@@ -0,0 +1,235 @@
+package timeseries
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"my-health/models"
+)
+
+var (
+	rollupInterval = time.Minute
+	pruneInterval  = 24 * time.Hour
+	rollupBatch    = 500
+
+	// rollupLockKey namespaces the per-patient advisory lock held while a
+	// patient's rollups are rebuilt
+	rollupLockKey = 4701
+
+	rollupOnce sync.Once
+
+	retentionMu sync.RWMutex
+	retention   Retention
+)
+
+// MarkDirty records the hours touched by newly stored observations so the
+// rollup worker rebuilds them. A mark that is being flushed waits for the
+// flush to finish and is then stored again, so no reading is missed.
+func MarkDirty(db *gorm.DB, list []models.Observation) error {
+	seen := map[models.RollupDirty]bool{}
+	var marks []models.RollupDirty
+	for _, o := range list {
+		mark := models.RollupDirty{PatientID: o.PatientID, Hour: o.EffectiveAt.UTC().Truncate(time.Hour)}
+		if !seen[mark] {
+			seen[mark] = true
+			marks = append(marks, mark)
+		}
+	}
+	if len(marks) == 0 {
+		return nil
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "patient_id"}, {Name: "hour"}},
+		DoUpdates: clause.AssignmentColumns([]string{"created_at"}),
+	}).Create(&marks).Error
+}
+
+// Backfill marks every hour that has readings but no hourly rollups, so the
+// worker builds rollups for readings stored before rollups existed
+func Backfill(db *gorm.DB) error {
+	return db.Exec(`INSERT INTO rollup_dirty (patient_id, hour, created_at)
+		SELECT DISTINCT o.patient_id, date_trunc('hour', o.effective_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', now()
+		FROM observations o
+		WHERE o.deleted_at IS NULL AND o.status <> ? AND NOT EXISTS (
+			SELECT 1 FROM metric_rollups r
+			WHERE r.patient_id = o.patient_id AND r.resolution = ?
+				AND r.bucket_start = date_trunc('hour', o.effective_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+		)
+		ON CONFLICT DO NOTHING`,
+		models.ObservationEnteredInError, models.RollupHour).Error
+}
+
+// StartRollupWorker starts the background worker that keeps the rollups up to
+// date and applies the retention policy once a day
+func StartRollupWorker(db *gorm.DB, policy Retention) {
+	rollupOnce.Do(func() {
+		retentionMu.Lock()
+		retention = policy
+		retentionMu.Unlock()
+
+		go func() {
+			if err := Backfill(db); err != nil {
+				log.Printf("Error marking readings for rollup: %v", err)
+			}
+
+			ticker := time.NewTicker(rollupInterval)
+			defer ticker.Stop()
+
+			var pruned time.Time
+			for {
+				if err := Flush(db); err != nil {
+					log.Printf("Error updating metric rollups: %v", err)
+				}
+				if policy.Enabled() && time.Since(pruned) >= pruneInterval {
+					count, err := Prune(db, policy, time.Now())
+					if err != nil {
+						log.Printf("Error applying metric retention: %v", err)
+					} else {
+						pruned = time.Now()
+						if count > 0 {
+							log.Printf("Retention removed %d observations", count)
+						}
+					}
+				}
+				<-ticker.C
+			}
+		}()
+	})
+}
+
+// Flush rebuilds the rollups of every dirty hour. Claiming with SKIP LOCKED
+// lets several servers share the work.
+func Flush(db *gorm.DB) error {
+	for {
+		count, err := flushBatch(db, 0)
+		if err != nil || count < rollupBatch {
+			return err
+		}
+	}
+}
+
+// FlushPatient rebuilds the patient's dirty hours, waiting for a flush already
+// in progress, so a query that follows sees all stored readings
+func FlushPatient(db *gorm.DB, patientID uint) error {
+	for {
+		count, err := flushBatch(db, patientID)
+		if err != nil || count < rollupBatch {
+			return err
+		}
+	}
+}
+
+// flushBatch claims up to rollupBatch dirty hours, of one patient if patientID
+// is set, rebuilds their rollups and clears the marks. It returns the number
+// of hours claimed.
+func flushBatch(db *gorm.DB, patientID uint) (int, error) {
+	var count int
+	err := db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Order("patient_id, hour").Limit(rollupBatch)
+		if patientID != 0 {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE"}).Where("patient_id = ?", patientID)
+		} else {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+		var marks []models.RollupDirty
+		if err := query.Find(&marks).Error; err != nil {
+			return err
+		}
+		count = len(marks)
+
+		hours := map[uint][]time.Time{}
+		for _, mark := range marks {
+			hours[mark.PatientID] = append(hours[mark.PatientID], mark.Hour)
+		}
+		for id, list := range hours {
+			if err := rebuild(tx, id, list); err != nil {
+				return fmt.Errorf("patient %d: %w", id, err)
+			}
+			if err := tx.Where("patient_id = ? AND hour IN ?", id, list).
+				Delete(&models.RollupDirty{}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+// rebuild recomputes the patient's hourly rollups covering the given hours
+// from the observations, then the daily and monthly rollups that contain them
+// from the hourly ones. Hours before the retention cutoff are left alone: their
+// readings may already be gone.
+func rebuild(tx *gorm.DB, patientID uint, hours []time.Time) error {
+	cutoff := RetentionCutoff(time.Now())
+
+	var kept []time.Time
+	for _, hour := range hours {
+		if !hour.Before(cutoff) {
+			kept = append(kept, hour.UTC())
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].Before(kept[j]) })
+	first, last := kept[0], kept[len(kept)-1]
+
+	// Rebuilding a day or month reads the hours other transactions may be
+	// writing, so rebuilds of one patient run one at a time
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?::int, ?::int)", rollupLockKey, patientID).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Where("patient_id = ? AND resolution = ? AND bucket_start >= ? AND bucket_start <= ?",
+		patientID, models.RollupHour, first, last).Delete(&models.MetricRollup{}).Error; err != nil {
+		return err
+	}
+	for _, metric := range MetricNames() {
+		name, value := column(metric, Query{})
+		if err := tx.Exec(fmt.Sprintf(`INSERT INTO metric_rollups
+			(patient_id, metric, resolution, bucket_start, count, sum, min, max, last, last_at, updated_at)
+			SELECT patient_id, ?, ?, date_trunc('hour', effective_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+				COUNT(*), SUM(%[1]s), MIN(%[1]s), MAX(%[1]s),
+				(array_agg(%[1]s ORDER BY effective_at DESC, id DESC))[1], MAX(effective_at), now()
+			FROM observations
+			WHERE patient_id = ? AND metric = ? AND deleted_at IS NULL AND status <> ? AND %[1]s IS NOT NULL
+				AND effective_at >= ? AND effective_at < ?
+			GROUP BY patient_id, 4`, value),
+			metric, models.RollupHour, patientID, name, models.ObservationEnteredInError,
+			first, last.Add(time.Hour)).Error; err != nil {
+			return err
+		}
+	}
+
+	dayFirst, dayLast := first.Truncate(24*time.Hour), last.Truncate(24*time.Hour)
+	if err := rollUp(tx, patientID, models.RollupHour, models.RollupDay, dayFirst, dayLast, dayLast.AddDate(0, 0, 1)); err != nil {
+		return err
+	}
+	monthFirst := time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, time.UTC)
+	monthLast := time.Date(last.Year(), last.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return rollUp(tx, patientID, models.RollupDay, models.RollupMonth, monthFirst, monthLast, monthLast.AddDate(0, 1, 0))
+}
+
+// rollUp replaces the patient's coarser rollups starting in [first, last] with
+// ones combined from the finer rollups in [first, end)
+func rollUp(tx *gorm.DB, patientID uint, finer, coarser string, first, last, end time.Time) error {
+	if err := tx.Where("patient_id = ? AND resolution = ? AND bucket_start >= ? AND bucket_start <= ?",
+		patientID, coarser, first, last).Delete(&models.MetricRollup{}).Error; err != nil {
+		return err
+	}
+	return tx.Exec(fmt.Sprintf(`INSERT INTO metric_rollups
+		(patient_id, metric, resolution, bucket_start, count, sum, min, max, last, last_at, updated_at)
+		SELECT patient_id, metric, ?, date_trunc('%s', bucket_start AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+			SUM(count), SUM(sum), MIN(min), MAX(max),
+			(array_agg(last ORDER BY last_at DESC))[1], MAX(last_at), now()
+		FROM metric_rollups
+		WHERE patient_id = ? AND resolution = ? AND bucket_start >= ? AND bucket_start < ?
+		GROUP BY patient_id, metric, 4`, coarser),
+		coarser, patientID, finer, first, end).Error
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+var ErrInvalidPhoneNumber = errors.New("invalid phone number")
+
+// NormalizePhoneNumber converts a phone number to E.164 format (+<country code><number>).
+// Numbers without an international prefix are assumed to belong to the country
+// configured in DEFAULT_COUNTRY_CODE (e.g. "30" for Greece).
+func NormalizePhoneNumber(raw string) (string, error) {
+	number := strings.TrimSpace(raw)
+	if number == "" {
+		return "", ErrInvalidPhoneNumber
+	}
+
+	international := false
+	switch {
+	case strings.HasPrefix(number, "+"):
+		international = true
+		number = number[1:]
+	case strings.HasPrefix(number, "00"):
+		international = true
+		number = number[2:]
+	}
+
+	var digits strings.Builder
+	for _, r := range number {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')' || r == '/':
+			// Common separators are dropped
+		default:
+			return "", ErrInvalidPhoneNumber
+		}
+	}
+
+	result := digits.String()
+	if !international {
+		countryCode := strings.TrimPrefix(os.Getenv("DEFAULT_COUNTRY_CODE"), "+")
+		if countryCode == "" {
+			return "", errors.New("phone number must include a country code")
+		}
+		// Drop a national trunk prefix such as the leading 0 in 020 7946 0018
+		result = countryCode + strings.TrimPrefix(result, "0")
+	}
+
+	// E.164 allows at most 15 digits and country codes never start with 0
+	if len(result) < 8 || len(result) > 15 || result[0] == '0' {
+		return "", ErrInvalidPhoneNumber
+	}
+
+	return "+" + result, nil
+}
@@ -0,0 +1,149 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"my-health/utils"
+)
+
+// Length limits for free-text patient fields
+const (
+	MaxNameLength         = 100
+	MaxAddressLength      = 500
+	MaxRecordNumberLength = 100
+	MaxClinicalTextLength = 5000
+	MaxRelationshipLength = 50
+)
+
+// Physiologic ranges accepted for profile and metric input
+const (
+	MinHeightCm = 50.0
+	MaxHeightCm = 250.0
+	MinWeightKg = 20.0
+	MaxWeightKg = 300.0
+	MaxAgeYears = 120
+)
+
+var bloodTypes = map[string]string{
+	"A+": "A+", "A-": "A-",
+	"B+": "B+", "B-": "B-",
+	"AB+": "AB+", "AB-": "AB-",
+	"O+": "O+", "O-": "O-",
+	"0+": "O+", "0-": "O-", // zero typed instead of the letter O
+}
+
+var genders = map[string]bool{
+	"male":              true,
+	"female":            true,
+	"other":             true,
+	"prefer_not_to_say": true,
+}
+
+// BloodType normalises a blood type such as "ab +" to "AB+"
+func BloodType(value string) (string, bool) {
+	normalized := strings.ToUpper(strings.ReplaceAll(value, " ", ""))
+	normalized = strings.NewReplacer("POS", "+", "NEG", "-").Replace(normalized)
+	bloodType, ok := bloodTypes[normalized]
+	return bloodType, ok
+}
+
+// Gender normalises a gender such as "Female" to "female"
+func Gender(value string) (string, bool) {
+	normalized := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(value)), " ", "_")
+	return normalized, genders[normalized]
+}
+
+// DateOfBirth checks that a date of birth is in the past and gives a plausible age
+func DateOfBirth(dob, now time.Time) error {
+	if dob.After(now) {
+		return fmt.Errorf("must be in the past")
+	}
+	if dob.Before(now.AddDate(-MaxAgeYears, 0, 0)) {
+		return fmt.Errorf("gives an age over %d years", MaxAgeYears)
+	}
+	return nil
+}
+
+// Height records an error for a non-zero height outside the physiologic range
+func (e Errors) Height(field string, cm float64) {
+	if cm != 0 && (cm < MinHeightCm || cm > MaxHeightCm) {
+		e.Add(field, fmt.Sprintf("must be between %.0f and %.0f cm", MinHeightCm, MaxHeightCm))
+	}
+}
+
+// Weight records an error for a non-zero weight outside the physiologic range
+func (e Errors) Weight(field string, kg float64) {
+	if kg != 0 && (kg < MinWeightKg || kg > MaxWeightKg) {
+		e.Add(field, fmt.Sprintf("must be between %.0f and %.0f kg", MinWeightKg, MaxWeightKg))
+	}
+}
+
+// HeartRate records an error for a non-zero heart rate outside 25-250 bpm
+func (e Errors) HeartRate(field string, bpm int) {
+	if bpm != 0 && (bpm < 25 || bpm > 250) {
+		e.Add(field, "must be between 25 and 250 bpm")
+	}
+}
+
+// OxygenSaturation records an error for a non-zero SpO2 outside 50-100 %
+func (e Errors) OxygenSaturation(field string, percent float64) {
+	if percent != 0 && (percent < 50 || percent > 100) {
+		e.Add(field, "must be between 50 and 100 %")
+	}
+}
+
+// BloodPressure checks that systolic and diastolic values are within normal range
+func BloodPressure(systolic, diastolic int) bool {
+	return systolic >= 70 && systolic <= 190 && diastolic >= 40 && diastolic <= 130 && systolic > diastolic
+}
+
+// Phone normalises a phone number to E.164, recording an error if it is invalid.
+// Empty numbers are left empty.
+func (e Errors) Phone(field, value string) string {
+	if strings.TrimSpace(value) == "" {
+		return ""
+	}
+	number, err := utils.NormalizePhoneNumber(value)
+	if err != nil {
+		e.Add(field, "must be a valid phone number in international format, e.g. +306912345678")
+		return value
+	}
+	return number
+}
+
+// MeasuredBloodPressure accepts the wider range a cuff can actually report, so
+// that hypertensive crises and hypotension reach the alerting rather than being
+// rejected as typos
+func MeasuredBloodPressure(systolic, diastolic int) bool {
+	return systolic >= 50 && systolic <= 300 && diastolic >= 20 && diastolic <= 200 && systolic > diastolic
+}
+
+// RespirationRate records an error for a non-zero respiration rate outside 4-60 breaths/min
+func (e Errors) RespirationRate(field string, rate int) {
+	if rate != 0 && (rate < 4 || rate > 60) {
+		e.Add(field, "must be between 4 and 60 breaths/min")
+	}
+}
+
+// BodyTemperature records an error for a non-zero temperature outside 30-45 °C
+func (e Errors) BodyTemperature(field string, celsius float64) {
+	if celsius != 0 && (celsius < 30 || celsius > 45) {
+		e.Add(field, "must be between 30 and 45 °C")
+	}
+}
+
+// StepsCount records an error for a step count outside 0-100000
+func (e Errors) StepsCount(field string, steps int) {
+	if steps < 0 || steps > 100000 {
+		e.Add(field, "must be between 0 and 100000 steps")
+	}
+}
+
+// SleepDuration records an error for a sleep duration outside 0-24 hours
+func (e Errors) SleepDuration(field string, hours float64) {
+	if hours < 0 || hours > 24 {
+		e.Add(field, "must be between 0 and 24 hours")
+	}
+}
@@ -0,0 +1,51 @@
+package validation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Errors collects validation messages keyed by request field name, e.g.
+// "bloodType" or "emergencyContact.phoneNumber". Only the first message per
+// field is kept.
+type Errors map[string]string
+
+func (e Errors) Add(field, message string) {
+	if _, exists := e[field]; !exists {
+		e[field] = message
+	}
+}
+
+func (e Errors) Any() bool {
+	return len(e) > 0
+}
+
+func (e Errors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	messages := make([]string, 0, len(fields))
+	for _, field := range fields {
+		messages = append(messages, field+": "+e[field])
+	}
+	return strings.Join(messages, "; ")
+}
+
+// MaxLength records an error if the value is longer than max characters
+func (e Errors) MaxLength(field, value string, max int) {
+	if utf8.RuneCountInString(value) > max {
+		e.Add(field, fmt.Sprintf("must be at most %d characters", max))
+	}
+}
+
+// Required records an error if the value is blank
+func (e Errors) Required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		e.Add(field, "is required")
+	}
+}
@@ -16,6 +16,7 @@ import VisibilityIcon from '@mui/icons-material/Visibility';
 import LocalHospitalIcon from '@mui/icons-material/LocalHospital';
 import EmergencyShareIcon from '@mui/icons-material/EmergencyShare';
 import SettingsIcon from '@mui/icons-material/Settings';
+import News2Score, { News2 } from './components/News2Score';
 
 interface AdminDashboardProps {
     adminId: string;
@@ -37,6 +38,7 @@ interface Patient {
         relationship: string;
         phoneNumber: string;
     };
+    news2?: News2 | null;
 }
 
 const AdminDashboard: React.FC<AdminDashboardProps> = ({ adminId }) => {
@@ -132,7 +134,7 @@ const AdminDashboard: React.FC<AdminDashboardProps> = ({ adminId }) => {
                                                 {patient.name} {patient.surname}
                                             </Typography>
                                         </Grid>
-                                        <Grid item xs={3}>
+                                        <Grid item xs={2}>
                                             <Chip
                                                 label={`Blood Type: ${patient.bloodType || 'N/A'}`}
                                                 color="primary"
@@ -140,6 +142,9 @@ const AdminDashboard: React.FC<AdminDashboardProps> = ({ adminId }) => {
                                             />
                                         </Grid>
                                         <Grid item xs={3}>
+                                            <News2Score news2={patient.news2} />
+                                        </Grid>
+                                        <Grid item xs={1}>
                                             <Typography variant="body2" color="textSecondary">
                                                 ID: {patient.id}
                                             </Typography>
@@ -43,6 +43,7 @@ import {
     Bloodtype as BloodtypeIcon,
     Refresh as RefreshIcon,
 } from '@mui/icons-material';
+import News2Score, { News2 } from './components/News2Score';
 
 interface HealthMetric {
     date: string;
@@ -89,6 +90,9 @@ interface PatientData {
         bloodPressure: string;
         lastCheckup: string;
     };
+    news2?: News2 & {
+        parameters: { name: string; assumed?: boolean }[];
+    };
 }
 
 interface TabPanelProps {
@@ -263,6 +267,16 @@ export default function PatientDetails() {
         fetchPatientData();
     }, [fetchPatientData]);
 
+    // The score only means something once at least one vital has a recent reading
+    const currentNews2 = () => {
+        const news2 = patientData?.news2;
+        if (!news2) {
+            return null;
+        }
+        const measured = news2.parameters.filter((parameter) => !parameter.assumed).length;
+        return (news2.missing?.length ?? 0) < measured ? news2 : null;
+    };
+
     const handleEdit = () => {
         navigate(`/patient/edit/${patientId}`);
     };
@@ -319,6 +333,7 @@ export default function PatientDetails() {
                                 icon={<PersonIcon />}
                                 label={`Age: ${calculateAge(patientData.dateOfBirth)}`}
                             />
+                            <News2Score news2={currentNews2()} />
                         </Box>
                     </Box>
                     <Box>
@@ -220,7 +220,12 @@ export default function PatientEditPage() {
             }, 1500);
         } catch (err) {
             console.error('Failed to update patient data:', err);
-            setError('Failed to update patient data. Please try again.');
+            const fields = axios.isAxiosError(err) ? err.response?.data?.fields : undefined;
+            if (fields) {
+                setError(Object.entries(fields).map(([field, message]) => `${field} ${message}`).join('; '));
+            } else {
+                setError('Failed to update patient data. Please try again.');
+            }
         }
     };
 
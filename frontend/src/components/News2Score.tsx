@@ -0,0 +1,59 @@
+import React from 'react';
+import { Box, Chip, Typography } from '@mui/material';
+import { MonitorHeart as MonitorHeartIcon } from '@mui/icons-material';
+
+export interface News2 {
+    total: number;
+    band: string;
+    computed_at: string;
+    missing?: string[];
+}
+
+const bandLabels: Record<string, string> = {
+    low: 'Low',
+    low_medium: 'Low-medium',
+    medium: 'Medium',
+    high: 'High',
+};
+
+const bandColors: Record<string, 'success' | 'warning' | 'error'> = {
+    low: 'success',
+    low_medium: 'warning',
+    medium: 'warning',
+    high: 'error',
+};
+
+function formatComputedAt(dateString: string) {
+    const date = new Date(dateString);
+    if (isNaN(date.getTime())) {
+        return 'N/A';
+    }
+    return date.toLocaleString(undefined, {
+        month: 'short',
+        day: 'numeric',
+        hour: '2-digit',
+        minute: '2-digit'
+    });
+}
+
+// News2Score shows a NEWS2 total with its risk band and when it was computed
+export default function News2Score({ news2 }: { news2?: News2 | null }) {
+    if (!news2) {
+        return <Chip icon={<MonitorHeartIcon />} label="NEWS2: no recent vitals" size="small" variant="outlined" />;
+    }
+
+    const partial = news2.missing && news2.missing.length > 0;
+    return (
+        <Box sx={{ display: 'flex', alignItems: 'center', gap: 1 }}>
+            <Chip
+                icon={<MonitorHeartIcon />}
+                label={`NEWS2 ${news2.total} · ${bandLabels[news2.band] || news2.band}${partial ? ' (partial)' : ''}`}
+                color={bandColors[news2.band] || 'default'}
+                size="small"
+            />
+            <Typography variant="caption" color="textSecondary">
+                computed {formatComputedAt(news2.computed_at)}
+            </Typography>
+        </Box>
+    );
+}